@@ -0,0 +1,241 @@
+package main
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"Infra/internal/dockr/export"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// validateResult is the JSON and YAML form of validate.
+type validateResult struct {
+	Valid      bool                 `json:"valid" yaml:"valid"`
+	Error      string               `json:"error,omitempty" yaml:"error,omitempty"`
+	Containers []validatedContainer `json:"containers" yaml:"containers"`
+}
+
+type validatedContainer struct {
+	Name    string `json:"name" yaml:"name"`
+	Service string `json:"service,omitempty" yaml:"service,omitempty"`
+	Image   string `json:"image" yaml:"image"`
+	Source  string `json:"source,omitempty" yaml:"source,omitempty"`
+}
+
+func newValidateCommand(a *app) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check that the config loads and validates",
+		Long: `Check that the config loads and validates, with the profile applied. The
+command exits with code 3 when it does not.
+
+JSON and YAML output is an object, template fields in parentheses:
+  valid       whether the config is valid (Valid)
+  error       why it is not, omitted when it is (Error)
+  containers  the containers of a valid config in name order: name, service,
+              image and source, the file the container is defined in
+              (Containers)
+An invalid config is reported in the output instead of on stderr.`,
+		Args: args(cobra.NoArgs),
+		RunE: func(*cobra.Command, []string) error {
+			p, err := newPrinter(output)
+			if err != nil {
+				return err
+			}
+			res := validateResult{Containers: []validatedContainer{}}
+			conf, err := a.loadConfig()
+			if err != nil {
+				if !p.structured() {
+					return err
+				}
+				res.Error = errors.Unwrap(err).Error()
+			} else {
+				res.Valid = true
+				for _, name := range conf.Names() {
+					c := conf.Containers[name]
+					res.Containers = append(res.Containers, validatedContainer{Name: name, Service: c.GetService(), Image: c.GetImage(), Source: c.GetSource()})
+				}
+			}
+
+			if err = p.print(os.Stdout, res, nil, func(w io.Writer, wide bool) {
+				fmt.Fprintf(w, "config is valid: %d containers\n", len(res.Containers))
+				if wide {
+					fmt.Fprintln(w, "NAME\tSERVICE\tIMAGE\tSOURCE")
+					for _, c := range res.Containers {
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Name, c.Service, c.Image, c.Source)
+					}
+				}
+			}); err != nil {
+				return err
+			}
+			if !res.Valid {
+				return &exitError{code: exitConfig}
+			}
+			return nil
+		},
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func newConfigCommand(a *app) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Render and migrate the config",
+		Args:  args(cobra.NoArgs),
+	}
+
+	var format string
+	render := &cobra.Command{
+		Use:   "render",
+		Short: "Print the effective config with presets and the profile applied",
+		Args:  args(cobra.NoArgs),
+		RunE: func(*cobra.Command, []string) error {
+			conf, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			out, err := conf.Render(format)
+			if err != nil {
+				return usageError("%s", err)
+			}
+			_, err = os.Stdout.Write(out)
+			return err
+		},
+	}
+	render.Flags().StringVar(&format, "format", "yaml", "render format: yaml, json, toml or hcl")
+
+	migrate := &cobra.Command{
+		Use:   "migrate [FILE...]",
+		Short: "Rewrite config files in the current config version",
+		Long: `Rewrite config files in the current config version, the config files when no
+file is given.`,
+		RunE: func(_ *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				args = a.configPaths()
+			}
+			if len(args) == 0 {
+				return usageError("no config file to migrate")
+			}
+			return migrateFiles(args)
+		},
+	}
+
+	cmd.AddCommand(render, migrate)
+	return cmd
+}
+
+func newExportCommand(a *app) *cobra.Command {
+	var out string
+	cmd := &cobra.Command{
+		Use:       "export compose|kubernetes|systemd",
+		Short:     "Print the config as compose, kubernetes or systemd artifacts",
+		Long:      "Print the config as compose or kubernetes artifacts, or write it as systemd units to --out.",
+		Args:      args(cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs)),
+		ValidArgs: []string{"compose", "kubernetes", "k8s", "systemd"},
+		RunE: func(_ *cobra.Command, args []string) error {
+			conf, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			return exportConfig(conf, args[0], out)
+		},
+	}
+	cmd.Flags().StringVar(&out, "out", ".", "directory the systemd units are written to")
+	return cmd
+}
+
+func newLockCommand(a *app) *cobra.Command {
+	var lockfile string
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Resolve the images of the config to their digests and write the lockfile",
+		Args:  args(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			conf, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+			return lockConfig(doc, conf, a.lockPath(lockfile))
+		},
+	}
+	cmd.Flags().StringVar(&lockfile, "lockfile", "", "path of the lockfile (default: infra.lock next to the config)")
+	return cmd
+}
+
+func lockConfig(doc *dockr.Dockr, conf *config.UltimateConfig, path string) error {
+	lock, err := doc.Lock(conf)
+	if err != nil {
+		return err
+	}
+	if err = lock.Write(path); err != nil {
+		return err
+	}
+	log.Printf("locked %d images in %s\n", len(lock.Images), path)
+	return nil
+}
+
+func migrateFiles(paths []string) error {
+	for _, path := range paths {
+		changed, warnings, err := config.MigrateFile(path)
+		if err != nil {
+			return err
+		}
+		for _, w := range warnings {
+			log.Printf("%s: %s\n", path, w)
+		}
+		if changed {
+			log.Printf("%s: migrated to version %d\n", path, config.CurrentVersion)
+		} else {
+			log.Printf("%s: already at version %d\n", path, config.CurrentVersion)
+		}
+	}
+	return nil
+}
+
+func exportConfig(conf *config.UltimateConfig, format, dir string) error {
+	var (
+		out []byte
+		err error
+	)
+
+	switch format {
+	case "compose":
+		out, err = export.Compose(conf)
+	case "kubernetes", "k8s":
+		out, err = export.Kubernetes(conf)
+	case "systemd":
+		units, err := export.Systemd(conf)
+		if err != nil {
+			return err
+		}
+		for name, unit := range units {
+			path := filepath.Join(dir, name)
+			if err = os.WriteFile(path, unit, 0o644); err != nil {
+				return err
+			}
+			log.Printf("wrote %s\n", path)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(out)
+	return err
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"Infra/internal/dockr/dockr"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"github.com/moby/term"
+	"github.com/spf13/cobra"
+)
+
+func newPsCommand(a *app) *cobra.Command {
+	var (
+		output string
+		watch  bool
+	)
+	cmd := &cobra.Command{
+		Use:   "ps",
+		Short: "List the containers of the deployment",
+		Long: `List the containers of the deployment with their state in the daemon and
+the revision that deployed them. With --watch the list is shown again every
+time a container of the deployment changes, until interrupted; JSON output
+is then one document per refresh, YAML output separated by ---.
+
+JSON and YAML output is a list of objects, template fields in parentheses:
+  name              container name (Name)
+  id                container ID (ID)
+  image             image the container runs (Image)
+  digest            registry digest of the image, omitted for local images
+                    (Digest)
+  config_hash       hash of the config it was created from (Hash)
+  service           container service (Service)
+  project           project, omitted without one (Project)
+  state             created, running, paused, restarting, removing, exited
+                    or dead (State)
+  status            status by the daemon, e.g. "Up 5 minutes" (Status)
+  container_status  created, running, stopped or failed (ContainerStatus)
+  health            starting, healthy or unhealthy, omitted without a health
+                    check (Health)
+  started_at        start time, omitted when not running (StartedAt)
+  restart_count     restarts by the daemon (RestartCount)
+  ports             published ports, e.g. "0.0.0.0:8080->80/tcp" (Ports)
+  networks          networks the container is connected to (Networks)
+  revision          applied revision that deployed it, omitted when the state
+                    is not known (Revision)
+Templates can also use {{.Uptime}}, the time since the start.`,
+		Args: args(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			p, err := newPrinter(output)
+			if err != nil {
+				return err
+			}
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+
+			if !watch {
+				states, err := doc.Status()
+				if err != nil {
+					return err
+				}
+				return printStatus(p, os.Stdout, states)
+			}
+
+			clear := !p.structured() && term.IsTerminal(os.Stdout.Fd())
+			refreshes := 0
+			return doc.WatchStatus(func(states []dockr.ContainerState) {
+				switch {
+				case clear:
+					fmt.Print("\033[H\033[2J")
+				case p.format == "yaml" && refreshes > 0:
+					fmt.Println("---")
+				case p.format == "table" || p.format == "wide":
+					if refreshes > 0 {
+						fmt.Println()
+					}
+				}
+				refreshes++
+				if err := printStatus(p, os.Stdout, states); err != nil {
+					log.Printf("failed to print containers: %v\n", err)
+				}
+			})
+		},
+	}
+	addOutputFlag(cmd, &output)
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "show the list again every time a container changes")
+	return cmd
+}
+
+func printStatus(p *printer, w io.Writer, states []dockr.ContainerState) error {
+	return p.print(w, states, itemsOf(states), func(w io.Writer, wide bool) {
+		if wide {
+			fmt.Fprintln(w, "NAME\tSERVICE\tIMAGE\tSTATUS\tHEALTH\tUPTIME\tRESTARTS\tPORTS\tSTATE\tDIGEST\tID\tNETWORKS\tREVISION\tPROJECT\tCONFIG HASH")
+		} else {
+			fmt.Fprintln(w, "NAME\tSERVICE\tIMAGE\tSTATUS\tHEALTH\tUPTIME\tRESTARTS\tPORTS")
+		}
+		for _, s := range states {
+			health, uptime := orDash(s.Health), "-"
+			if s.StartedAt != nil {
+				uptime = units.HumanDuration(s.Uptime())
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s", s.Name, s.Service, s.Image, s.ContainerStatus, health, uptime, s.RestartCount, orDash(strings.Join(s.Ports, ",")))
+			if wide {
+				revision := "-"
+				if s.Revision > 0 {
+					revision = strconv.Itoa(s.Revision)
+				}
+				fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t%s\t%s\t%s", s.State, orDash(shortID(s.Digest)), shortID(s.ID), orDash(strings.Join(s.Networks, ",")), revision, orDash(s.Project), shortID(s.Hash))
+			}
+			fmt.Fprintln(w)
+		}
+	})
+}
+
+// orDash returns s, or - when it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func newLogsCommand(a *app) *cobra.Command {
+	var opts container.LogsOptions
+	cmd := &cobra.Command{
+		Use:   "logs NAME",
+		Short: "Print the logs of a container",
+		Args:  args(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+			return doc.Logs(args[0], opts, os.Stdout, os.Stderr)
+		},
+		ValidArgsFunction: completeContainers(a),
+	}
+	// -f is the config of every command
+	cmd.Flags().BoolVar(&opts.Follow, "follow", false, "follow the log output")
+	cmd.Flags().StringVarP(&opts.Tail, "tail", "n", "all", "number of lines to show from the end of the logs")
+	cmd.Flags().BoolVarP(&opts.Timestamps, "timestamps", "t", false, "show timestamps")
+	cmd.Flags().StringVar(&opts.Since, "since", "", "show logs since a timestamp (e.g. 2024-01-02T13:23:37Z) or relative (e.g. 42m)")
+	return cmd
+}
+
+func newExecCommand(a *app) *cobra.Command {
+	var (
+		opts        dockr.ExecOptions
+		interactive bool
+	)
+	cmd := &cobra.Command{
+		Use:   "exec NAME COMMAND [ARG...]",
+		Short: "Run a command in a running container",
+		Long: `Run a command in a running container. infra exec exits with the exit code
+of the command.`,
+		Args: args(cobra.MinimumNArgs(2)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+
+			opts.Stdout, opts.Stderr = os.Stdout, os.Stderr
+			if interactive {
+				opts.Stdin = os.Stdin
+			}
+			if fd := os.Stdin.Fd(); opts.Tty && term.IsTerminal(fd) {
+				state, err := term.SetRawTerminal(fd)
+				if err != nil {
+					return err
+				}
+				defer term.RestoreTerminal(fd, state)
+				if size, err := term.GetWinsize(os.Stdout.Fd()); err == nil {
+					opts.Size = [2]uint{uint(size.Height), uint(size.Width)}
+				}
+			}
+
+			code, err := doc.Exec(args[0], args[1:], opts)
+			if err != nil {
+				return err
+			}
+			if code != 0 {
+				return &exitError{code: code}
+			}
+			return nil
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			return completeContainers(a)(cmd, args, toComplete)
+		},
+	}
+	// flags after the container name belong to the command
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "keep stdin open and pass it to the command")
+	cmd.Flags().BoolVarP(&opts.Tty, "tty", "t", false, "allocate a pseudo-TTY")
+	cmd.Flags().StringVarP(&opts.User, "user", "u", "", "user to run the command as, user[:group]")
+	cmd.Flags().StringVarP(&opts.WorkingDir, "workdir", "w", "", "working directory of the command")
+	cmd.Flags().StringArrayVarP(&opts.Env, "env", "e", nil, "environment variable of the command, KEY=VALUE")
+	return cmd
+}
+
+func newRestartCommand(a *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "restart [NAME...]",
+		Short: "Restart containers of the deployment, all of them without names",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+			return doc.Restart(args...)
+		},
+		ValidArgsFunction: completeContainers(a),
+	}
+}
+
+func newInspectCommand(a *app) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "inspect [NAME...]",
+		Short: "Show the config and deployment of containers, all of them without names",
+		Long: `Show the config and deployment of containers, all of them without names.
+Secrets are shown as the references of the config.
+
+JSON and YAML output is a list of objects, template fields in parentheses:
+  name            container name (Name)
+  service         container service (Service)
+  image           image (Image)
+  hostname        hostname (Hostname)
+  cmd             command (Cmd)
+  entrypoint      entrypoint (Entrypoint)
+  working_dir     working directory (WorkingDir)
+  user            user[:group] (User)
+  env             KEY=VALUE environment, sorted (Env)
+  labels          labels of the config (Labels)
+  ports           published ports: host_ip, host_port, container_port and
+                  protocol (Ports)
+  volumes         volume mounts (Volumes)
+  network         user defined network (Network)
+  network_mode    network mode (NetworkMode)
+  restart_policy  restart policy (RestartPolicy)
+  resources       effective limits: nano_cpus, cpu_shares, memory,
+                  memory_reservation, pids_limit and shm_size in bytes
+                  (Resources)
+  health_check    test, interval, timeout, start_period and retries
+                  (HealthCheck)
+  depends_on      containers started before this one (DependsOn)
+  action          create, update, remove or unchanged (Action)
+  deployed        the deployed container as listed by ps, null when it is
+                  not deployed (Deployed)
+Empty fields are omitted. Containers that are only deployed carry their name,
+service and image.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := newPrinter(output)
+			if err != nil {
+				return err
+			}
+			conf, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+
+			plan, err := doc.Plan(conf)
+			if err != nil {
+				return err
+			}
+			containers, err := dockr.Inspect(conf, plan, args...)
+			if err != nil {
+				return err
+			}
+
+			return p.print(os.Stdout, containers, itemsOf(containers), func(w io.Writer, wide bool) {
+				if wide {
+					fmt.Fprintln(w, "NAME\tSERVICE\tIMAGE\tACTION\tSTATE\tPORTS\tCPUS\tMEMORY\tNETWORK")
+				} else {
+					fmt.Fprintln(w, "NAME\tSERVICE\tIMAGE\tACTION\tSTATE")
+				}
+				for _, c := range containers {
+					state := "-"
+					if c.Deployed != nil {
+						state = c.Deployed.State
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s", c.Name, c.Service, c.Image, c.Action, state)
+					if wide {
+						ports := make([]string, 0, len(c.Ports))
+						for _, port := range c.Ports {
+							if port.HostPort != "" {
+								ports = append(ports, fmt.Sprintf("%s:%d/%s", port.HostPort, port.ContainerPort, port.Protocol))
+							}
+						}
+						cpus, memory := "-", "-"
+						if c.Resources.NanoCPUs > 0 {
+							cpus = strconv.FormatFloat(float64(c.Resources.NanoCPUs)/1e9, 'f', -1, 64)
+						}
+						if c.Resources.Memory > 0 {
+							memory = units.BytesSize(float64(c.Resources.Memory))
+						}
+						fmt.Fprintf(w, "\t%s\t%s\t%s\t%s", strings.Join(ports, ","), cpus, memory, c.Network)
+					}
+					fmt.Fprintln(w)
+				}
+			})
+		},
+		ValidArgsFunction: completeContainers(a),
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moby/term"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// pullFlags set how a deployment pulls images.
+type pullFlags struct {
+	pulls  int
+	policy string
+}
+
+func (f *pullFlags) register(flags *pflag.FlagSet) {
+	flags.IntVar(&f.pulls, "pulls", dockr.DefaultPullConcurrency, "number of images pulled at the same time")
+	flags.StringVar(&f.policy, "pull", "", "pull policy of containers without one: always, if-not-present or never (default: always for latest tags, if-not-present otherwise)")
+}
+
+func (f *pullFlags) configure(doc *dockr.Dockr) error {
+	doc.SetPullConcurrency(f.pulls)
+	doc.OnPullProgress(newProgressView(os.Stderr).Update)
+	if err := doc.SetPullPolicy(f.policy); err != nil {
+		return &exitError{code: exitUsage, err: err}
+	}
+	return nil
+}
+
+// lockFlags make a deployment deploy strictly by digest.
+type lockFlags struct {
+	locked   bool
+	lockfile string
+}
+
+func (f *lockFlags) register(flags *pflag.FlagSet) {
+	flags.BoolVar(&f.locked, "locked", false, "deploy strictly by digest from the lockfile")
+	flags.StringVar(&f.lockfile, "lockfile", "", "path of the lockfile (default: infra.lock next to the config)")
+}
+
+func (f *lockFlags) configure(a *app, doc *dockr.Dockr) error {
+	if !f.locked {
+		return nil
+	}
+	lock, err := config.LoadLock(a.lockPath(f.lockfile))
+	if err != nil {
+		return configError(err)
+	}
+	doc.SetLock(lock)
+	return nil
+}
+
+func newUpCommand(a *app) *cobra.Command {
+	var (
+		pulls    pullFlags
+		locks    lockFlags
+		watch    bool
+		interval time.Duration
+		bundle   string
+	)
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Deploy the config",
+		Long: `Deploy the config: create the missing containers, replace the changed ones
+and remove the containers that are no longer part of it. With --watch the
+deployment follows every change of the config files until interrupted.`,
+		Args: args(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if watch && len(a.configPaths()) == 0 {
+				return usageError("--watch needs a config file")
+			}
+
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+			if err = pulls.configure(doc); err != nil {
+				return err
+			}
+			if err = locks.configure(a, doc); err != nil {
+				return err
+			}
+			if bundle != "" {
+				if err = loadImageBundle(doc, bundle); err != nil {
+					return err
+				}
+				if pulls.policy == "" {
+					if err = doc.SetPullPolicy(config.PullNever); err != nil {
+						return err
+					}
+				}
+			}
+
+			if watch {
+				return doc.Watch(a.configPaths(), a.profile, interval)
+			}
+			conf, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			return doc.Sync(conf)
+		},
+	}
+	pulls.register(cmd.Flags())
+	locks.register(cmd.Flags())
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "keep the deployment in sync with the config files")
+	cmd.Flags().DurationVar(&interval, "interval", config.DefaultWatchInterval, "polling interval of --watch")
+	cmd.Flags().StringVar(&bundle, "load-bundle", "", "load the images of a bundle file before deploying, the pull policy defaults to never")
+	return cmd
+}
+
+func newDownCommand(a *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "down",
+		Short: "Stop and remove the containers of the deployment",
+		Args:  args(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+
+			removed, err := doc.Down()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("removed %d containers\n", len(removed))
+			return nil
+		},
+	}
+}
+
+func newPlanCommand(a *app) *cobra.Command {
+	var (
+		locks    lockFlags
+		exitCode bool
+		output   string
+	)
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show the changes deploying the config would make",
+		Long: `Show the changes deploying the config would make, without making them. The
+plan fails with exit code 4 when it does not fit the host.
+
+JSON and YAML output is an object, template fields in parentheses:
+  changes      list of changes in the order they are applied (Changes)
+    action       create, update or remove (Action)
+    name         container name (Name)
+    id           ID of the deployed container, omitted for create (ID)
+    image        desired image, the deployed image for remove (Image)
+    config_hash  hash of the desired config, omitted for remove (Hash)
+  unchanged    names of the containers that stay as they are (Unchanged)
+  fits         whether the deployment fits the host (Fits)
+  problems     why it does not fit, omitted when it does (Problems)`,
+		Args: args(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			p, err := newPrinter(output)
+			if err != nil {
+				return err
+			}
+			conf, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+			if err = locks.configure(a, doc); err != nil {
+				return err
+			}
+
+			plan, admission, err := planConfig(doc, conf)
+			if err != nil {
+				return err
+			}
+			summary := plan.Summary(admission)
+			err = p.print(os.Stdout, summary, nil, func(w io.Writer, wide bool) {
+				if !wide {
+					fmt.Fprintln(w, plan)
+					return
+				}
+				fmt.Fprintln(w, "ACTION\tNAME\tIMAGE\tID\tCONFIG HASH")
+				for _, c := range summary.Changes {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Action, c.Name, c.Image, shortID(c.ID), shortID(c.Hash))
+				}
+				fmt.Fprintf(w, "%d unchanged\n", len(summary.Unchanged))
+			})
+			if err != nil {
+				return err
+			}
+
+			if !admission.Fits() {
+				return &dockr.CapacityError{Admission: admission}
+			}
+			if exitCode && !plan.Empty() {
+				return &exitError{code: exitChanges}
+			}
+			return nil
+		},
+	}
+	locks.register(cmd.Flags())
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "exit with code 5 when the plan has changes")
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func newApplyCommand(a *app) *cobra.Command {
+	var (
+		pulls pullFlags
+		locks lockFlags
+		yes   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Show the plan of the config and apply it after confirmation",
+		Args:  args(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			conf, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+			if err = pulls.configure(doc); err != nil {
+				return err
+			}
+			if err = locks.configure(a, doc); err != nil {
+				return err
+			}
+
+			plan, admission, err := planConfig(doc, conf)
+			if err != nil {
+				return err
+			}
+			fmt.Println(plan)
+			if !admission.Fits() {
+				return &dockr.CapacityError{Admission: admission}
+			}
+			if plan.Empty() {
+				return nil
+			}
+
+			if !yes {
+				ok, err := confirm("Apply these changes?")
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return &exitError{code: exitFailure, err: errors.New("apply cancelled")}
+				}
+			}
+			return doc.Apply(plan)
+		},
+	}
+	pulls.register(cmd.Flags())
+	locks.register(cmd.Flags())
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "apply without asking for confirmation")
+	return cmd
+}
+
+func newScaleCommand(a *app) *cobra.Command {
+	var (
+		pulls pullFlags
+		locks lockFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "scale NAME=REPLICAS...",
+		Short: "Set the number of replicas of containers",
+		Long: `Deploy the config with the given number of replicas of containers, named
+name, name_2, ... The replicas hold until the config is deployed again, set
+replicas in the config to keep them.`,
+		Args: args(cobra.MinimumNArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			replicas := make(map[string]int, len(args))
+			for _, arg := range args {
+				name, value, ok := strings.Cut(arg, "=")
+				n, err := strconv.Atoi(value)
+				if !ok || err != nil || n < 1 {
+					return usageError("invalid scale %q, expected NAME=REPLICAS with at least one replica", arg)
+				}
+				replicas[name] = n
+			}
+
+			conf, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			for name, n := range replicas {
+				if err = conf.Scale(name, n); err != nil {
+					return configError(err)
+				}
+			}
+
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+			if err = pulls.configure(doc); err != nil {
+				return err
+			}
+			if err = locks.configure(a, doc); err != nil {
+				return err
+			}
+			return doc.Sync(conf)
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			names, directive := completeContainers(a)(cmd, args, toComplete)
+			for i := range names {
+				names[i] += "="
+			}
+			return names, directive | cobra.ShellCompDirectiveNoSpace
+		},
+	}
+	pulls.register(cmd.Flags())
+	locks.register(cmd.Flags())
+	return cmd
+}
+
+// planConfig plans conf and checks the plan against the host capacity.
+func planConfig(doc *dockr.Dockr, conf *config.UltimateConfig) (*dockr.Plan, *dockr.Admission, error) {
+	plan, err := doc.Plan(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	admission, err := doc.Admit(plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plan, admission, nil
+}
+
+// confirm asks a yes/no question on the terminal, answering no by default.
+func confirm(question string) (bool, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return false, usageError("stdin is not a terminal, pass --yes to apply without confirmation")
+	}
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func newPruneCommand(a *app) *cobra.Command {
+	var (
+		opts     dockr.PruneOptions
+		lockfile string
+	)
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove images the config, the kept revisions and the lockfile no longer use",
+		Args:  args(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			conf, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			if path := a.lockPath(lockfile); fileExists(path) {
+				if opts.Lock, err = config.LoadLock(path); err != nil {
+					return configError(err)
+				}
+			}
+
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+
+			report, err := doc.PruneImages(conf, opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(report)
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&opts.Keep, "keep", dockr.DefaultPruneKeep, "number of latest revisions whose images are kept for rollbacks")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "list the images that would be removed without removing them")
+	cmd.Flags().StringVar(&lockfile, "lockfile", "", "path of the lockfile (default: infra.lock next to the config)")
+	return cmd
+}
+
+func newBundleCommand(a *app) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Save and load the images of the config for offline hosts",
+		Args:  args(cobra.NoArgs),
+	}
+
+	save := &cobra.Command{
+		Use:   "save FILE",
+		Short: "Write the images of the config to a bundle file",
+		Args:  args(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+			doc.OnPullProgress(newProgressView(os.Stderr).Update)
+			return saveImageBundle(doc, conf, args[0])
+		},
+	}
+
+	load := &cobra.Command{
+		Use:   "load FILE",
+		Short: "Load the images of a bundle file",
+		Long: `Load the images of a bundle file. To load a bundle and deploy in one step,
+use up --load-bundle.`,
+		Args: args(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			doc, err := a.newDockr(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer doc.Close()
+			return loadImageBundle(doc, args[0])
+		},
+	}
+
+	cmd.AddCommand(save, load)
+	return cmd
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func saveImageBundle(doc *dockr.Dockr, conf *config.UltimateConfig, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	manifest, err := doc.SaveBundle(conf, f)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	log.Printf("bundled %d images in %s\n", len(manifest.Images), path)
+	return nil
+}
+
+func loadImageBundle(doc *dockr.Dockr, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	manifest, err := doc.LoadBundle(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	log.Printf("loaded %d images from %s\n", len(manifest.Images), path)
+	return nil
+}
@@ -1,33 +1,76 @@
 package main
 
 import (
-	"Infra/internal/dockr/config"
 	"Infra/internal/dockr/dockr"
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
-func main() {
-	
-	doc, err := dockr.NewDockr(context.Background(), nil)
-	if err != nil {
-		log.Fatal(err)
+// Exit codes of the infra command.
+const (
+	exitOK       = 0 // success
+	exitFailure  = 1 // the command failed
+	exitUsage    = 2 // invalid command, flags or arguments
+	exitConfig   = 3 // the config does not load or validate
+	exitCapacity = 4 // the deployment does not fit the host
+	exitChanges  = 5 // plan --exit-code: the deployment differs from the config
+)
+
+// exitError is an error with the exit code it ends the command with. An
+// exitError without err ends the command silently.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit code %d", e.code)
 	}
-	
-	conf, err := config.NewContainersConfig(
-		config.ApiGatewayConfig,
-		config.HaproxyConfig,
-		config.MongoConfig,
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func usageError(format string, args ...any) error {
+	return &exitError{code: exitUsage, err: fmt.Errorf(format, args...)}
+}
+
+func configError(err error) error {
+	return &exitError{code: exitConfig, err: err}
+}
+
+// exitCode returns the exit code of the error a command returned.
+func exitCode(err error) int {
+	var (
+		exitErr *exitError
+		capErr  *dockr.CapacityError
 	)
-	
-	if err != nil {
-		log.Fatal(err)
-	}
-	
-	err = doc.InitContainers(conf)
-	if err != nil {
-		log.Fatal(err)
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case errors.As(err, &capErr):
+		return exitCapacity
+	default:
+		return exitFailure
 	}
 }
 
-
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := newRootCommand().ExecuteContext(ctx)
+	stop()
+	var exitErr *exitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.err == nil) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"Infra/internal/dockr/dockr"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// run runs the infra command with args and returns what it wrote to stdout
+// and its exit code.
+func run(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		raw, _ := io.ReadAll(r)
+		out <- string(raw)
+	}()
+
+	root := newRootCommand()
+	root.SetArgs(append([]string{"--log-level", "error"}, args...))
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	err = root.Execute()
+	w.Close()
+	return <-out, exitCode(err)
+}
+
+func TestExitCode(t *testing.T) {
+
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{errors.New("daemon unreachable"), exitFailure},
+		{usageError("invalid output format %q", "xml"), exitUsage},
+		{configError(errors.New("duplicate container name")), exitConfig},
+		{fmt.Errorf("error apply: %w", &dockr.CapacityError{Admission: &dockr.Admission{}}), exitCapacity},
+		{&exitError{code: exitChanges}, exitChanges},
+	} {
+		if code := exitCode(tc.err); code != tc.want {
+			t.Errorf("%v: got exit code %d, want %d", tc.err, code, tc.want)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	t.Setenv(envConfig, "")
+	t.Setenv(envProject, "")
+	// no infra.yaml in the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "infra.yaml")
+	if err := os.WriteFile(valid, []byte("version: 2\ncontainers:\n  - name: web\n    image: nginx:1.27\n  - name: cache\n    image: redis:7\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("version: 2\ncontainers:\n  - name: web\n    image: nginx:1.27\n  - name: web\n    image: nginx:1.27\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Usage", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"valdate"},
+			{"validate", "--unknown"},
+			{"validate", "extra"},
+			{"validate", "-f", valid, "-o", "xml"},
+			{"--log-level", "loud", "validate"},
+		} {
+			if _, code := run(t, args...); code != exitUsage {
+				t.Errorf("%v: got exit code %d, want %d", args, code, exitUsage)
+			}
+		}
+	})
+
+	t.Run("NoConfig", func(t *testing.T) {
+		if _, code := run(t, "validate"); code != exitConfig {
+			t.Errorf("got exit code %d, want %d", code, exitConfig)
+		}
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		out, code := run(t, "validate", "-f", valid)
+		if code != exitOK || out != "config is valid: 2 containers\n" {
+			t.Errorf("exit code %d, output %q", code, out)
+		}
+
+		out, code = run(t, "validate", "-f", valid, "-o", "wide")
+		if code != exitOK || !strings.Contains(out, "NAME   SERVICE  IMAGE       SOURCE\ncache           redis:7     "+valid) {
+			t.Errorf("exit code %d, output:\n%s", code, out)
+		}
+
+		out, code = run(t, "validate", "-f", valid, "-o", "template={{range .Containers}}{{.Name}}={{.Image}} {{end}}")
+		if code != exitOK || out != "cache=redis:7 web=nginx:1.27 \n" {
+			t.Errorf("exit code %d, output %q", code, out)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, code := run(t, "validate", "-f", invalid); code != exitConfig {
+			t.Errorf("got exit code %d, want %d", code, exitConfig)
+		}
+
+		for _, output := range []string{"json", "yaml"} {
+			out, code := run(t, "validate", "-f", invalid, "-o", output)
+			if code != exitConfig {
+				t.Errorf("%s: got exit code %d, want %d", output, code, exitConfig)
+			}
+			if !strings.Contains(out, "duplicate container name: web") {
+				t.Errorf("%s: error not reported in the output:\n%s", output, out)
+			}
+		}
+
+		out, _ := run(t, "validate", "-f", invalid, "-o", "json")
+		var res validateResult
+		if err := json.Unmarshal([]byte(out), &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Valid || len(res.Containers) != 0 {
+			t.Errorf("unexpected result %+v", res)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormats are the values of --output besides template=TEMPLATE.
+var outputFormats = []string{"table", "wide", "json", "yaml"}
+
+// templateFuncs are the functions of output templates besides the built-in
+// ones of text/template.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	},
+	"join": strings.Join,
+}
+
+// printer writes the result of a query command in the format of --output:
+// a table, a wide table with more columns, JSON, YAML or a Go template.
+type printer struct {
+	format string
+	tmpl   *template.Template
+}
+
+// addOutputFlag adds --output to a query command.
+func addOutputFlag(cmd *cobra.Command, output *string) {
+	cmd.Flags().StringVarP(output, "output", "o", "table", "output format: table, wide, json, yaml or template=TEMPLATE (a Go template, see --help)")
+	cmd.RegisterFlagCompletionFunc("output", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return append(outputFormats, "template="), cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+func newPrinter(output string) (*printer, error) {
+	for _, format := range outputFormats {
+		if output == format {
+			return &printer{format: format}, nil
+		}
+	}
+	text, ok := strings.CutPrefix(output, "template=")
+	if !ok {
+		return nil, usageError("invalid output format %q, expected table, wide, json, yaml or template=TEMPLATE", output)
+	}
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, usageError("invalid output template: %s", err)
+	}
+	return &printer{format: "template", tmpl: tmpl}, nil
+}
+
+// structured reports whether the output is meant for scripts.
+func (p *printer) structured() bool {
+	return p.format != "table" && p.format != "wide"
+}
+
+// print writes v to w. A template is executed for every item of a list
+// result, each followed by a newline, and for v itself when items is nil.
+// Tables are written by table.
+func (p *printer) print(w io.Writer, v any, items []any, table func(w io.Writer, wide bool)) error {
+	switch p.format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "template":
+		if items == nil {
+			items = []any{v}
+		}
+		for _, item := range items {
+			if err := p.tmpl.Execute(w, item); err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	table(tw, p.format == "wide")
+	return tw.Flush()
+}
+
+// itemsOf returns the items of a list result for print.
+func itemsOf[T any](list []T) []any {
+	items := make([]any, len(list))
+	for i, item := range list {
+		items[i] = item
+	}
+	return items
+}
+
+// shortID returns the first 12 hex digits of an ID or hash.
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
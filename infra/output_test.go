@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+type printed struct {
+	Name  string   `json:"name" yaml:"name"`
+	Ports []string `json:"ports,omitempty" yaml:"ports,omitempty"`
+}
+
+func TestPrinter(t *testing.T) {
+
+	list := []printed{{Name: "web", Ports: []string{"8080", "8443"}}, {Name: "db"}}
+	table := func(w io.Writer, wide bool) {
+		if wide {
+			fmt.Fprintln(w, "NAME\tPORTS")
+		} else {
+			fmt.Fprintln(w, "NAME")
+		}
+		for _, c := range list {
+			fmt.Fprint(w, c.Name)
+			if wide {
+				fmt.Fprintf(w, "\t%d", len(c.Ports))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	for _, tc := range []struct {
+		output, want string
+		structured   bool
+	}{
+		{output: "table", want: "NAME\nweb\ndb\n"},
+		{output: "wide", want: "NAME  PORTS\nweb   2\ndb    0\n"},
+		{output: "json", structured: true, want: `[
+  {
+    "name": "web",
+    "ports": [
+      "8080",
+      "8443"
+    ]
+  },
+  {
+    "name": "db"
+  }
+]
+`},
+		{output: "yaml", structured: true, want: `- name: web
+  ports:
+    - "8080"
+    - "8443"
+- name: db
+`},
+		{output: `template={{.Name}} {{join .Ports ","}}`, structured: true, want: "web 8080,8443\ndb \n"},
+		{output: "template={{json .}}", structured: true, want: `{"name":"web","ports":["8080","8443"]}` + "\n" + `{"name":"db"}` + "\n"},
+	} {
+		t.Run(tc.output, func(t *testing.T) {
+			p, err := newPrinter(tc.output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.structured() != tc.structured {
+				t.Errorf("structured: got %v, want %v", p.structured(), tc.structured)
+			}
+
+			var buf bytes.Buffer
+			if err = p.print(&buf, list, itemsOf(list), table); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", buf.String(), tc.want)
+			}
+		})
+	}
+
+	t.Run("TemplateWhole", func(t *testing.T) {
+		p, err := newPrinter("template={{len .}} containers")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err = p.print(&buf, list, nil, table); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "2 containers\n" {
+			t.Errorf("unexpected output %q", buf.String())
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, output := range []string{"xml", "template={{.Name", "Table"} {
+			_, err := newPrinter(output)
+			var exitErr *exitError
+			if !errors.As(err, &exitErr) || exitErr.code != exitUsage {
+				t.Errorf("output %q: expected a usage error, got %v", output, err)
+			}
+		}
+	})
+
+	t.Run("TemplateError", func(t *testing.T) {
+		p, err := newPrinter("template={{.Missing}}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = p.print(io.Discard, list, itemsOf(list), table); err == nil {
+			t.Error("expected an error executing the template")
+		}
+	})
+
+	t.Run("ShortID", func(t *testing.T) {
+		if id := shortID("sha256:0123456789abcdef0123"); id != "0123456789ab" {
+			t.Errorf("unexpected short ID %s", id)
+		}
+		if id := shortID("abc"); id != "abc" {
+			t.Errorf("unexpected short ID %s", id)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"Infra/internal/dockr/dockr"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/docker/go-units"
+)
+
+// redrawInterval limits how often the progress lines are redrawn.
+const redrawInterval = 100 * time.Millisecond
+
+// progressView renders one line per image pull with the finished layers and
+// the downloaded bytes. On a terminal the lines are redrawn in place,
+// otherwise a line is printed when a pull finishes.
+type progressView struct {
+	w      io.Writer
+	tty    bool
+	images []string
+	pulls  map[string]*pullProgress
+	lines  int
+	drawn  time.Time
+}
+
+type pullProgress struct {
+	layers map[string]*layerProgress
+	done   bool
+	err    error
+}
+
+type layerProgress struct {
+	current, total int64
+	done           bool
+}
+
+func newProgressView(f *os.File) *progressView {
+	tty := false
+	if info, err := f.Stat(); err == nil {
+		tty = info.Mode()&os.ModeCharDevice != 0
+	}
+	return &progressView{w: f, tty: tty, pulls: make(map[string]*pullProgress)}
+}
+
+// Update records a pull event, see dockr.Dockr.OnPullProgress.
+func (v *progressView) Update(e dockr.PullEvent) {
+	p, ok := v.pulls[e.Image]
+	if !ok {
+		p = &pullProgress{layers: make(map[string]*layerProgress)}
+		v.pulls[e.Image] = p
+		v.images = append(v.images, e.Image)
+		slices.Sort(v.images)
+	}
+
+	switch {
+	case e.Done:
+		p.done, p.err = true, e.Err
+	case e.Layer != "":
+		l, ok := p.layers[e.Layer]
+		if !ok {
+			l = &layerProgress{}
+			p.layers[e.Layer] = l
+		}
+		switch e.Status {
+		case "Downloading":
+			l.current, l.total = e.Current, e.Total
+		case "Download complete":
+			l.current = l.total
+		case "Pull complete", "Already exists":
+			l.current, l.done = l.total, true
+		}
+	}
+
+	if !v.tty {
+		if e.Done {
+			fmt.Fprintln(v.w, v.line(e.Image))
+		}
+		return
+	}
+	if e.Done || time.Since(v.drawn) >= redrawInterval {
+		v.redraw()
+	}
+}
+
+func (v *progressView) redraw() {
+	if v.lines > 0 {
+		fmt.Fprintf(v.w, "\033[%dA", v.lines)
+	}
+	for _, img := range v.images {
+		fmt.Fprintf(v.w, "\033[2K%s\n", v.line(img))
+	}
+	v.lines, v.drawn = len(v.images), time.Now()
+}
+
+func (v *progressView) line(img string) string {
+	p := v.pulls[img]
+	if p.err != nil {
+		return fmt.Sprintf("%-40s failed: %s", img, p.err)
+	}
+
+	var (
+		done           int
+		current, total int64
+	)
+	for _, l := range p.layers {
+		if l.done {
+			done++
+		}
+		current += l.current
+		total += l.total
+	}
+	if p.done {
+		return fmt.Sprintf("%-40s done, %d layers, %s", img, len(p.layers), units.HumanSize(float64(total)))
+	}
+	return fmt.Sprintf("%-40s %d/%d layers  %s/%s", img, done, len(p.layers),
+		units.HumanSize(float64(current)), units.HumanSize(float64(total)))
+}
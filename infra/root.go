@@ -0,0 +1,239 @@
+package main
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Environment variables providing defaults of the global flags.
+const (
+	envConfig  = "INFRA_CONFIG"
+	envProject = "INFRA_PROJECT"
+)
+
+// defaultConfig is the config file loaded from the working directory when no
+// config is given.
+const defaultConfig = "infra.yaml"
+
+// app holds the global flags shared by every command.
+type app struct {
+	configs  []string
+	project  string
+	profile  string
+	host     string
+	logLevel string
+
+	logger *zap.Logger
+}
+
+func newRootCommand() *cobra.Command {
+	a := &app{}
+	root := &cobra.Command{
+		Use:   "infra",
+		Short: "Deploy and operate container stacks on a Docker host",
+		Long: `infra deploys the containers of a stack config to a Docker host and keeps
+them in sync with it.
+
+The config is read from the --config files, $INFRA_CONFIG (a list of paths)
+or infra.yaml in the working directory; without any of them the commands that
+need a config fail with exit code 3.
+
+The containers are managed per project, set with --project or
+$INFRA_PROJECT. Without a project up, apply and down manage the containers
+deployed without one; containers of other projects are never touched.
+
+Exit codes:
+  0  success
+  1  the command failed
+  2  invalid command, flags or arguments
+  3  the config does not load or validate
+  4  the deployment does not fit the host
+  5  plan --exit-code: the deployment differs from the config
+  exec exits with the exit code of the command it ran.
+
+Output:
+  The query commands ps, plan, inspect and validate print a table, or with
+  --output wide a table with more columns. --output json and --output yaml
+  print the documented structures described in the help of each command;
+  fields are only ever added to them. --output template=TEMPLATE executes a Go
+  template (text/template) for every container of ps and inspect and for the
+  whole result of plan and validate. Templates use the Go field names, e.g.
+  template='{{.Name}} {{.State}}', and the functions json and join.`,
+		Args:                       cobra.ArbitraryArgs,
+		SuggestionsMinimumDistance: 2,
+		SilenceErrors:              true,
+		SilenceUsage:               true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return cmd.Help()
+			}
+			msg := "unknown command %q for %q"
+			if suggestions := cmd.SuggestionsFor(args[0]); len(suggestions) > 0 {
+				msg += ", did you mean " + strings.Join(suggestions, " or ") + "?"
+			}
+			return usageError(msg, args[0], cmd.CommandPath())
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			return a.init()
+		},
+		PersistentPostRun: func(*cobra.Command, []string) {
+			if a.logger != nil {
+				a.logger.Sync()
+			}
+		},
+	}
+	root.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return &exitError{code: exitUsage, err: err}
+	})
+
+	flags := root.PersistentFlags()
+	flags.StringArrayVarP(&a.configs, "config", "f", nil, "config file or directory, - for stdin; repeat to merge several files in order")
+	flags.StringVarP(&a.project, "project", "p", os.Getenv(envProject), "project name; manages the containers of the project only (default: the containers deployed without a project)")
+	flags.StringVar(&a.profile, "profile", "", "profile overlay to apply, e.g. prod for conf.prod.yaml")
+	flags.StringVarP(&a.host, "host", "H", "", "Docker daemon socket to connect to (default: $DOCKER_HOST)")
+	flags.StringVar(&a.logLevel, "log-level", "info", "log level: debug, info, warn or error")
+
+	root.AddGroup(
+		&cobra.Group{ID: "deploy", Title: "Deployment Commands:"},
+		&cobra.Group{ID: "containers", Title: "Container Commands:"},
+		&cobra.Group{ID: "config", Title: "Config Commands:"},
+		&cobra.Group{ID: "images", Title: "Image Commands:"},
+	)
+	for _, cmd := range []*cobra.Command{
+		newUpCommand(a), newDownCommand(a), newPlanCommand(a), newApplyCommand(a), newScaleCommand(a),
+	} {
+		cmd.GroupID = "deploy"
+		root.AddCommand(cmd)
+	}
+	for _, cmd := range []*cobra.Command{
+		newPsCommand(a), newInspectCommand(a), newLogsCommand(a), newExecCommand(a), newRestartCommand(a),
+	} {
+		cmd.GroupID = "containers"
+		root.AddCommand(cmd)
+	}
+	for _, cmd := range []*cobra.Command{
+		newValidateCommand(a), newConfigCommand(a), newExportCommand(a), newLockCommand(a),
+	} {
+		cmd.GroupID = "config"
+		root.AddCommand(cmd)
+	}
+	for _, cmd := range []*cobra.Command{
+		newPruneCommand(a), newBundleCommand(a),
+	} {
+		cmd.GroupID = "images"
+		root.AddCommand(cmd)
+	}
+	return root
+}
+
+// init applies the global flags: the log level and the Docker host.
+func (a *app) init() error {
+	level, err := zapcore.ParseLevel(a.logLevel)
+	if err != nil {
+		return usageError("invalid log level %q, expected debug, info, warn or error", a.logLevel)
+	}
+	conf := zap.NewDevelopmentConfig()
+	conf.Level = zap.NewAtomicLevelAt(level)
+	if a.logger, err = conf.Build(); err != nil {
+		return err
+	}
+	if level > zapcore.InfoLevel {
+		// the config loader and the client report through the standard logger
+		log.SetOutput(io.Discard)
+	}
+
+	if a.host != "" {
+		return os.Setenv("DOCKER_HOST", a.host)
+	}
+	return nil
+}
+
+// configPaths returns the config files to load, none when there is no
+// config.
+func (a *app) configPaths() []string {
+	if len(a.configs) > 0 {
+		return a.configs
+	}
+	if env := os.Getenv(envConfig); env != "" {
+		return filepath.SplitList(env)
+	}
+	if _, err := os.Stat(defaultConfig); err == nil {
+		return []string{defaultConfig}
+	}
+	return nil
+}
+
+// loadConfig loads the config with the profile applied.
+func (a *app) loadConfig() (*config.UltimateConfig, error) {
+	paths := a.configPaths()
+	if len(paths) == 0 {
+		return nil, configError(fmt.Errorf("no config: pass --config, set $%s or create %s in the working directory", envConfig, defaultConfig))
+	}
+	conf, err := config.LoadFiles(paths, a.profile)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return conf, nil
+}
+
+// lockPath returns the lockfile of the config, path when it is set.
+func (a *app) lockPath(path string) string {
+	if path != "" {
+		return path
+	}
+	var first string
+	if paths := a.configPaths(); len(paths) > 0 {
+		first = paths[0]
+	}
+	return config.LockPath(first)
+}
+
+// newDockr connects to the Docker host for the project.
+func (a *app) newDockr(ctx context.Context) (*dockr.Dockr, error) {
+	doc, err := dockr.NewDockr(ctx, a.logger.Sugar())
+	if err != nil {
+		return nil, err
+	}
+	doc.SetProject(a.project)
+	return doc, nil
+}
+
+// args marks the errors of a positional argument check as usage errors.
+func args(check cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := check(cmd, args); err != nil {
+			return &exitError{code: exitUsage, err: err}
+		}
+		return nil
+	}
+}
+
+// completeContainers completes the names of the containers of the config.
+func completeContainers(a *app) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+		log.SetOutput(io.Discard)
+		conf, err := a.loadConfig()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		var names []string
+		for _, name := range conf.Names() {
+			if !slices.Contains(args, name) {
+				names = append(names, name)
+			}
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
@@ -0,0 +1,781 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadCompose translates the services of a Compose v3 / Compose Spec file into
+// container configs. Keys Infra has no equivalent for are reported as warnings
+// instead of being dropped silently.
+func LoadCompose(path string) (*UltimateConfig, []string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve compose path %s: %w", path, err)
+	}
+
+	file, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+
+	conf, warnings, err := decodeCompose(file, abs)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	ulti, err := newUltimateConfig(&stackFile{Containers: conf})
+	return ulti, warnings, err
+}
+
+// composeTopLevel are the top level keys handled by the importer, networks and
+// volumes are created by Docker on demand.
+var composeTopLevel = []string{"version", "name", "services", "networks", "volumes"}
+
+func decodeCompose(file []byte, path string) ([]*ContainerConfig, []string, error) {
+	var doc struct {
+		Services map[string]map[string]yaml.Node `yaml:"services"`
+		Rest     map[string]yaml.Node            `yaml:",inline"`
+	}
+	if err := yaml.Unmarshal(file, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal compose file %s: %w", path, err)
+	}
+
+	var warnings []string
+	for key := range doc.Rest {
+		if !slices.Contains(composeTopLevel, key) {
+			warnings = append(warnings, fmt.Sprintf("top level key %q is not supported", key))
+		}
+	}
+
+	names := make([]string, 0, len(doc.Services))
+	for name := range doc.Services {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	slices.Sort(warnings)
+
+	dir := filepath.Dir(path)
+	conf := make([]*ContainerConfig, 0, len(names))
+	for _, name := range names {
+		c, w, err := composeService(name, doc.Services[name], dir)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("%s: service %s: %w", path, name, err)
+		}
+		c.Source = path
+		for _, msg := range w {
+			warnings = append(warnings, fmt.Sprintf("service %s: %s", name, msg))
+		}
+		conf = append(conf, c)
+	}
+	return conf, warnings, nil
+}
+
+func composeService(name string, svc map[string]yaml.Node, dir string) (*ContainerConfig, []string, error) {
+	c := &ContainerConfig{
+		Name:             name,
+		ContainerService: Other,
+		EnvVars:          make(map[string]string),
+	}
+
+	keys := make([]string, 0, len(svc))
+	for key := range svc {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	// deploy.resources take precedence over the service level resource keys
+	if i := slices.Index(keys, "deploy"); i >= 0 {
+		keys = append(slices.Delete(keys, i, i+1), "deploy")
+	}
+
+	var (
+		warnings []string
+		fileEnv  = make(map[string]string)
+	)
+	warnf := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	for _, key := range keys {
+		node := svc[key]
+		var err error
+
+		for _, v := range composeVariables(&node) {
+			warnf("%s: variable interpolation %s is not supported, the value is used as it is", key, v)
+		}
+		unescapeDollars(&node)
+
+		switch key {
+		case "image":
+			err = node.Decode(&c.Image)
+		case "build":
+			err = composeBuild(&node, c, warnf)
+			resolveBuildContext(dir, c.Build)
+		case "pull_policy":
+			var policy string
+			if err = node.Decode(&policy); err == nil {
+				if policy == "build" {
+					warnf("pull_policy build is not supported")
+					break
+				}
+				c.PullPolicy, err = ParsePullPolicy(policy)
+			}
+		case "hostname":
+			err = node.Decode(&c.Hostname)
+		case "working_dir":
+			err = node.Decode(&c.WorkingDir)
+		case "network_mode":
+			err = node.Decode(&c.NetworkMode)
+		case "command":
+			c.Cmd, err = composeCommand(&node)
+		case "entrypoint":
+			c.Entrypoint, err = composeCommand(&node)
+		case "user":
+			err = node.Decode(&c.User)
+		case "labels":
+			c.Labels, err = composeMapping(&node)
+		case "stop_signal":
+			err = node.Decode(&c.StopSignal)
+		case "stop_grace_period":
+			err = node.Decode(&c.StopTimeout)
+		case "tty":
+			err = node.Decode(&c.Tty)
+		case "cap_add":
+			err = node.Decode(&c.CapAdd)
+		case "cap_drop":
+			err = node.Decode(&c.CapDrop)
+		case "privileged":
+			err = node.Decode(&c.Privileged)
+		case "read_only":
+			err = node.Decode(&c.ReadOnly)
+		case "security_opt":
+			err = node.Decode(&c.SecurityOpt)
+		case "sysctls":
+			c.Sysctls, err = composeMapping(&node)
+		case "devices":
+			err = composeDevices(&node, c, warnf)
+		case "dns":
+			c.DNS, err = stringOrList(&node)
+		case "dns_search":
+			c.DNSSearch, err = stringOrList(&node)
+		case "extra_hosts":
+			err = composeExtraHosts(&node, c)
+		case "init":
+			err = node.Decode(&c.Init)
+		case "logging":
+			c.Logging = &LoggingConfig{}
+			err = node.Decode(c.Logging)
+		case "environment":
+			err = composeEnvironment(&node, c.EnvVars)
+		case "env_file":
+			var files []string
+			if files, err = stringOrList(&node); err == nil {
+				for _, f := range files {
+					if !filepath.IsAbs(f) {
+						f = filepath.Join(dir, f)
+					}
+					if err = readEnvFile(f, fileEnv); err != nil {
+						break
+					}
+				}
+			}
+		case "ports":
+			err = composePorts(&node, c, warnf)
+		case "volumes":
+			err = composeVolumes(&node, c, warnf)
+			c.Volumes = resolveVolumes(dir, c.Volumes)
+		case "networks":
+			err = composeNetworks(&node, c, warnf)
+		case "restart":
+			var restart string
+			if err = node.Decode(&restart); err == nil {
+				policy, retries, _ := strings.Cut(restart, ":")
+				c.RestartPolicy = policy
+				if retries != "" {
+					warnf("restart retry count %s is not supported", retries)
+				}
+			}
+		case "healthcheck":
+			err = composeHealthCheck(&node, c, warnf)
+		case "depends_on":
+			err = composeDependsOn(&node, c, warnf)
+		case "deploy":
+			err = composeDeploy(&node, c, warnf)
+		default:
+			var ok bool
+			if ok, err = composeResource(key, &node, c); !ok {
+				warnf("key %q is not supported", key)
+			}
+		}
+
+		if err != nil {
+			return nil, warnings, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	// environment wins over env_file
+	for k, v := range fileEnv {
+		if _, ok := c.EnvVars[k]; !ok {
+			c.EnvVars[k] = v
+		}
+	}
+
+	if c.Image == "" && c.Build == nil {
+		warnf("no image and no build section")
+	}
+	return c, warnings, nil
+}
+
+// composeVariable matches the $VAR and ${VAR...} interpolations of compose,
+// $$ escapes a dollar sign.
+var composeVariable = regexp.MustCompile(`\$(\$|\{[^}]*\}|[A-Za-z_][A-Za-z0-9_]*)`)
+
+// composeVariables returns the variables interpolated in the scalars of node,
+// in order of appearance. Secret references of Infra are not variables.
+func composeVariables(node *yaml.Node) []string {
+	var vars []string
+	if node.Kind == yaml.ScalarNode {
+		for _, m := range composeVariable.FindAllString(node.Value, -1) {
+			if m != "$$" && !strings.HasPrefix(m, "${secret:") && !slices.Contains(vars, m) {
+				vars = append(vars, m)
+			}
+		}
+		return vars
+	}
+	for _, child := range node.Content {
+		for _, v := range composeVariables(child) {
+			if !slices.Contains(vars, v) {
+				vars = append(vars, v)
+			}
+		}
+	}
+	return vars
+}
+
+// unescapeDollars replaces the $$ escapes in the scalars of node by $.
+func unescapeDollars(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		node.Value = composeVariable.ReplaceAllStringFunc(node.Value, func(m string) string {
+			if m == "$$" {
+				return "$"
+			}
+			return m
+		})
+		return
+	}
+	for _, child := range node.Content {
+		unescapeDollars(child)
+	}
+}
+
+func stringOrList(node *yaml.Node) ([]string, error) {
+	if node.Kind == yaml.ScalarNode {
+		return []string{node.Value}, nil
+	}
+	var res []string
+	err := node.Decode(&res)
+	return res, err
+}
+
+func composeCommand(node *yaml.Node) ([]string, error) {
+	if node.Kind == yaml.ScalarNode {
+		return splitCommand(node.Value)
+	}
+	var res []string
+	err := node.Decode(&res)
+	return res, err
+}
+
+// splitCommand splits a command string like a POSIX shell would, honoring
+// single and double quotes and backslash escapes.
+func splitCommand(s string) ([]string, error) {
+	var (
+		res     []string
+		cur     strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				res = append(res, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		res = append(res, cur.String())
+	}
+	return res, nil
+}
+
+func composeEnvironment(node *yaml.Node, env map[string]string) error {
+	if node.Kind == yaml.MappingNode {
+		var m map[string]*string
+		if err := node.Decode(&m); err != nil {
+			return err
+		}
+		for k, v := range m {
+			if v == nil {
+				env[k] = os.Getenv(k)
+				continue
+			}
+			env[k] = *v
+		}
+		return nil
+	}
+
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	for _, kv := range list {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			v = os.Getenv(k)
+		}
+		env[k] = v
+	}
+	return nil
+}
+
+// readEnvFile reads KEY=VALUE lines, skipping blank lines and comments.
+func readEnvFile(path string, env map[string]string) error {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read env file: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(file))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, _ := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if unquoted, err := strconv.Unquote(v); err == nil {
+			v = unquoted
+		} else if len(v) > 1 && v[0] == '\'' && v[len(v)-1] == '\'' {
+			v = v[1 : len(v)-1]
+		}
+		env[strings.TrimSpace(k)] = v
+	}
+	return scanner.Err()
+}
+
+// composeMapping decodes a mapping or a list of KEY=VALUE entries, as used
+// by labels and sysctls.
+func composeMapping(node *yaml.Node) (map[string]string, error) {
+	res := make(map[string]string)
+	if node.Kind == yaml.MappingNode {
+		err := node.Decode(&res)
+		return res, err
+	}
+
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return nil, err
+	}
+	for _, kv := range list {
+		k, v, _ := strings.Cut(kv, "=")
+		res[k] = v
+	}
+	return res, nil
+}
+
+// composeBuild decodes a build context path or a build mapping.
+func composeBuild(node *yaml.Node, c *ContainerConfig, warnf func(string, ...any)) error {
+	c.Build = &BuildConfig{}
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&c.Build.Context)
+	}
+
+	var build map[string]yaml.Node
+	if err := node.Decode(&build); err != nil {
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(build)) {
+		value := build[key]
+		var err error
+		switch key {
+		case "context":
+			err = value.Decode(&c.Build.Context)
+		case "dockerfile":
+			err = value.Decode(&c.Build.Dockerfile)
+		case "args":
+			c.Build.Args, err = composeMapping(&value)
+		case "target":
+			err = value.Decode(&c.Build.Target)
+		case "labels":
+			c.Build.Labels, err = composeMapping(&value)
+		case "cache_from":
+			err = value.Decode(&c.Build.CacheFrom)
+		default:
+			warnf("build: key %q is not supported", key)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func composeDevices(node *yaml.Node, c *ContainerConfig, warnf func(string, ...any)) error {
+	var entries []yaml.Node
+	if err := node.Decode(&entries); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.Kind != yaml.ScalarNode {
+			warnf("devices: only host[:container[:permissions]] entries are supported")
+			continue
+		}
+		c.Devices = append(c.Devices, e.Value)
+	}
+	return nil
+}
+
+func composeExtraHosts(node *yaml.Node, c *ContainerConfig) error {
+	if node.Kind != yaml.MappingNode {
+		return node.Decode(&c.ExtraHosts)
+	}
+
+	hosts, err := composeMapping(node)
+	if err != nil {
+		return err
+	}
+	for host, ip := range hosts {
+		c.ExtraHosts = append(c.ExtraHosts, host+":"+ip)
+	}
+	slices.Sort(c.ExtraHosts)
+	return nil
+}
+
+func composePorts(node *yaml.Node, c *ContainerConfig, warnf func(string, ...any)) error {
+	var entries []yaml.Node
+	if err := node.Decode(&entries); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		var (
+			hostIP, published, target string
+			protocol                  = "tcp"
+		)
+
+		if e.Kind == yaml.MappingNode {
+			var long struct {
+				Target    string `yaml:"target"`
+				Published string `yaml:"published"`
+				Protocol  string `yaml:"protocol"`
+				HostIP    string `yaml:"host_ip"`
+			}
+			if err := e.Decode(&long); err != nil {
+				return err
+			}
+			hostIP, published, target = long.HostIP, long.Published, long.Target
+			if long.Protocol != "" {
+				protocol = long.Protocol
+			}
+		} else {
+			spec := e.Value
+			if p, proto, ok := strings.Cut(spec, "/"); ok {
+				spec, protocol = p, proto
+			}
+			parts := strings.Split(spec, ":")
+			switch len(parts) {
+			case 1:
+				target = parts[0]
+			case 2:
+				published, target = parts[0], parts[1]
+			default:
+				// the host IP may be an IPv6 address, bracketed or not
+				n := len(parts)
+				hostIP, published, target = strings.Join(parts[:n-2], ":"), parts[n-2], parts[n-1]
+				hostIP = strings.TrimSuffix(strings.TrimPrefix(hostIP, "["), "]")
+			}
+		}
+
+		if published == "" {
+			warnf("port %s is not published, only published ports are supported", target)
+			continue
+		}
+		if strings.Contains(target, "-") {
+			warnf("port range %s is not supported", target)
+			continue
+		}
+
+		port := published + ":" + target
+		if hostIP != "" {
+			if strings.Contains(hostIP, ":") {
+				hostIP = "[" + hostIP + "]"
+			}
+			port = hostIP + ":" + port
+		}
+		if protocol != "tcp" {
+			port += "/" + protocol
+		}
+		c.Ports = append(c.Ports, port)
+	}
+	return nil
+}
+
+func composeVolumes(node *yaml.Node, c *ContainerConfig, warnf func(string, ...any)) error {
+	var entries []yaml.Node
+	if err := node.Decode(&entries); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.Kind != yaml.MappingNode {
+			if !strings.Contains(e.Value, ":") {
+				warnf("anonymous volume %s is not supported", e.Value)
+				continue
+			}
+			c.Volumes = append(c.Volumes, e.Value)
+			continue
+		}
+
+		var long struct {
+			Type     string `yaml:"type"`
+			Source   string `yaml:"source"`
+			Target   string `yaml:"target"`
+			ReadOnly bool   `yaml:"read_only"`
+		}
+		if err := e.Decode(&long); err != nil {
+			return err
+		}
+		if (long.Type != "" && long.Type != "bind" && long.Type != "volume") || long.Source == "" {
+			warnf("volume %s of type %q is not supported", long.Target, long.Type)
+			continue
+		}
+
+		volume := long.Source + ":" + long.Target
+		if long.ReadOnly {
+			volume += ":ro"
+		}
+		c.Volumes = append(c.Volumes, volume)
+	}
+	return nil
+}
+
+func composeNetworks(node *yaml.Node, c *ContainerConfig, warnf func(string, ...any)) error {
+	var networks []string
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i < len(node.Content); i += 2 {
+			networks = append(networks, node.Content[i].Value)
+		}
+	} else if err := node.Decode(&networks); err != nil {
+		return err
+	}
+
+	if len(networks) == 0 {
+		return nil
+	}
+	c.NetworkID = networks[0]
+	if len(networks) > 1 {
+		warnf("only one network is supported, using %s and ignoring %v", networks[0], networks[1:])
+	}
+	return nil
+}
+
+func composeHealthCheck(node *yaml.Node, c *ContainerConfig, warnf func(string, ...any)) error {
+	var hc struct {
+		Test        yaml.Node `yaml:"test"`
+		Interval    string    `yaml:"interval"`
+		Timeout     string    `yaml:"timeout"`
+		Retries     int       `yaml:"retries"`
+		StartPeriod string    `yaml:"start_period"`
+		Disable     bool      `yaml:"disable"`
+	}
+	if err := node.Decode(&hc); err != nil {
+		return err
+	}
+
+	if hc.Disable {
+		warnf("disabled health check is dropped")
+		return nil
+	}
+
+	test := []string{}
+	switch hc.Test.Kind {
+	case yaml.ScalarNode:
+		test = []string{"CMD-SHELL", hc.Test.Value}
+	case yaml.SequenceNode:
+		if err := hc.Test.Decode(&test); err != nil {
+			return err
+		}
+	}
+
+	c.HealthCheck = HealthCheckConfig{
+		Test:        test,
+		Interval:    hc.Interval,
+		Timeout:     hc.Timeout,
+		Retries:     hc.Retries,
+		StartPeriod: hc.StartPeriod,
+	}
+	return nil
+}
+
+func composeDependsOn(node *yaml.Node, c *ContainerConfig, warnf func(string, ...any)) error {
+	if node.Kind != yaml.MappingNode {
+		return node.Decode(&c.DependsOn)
+	}
+
+	var deps map[string]struct {
+		Condition string `yaml:"condition"`
+	}
+	if err := node.Decode(&deps); err != nil {
+		return err
+	}
+	for name, dep := range deps {
+		c.DependsOn = append(c.DependsOn, name)
+		if dep.Condition != "" && dep.Condition != "service_started" {
+			warnf("depends_on %s: condition %s is not supported, waiting for start only", name, dep.Condition)
+		}
+	}
+	slices.Sort(c.DependsOn)
+	return nil
+}
+
+func composeDeploy(node *yaml.Node, c *ContainerConfig, warnf func(string, ...any)) error {
+	var deploy map[string]yaml.Node
+	if err := node.Decode(&deploy); err != nil {
+		return err
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(deploy)) {
+		value := deploy[key]
+		if key != "resources" {
+			warnf("deploy.%s is not supported", key)
+			continue
+		}
+
+		var res struct {
+			// only the keys of the block override the service level keys
+			Limits struct {
+				CPUs   *string `yaml:"cpus"`
+				Memory *string `yaml:"memory"`
+				Pids   *int64  `yaml:"pids"`
+			} `yaml:"limits"`
+			Reservations struct {
+				CPUs    string  `yaml:"cpus"`
+				Memory  *string `yaml:"memory"`
+				Devices any     `yaml:"devices"`
+			} `yaml:"reservations"`
+		}
+		if err := value.Decode(&res); err != nil {
+			return err
+		}
+
+		r := composeResources(c)
+		// the service level keys were read before, report the ones overridden
+		override := func(key, value, serviceKey, serviceValue string) {
+			if serviceValue != "" && serviceValue != value {
+				warnf("deploy.resources.%s %s overrides %s %s", key, value, serviceKey, serviceValue)
+			}
+		}
+		if res.Limits.CPUs != nil {
+			override("limits.cpus", *res.Limits.CPUs, "cpus", r.CPUs)
+			r.CPUs = *res.Limits.CPUs
+		}
+		if res.Limits.Memory != nil {
+			override("limits.memory", *res.Limits.Memory, "mem_limit", r.Memory)
+			r.Memory = *res.Limits.Memory
+		}
+		if res.Limits.Pids != nil {
+			if r.PidsLimit != nil {
+				override("limits.pids", strconv.FormatInt(*res.Limits.Pids, 10), "pids_limit", strconv.FormatInt(*r.PidsLimit, 10))
+			}
+			r.PidsLimit = res.Limits.Pids
+		}
+		if res.Reservations.Memory != nil {
+			override("reservations.memory", *res.Reservations.Memory, "mem_reservation", r.MemoryReservation)
+			r.MemoryReservation = *res.Reservations.Memory
+		}
+		if res.Reservations.CPUs != "" {
+			// a CPU reservation is a share of the CPU time, 1024 shares per CPU
+			nano, err := ParseCPUs(res.Reservations.CPUs)
+			if err != nil {
+				return fmt.Errorf("deploy.resources.reservations: %w", err)
+			}
+			if r.CPUShares != 0 {
+				warnf("deploy.resources.reservations.cpus %s overrides cpu_shares %d", res.Reservations.CPUs, r.CPUShares)
+			}
+			r.CPUShares = max(nano*1024/1e9, 2)
+		}
+		if res.Reservations.Devices != nil {
+			warnf("deploy.resources.reservations.devices is not supported")
+		}
+	}
+	return nil
+}
+
+// composeResource maps the service level resource keys (cpus, mem_limit, ...)
+// onto the resources of c, it reports whether key is one of them.
+func composeResource(key string, node *yaml.Node, c *ContainerConfig) (bool, error) {
+	var target any
+	switch key {
+	case "cpus":
+		target = &composeResources(c).CPUs
+	case "cpu_shares":
+		target = &composeResources(c).CPUShares
+	case "cpuset":
+		target = &composeResources(c).CPUSet
+	case "mem_limit":
+		target = &composeResources(c).Memory
+	case "mem_reservation":
+		target = &composeResources(c).MemoryReservation
+	case "memswap_limit":
+		target = &composeResources(c).MemorySwap
+	case "pids_limit":
+		target = &composeResources(c).PidsLimit
+	case "shm_size":
+		target = &composeResources(c).ShmSize
+	case "ulimits":
+		target = &composeResources(c).Ulimits
+	default:
+		return false, nil
+	}
+	return true, node.Decode(target)
+}
+
+func composeResources(c *ContainerConfig) *ResourceConfig {
+	if c.Resources == nil {
+		c.Resources = &ResourceConfig{}
+	}
+	return c.Resources
+}
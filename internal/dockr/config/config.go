@@ -2,12 +2,12 @@ package config
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/strslice"
 	"github.com/docker/go-connections/nat"
+	"gopkg.in/yaml.v3"
 )
 
 var _ ContainerConfiguration = &ContainerConfig{}
@@ -20,12 +20,36 @@ type ContainerConfiguration interface {
 	GetWorkingDir() string
 	GetHostname() string
 	GetDefault() bool
+	GetName() string
+	GetEnabled() bool
+	GetSource() string
 	GetService() string
 	GetPorts() nat.PortMap
 	GetEnvVars() []string
 	GetImage() string
+	GetPullPolicy() string
+	GetRegistryAuth() *RegistryAuthConfig
+	GetBuild() *BuildConfig
 	GetNetworkMode() container.NetworkMode
 	GetLoadLevel() int 
+	GetEntrypoint() strslice.StrSlice
+	GetUser() string
+	GetLabels() map[string]string
+	GetStopSignal() string
+	GetStopTimeout() *int
+	GetTty() bool
+	GetCapAdd() strslice.StrSlice
+	GetCapDrop() strslice.StrSlice
+	GetPrivileged() bool
+	GetReadOnly() bool
+	GetSecurityOpt() []string
+	GetSysctls() map[string]string
+	GetDevices() []container.DeviceMapping
+	GetDNS() []string
+	GetDNSSearch() []string
+	GetExtraHosts() []string
+	GetInit() *bool
+	GetLogConfig() container.LogConfig
 	
 	GetFull() *ContainerConfig 
 	
@@ -39,29 +63,105 @@ type ContainerConfiguration interface {
 // ContainerConfig represents the full configuration for a Docker container.
 // It is unified for all services.
 type ContainerConfig struct {
-	// If IsDefault == true, configuration will be created with default values.
-	LoadLevel int `yaml:"load_level" json:"load_level"`
-	IsDefault     bool   `yaml:"is_default" json:"is_default"`  // Indicates whether to use default values for this configuration.
-	ContainerService string `yaml:"container_service" json:"container_service"` // Type of the container (e.g., "web", "db", etc.).
+	Name          string `yaml:"name,omitempty" json:"name,omitempty"` // Unique name of the container, defaults to ContainerService.
+	Enabled       *bool  `yaml:"enabled,omitempty" json:"enabled,omitempty"` // Set to false to leave the container out (e.g. in a profile overlay).
+	Replicas      int    `yaml:"replicas,omitempty" json:"replicas,omitempty"` // Number of containers run from this config, named name, name_2, ... (default 1).
+	Source        string `yaml:"-" json:"-"` // Config file the container was loaded from, empty for configs built in code.
+	keys          map[string]bool // Keys set in the file the config was decoded from ("load_level", "health_check.retries"), see mergeConfig.
+
+	// If IsDefault == true, configuration will be merged over the matching preset (see MergeDefaults).
+	LoadLevel int `yaml:"load_level,omitempty" json:"load_level,omitempty"`
+	IsDefault     bool   `yaml:"is_default,omitempty" json:"is_default,omitempty"`  // Indicates whether to use default values for this configuration.
+	Preset        string `yaml:"preset,omitempty" json:"preset,omitempty"` // Name of the preset to merge this configuration over (e.g. "postgres").
+	ListMerge     string `yaml:"list_merge,omitempty" json:"list_merge,omitempty"` // How lists are merged over the preset: "replace" (default) or "append".
+	ContainerService string `yaml:"container_service,omitempty" json:"container_service,omitempty"` // Type of the container (e.g., "web", "db", etc.).
 
 	// Docker &container.Config{}
-	Image         string            `yaml:"image" json:"image"`         // The image to use for the container.
-	Hostname     string            `yaml:"hostname" json:"hostname"` // The hostname to use for the container.
-	EnvVars       map[string]string `yaml:"env_vars" json:"env_vars"`   // Environment variables to set in the container.
-	WorkingDir    string            `yaml:"working_dir" json:"working_dir"` // The working directory for commands to run in.
-	Cmd []string `yaml:"cmd" json:"cmd"` // Command to run in the container on startup.
+	Image         string            `yaml:"image,omitempty" json:"image,omitempty"`         // The image to use for the container.
+	PullPolicy    string            `yaml:"pull_policy,omitempty" json:"pull_policy,omitempty"` // When the image is pulled: "always", "if-not-present" or "never".
+	RegistryAuth  *RegistryAuthConfig `yaml:"registry_auth,omitempty" json:"registry_auth,omitempty"` // Credentials for pulling the image, overriding the state store and docker config.
+	Build         *BuildConfig      `yaml:"build,omitempty" json:"build,omitempty"` // Builds the image from a local Dockerfile instead of pulling it.
+	Hostname     string            `yaml:"hostname,omitempty" json:"hostname,omitempty"` // The hostname to use for the container.
+	EnvVars       map[string]string `yaml:"env_vars,omitempty" json:"env_vars,omitempty"`   // Environment variables to set in the container.
+	Credentials   []string          `yaml:"credentials,omitempty" json:"credentials,omitempty"` // Env vars generated on first deploy when IsDefault is set.
+	WorkingDir    string            `yaml:"working_dir,omitempty" json:"working_dir,omitempty"` // The working directory for commands to run in.
+	Cmd []string `yaml:"cmd,omitempty" json:"cmd,omitempty"` // Command to run in the container on startup.
+	Entrypoint    []string          `yaml:"entrypoint,omitempty" json:"entrypoint,omitempty"` // Overrides the entrypoint of the image.
+	User          string            `yaml:"user,omitempty" json:"user,omitempty"` // User and optional group to run as (e.g., "app", "1000:1000").
+	Labels        map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"` // Container labels, the "infra." prefix is reserved.
+	StopSignal    string            `yaml:"stop_signal,omitempty" json:"stop_signal,omitempty"` // Signal sent to stop the container (e.g., "SIGINT").
+	StopTimeout   string            `yaml:"stop_timeout,omitempty" json:"stop_timeout,omitempty"` // Time to wait for the container to stop before killing it (e.g., "30s").
+	Tty           bool              `yaml:"tty,omitempty" json:"tty,omitempty"` // Allocate a pseudo-TTY.
 	
 	// Docker &container.HostConfig{}
-	Volumes       []string          `yaml:"volumes" json:"volumes"`     // List of volumes to mount into the container.
-	NetworkMode   string            `yaml:"network_mode" json:"network_mode"` // The network mode for the container.
-	Ports         []string          `yaml:"ports" json:"ports"`         // List of ports to expose from the container.
-	RestartPolicy string            `yaml:"restart_policy" json:"restart_policy"` // Docker restart policy (e.g., "always", "on-failure").
+	Volumes       []string          `yaml:"volumes,omitempty" json:"volumes,omitempty"`     // List of volumes to mount into the container.
+	NetworkMode   string            `yaml:"network_mode,omitempty" json:"network_mode,omitempty"` // The network mode for the container.
+	Ports         []string          `yaml:"ports,omitempty" json:"ports,omitempty"`         // List of ports to expose from the container.
+	RestartPolicy string            `yaml:"restart_policy,omitempty" json:"restart_policy,omitempty"` // Docker restart policy (e.g., "always", "on-failure").
+	Resources     *ResourceConfig   `yaml:"resources,omitempty" json:"resources,omitempty"` // Explicit resources layered over a resource profile or the load level.
+	CapAdd        []string          `yaml:"cap_add,omitempty" json:"cap_add,omitempty"` // Linux capabilities to add (e.g., "NET_ADMIN").
+	CapDrop       []string          `yaml:"cap_drop,omitempty" json:"cap_drop,omitempty"` // Linux capabilities to drop, "ALL" for every one.
+	Privileged    bool              `yaml:"privileged,omitempty" json:"privileged,omitempty"` // Give the container full access to the host.
+	ReadOnly      bool              `yaml:"read_only,omitempty" json:"read_only,omitempty"` // Mount the root filesystem read-only.
+	SecurityOpt   []string          `yaml:"security_opt,omitempty" json:"security_opt,omitempty"` // Security options (e.g., "no-new-privileges", "seccomp=unconfined").
+	Sysctls       map[string]string `yaml:"sysctls,omitempty" json:"sysctls,omitempty"` // Namespaced kernel parameters (e.g., net.core.somaxconn).
+	Devices       []string          `yaml:"devices,omitempty" json:"devices,omitempty"` // Host devices, "/dev/snd[:/dev/snd[:rwm]]".
+	DNS           []string          `yaml:"dns,omitempty" json:"dns,omitempty"` // DNS servers.
+	DNSSearch     []string          `yaml:"dns_search,omitempty" json:"dns_search,omitempty"` // DNS search domains.
+	ExtraHosts    []string          `yaml:"extra_hosts,omitempty" json:"extra_hosts,omitempty"` // Additional /etc/hosts entries, "host:ip".
+	Init          *bool             `yaml:"init,omitempty" json:"init,omitempty"` // Run an init process that forwards signals and reaps processes.
+	Logging       *LoggingConfig    `yaml:"logging,omitempty" json:"logging,omitempty"` // Logging driver and its options.
 	
 	// Docker &network.NetworkingConfig{}
-	NetworkID       string            `yaml:"network" json:"network"`     // The name of the network for the container.
+	NetworkID       string            `yaml:"network,omitempty" json:"network,omitempty"`     // The name of the network for the container.
+
+	DependsOn       []string          `yaml:"depends_on,omitempty" json:"depends_on,omitempty"` // Names of containers to start before this one.
 
 	// HealthCheck configuration for Docker health check (ping of server every 5 minutes, or similar).
-	HealthCheck HealthCheckConfig `yaml:"health_check" json:"health_check"`
+	HealthCheck HealthCheckConfig `yaml:"health_check,omitempty" json:"health_check,omitempty"`
+}
+
+// UnmarshalYAML decodes a container and records the keys it sets, so merging
+// it can tell a key set to its zero value (load_level: 0) from a missing one.
+func (c *ContainerConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain ContainerConfig
+	if err := node.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	c.keys = make(map[string]bool)
+	recordKeys(node, "", c.keys)
+	return nil
+}
+
+// recordKeys adds the keys of a mapping node and of its nested mappings to
+// keys, nested keys joined with dots.
+func recordKeys(node *yaml.Node, prefix string, keys map[string]bool) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := prefix + node.Content[i].Value
+		keys[key] = true
+		recordKeys(node.Content[i+1], key+".", keys)
+	}
+}
+
+func (c *ContainerConfig) GetName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.ContainerService
+}
+
+func (c *ContainerConfig) GetSource() string {
+	return c.Source
+}
+
+func (c *ContainerConfig) GetEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
 }
 
 func (c *ContainerConfig) GetLoadLevel() int {
@@ -124,8 +224,20 @@ func (c *ContainerConfig) GetImage() string {
 	return c.Image
 }
 
+func (c *ContainerConfig) GetPullPolicy() string {
+	return c.PullPolicy
+}
+
+func (c *ContainerConfig) GetRegistryAuth() *RegistryAuthConfig {
+	return c.RegistryAuth
+}
+
+func (c *ContainerConfig) GetBuild() *BuildConfig {
+	return c.Build
+}
+
 func (c *ContainerConfig) GetEnvVars() []string {
-	env := make([]string, len(c.EnvVars))
+	env := make([]string, 0, len(c.EnvVars))
 	for key, value := range c.EnvVars {
 		env = append(env, fmt.Sprintf("%s=%s", key, value))
 	}
@@ -133,34 +245,150 @@ func (c *ContainerConfig) GetEnvVars() []string {
 }
 
 
+// GetPorts returns the bindings of the published ports, written as
+// "[ip:]host:container[/protocol]" (see nat.ParsePortSpecs). Ports are checked
+// when the config is loaded, invalid entries result in no bindings.
 func (c *ContainerConfig) GetPorts() nat.PortMap {
-	portBind := make(nat.PortMap)
-	for _, portMapping := range c.Ports {
-		parts := strings.Split(portMapping, ":")
-		if len(parts) == 2 {
-			hostPort := parts[0]
-			containerPort := fmt.Sprintf("%s/tcp", parts[1])
-			portBind[nat.Port(containerPort)] = []nat.PortBinding{
-				{HostPort: hostPort},
-				{HostIP: "0.0.0.0"},
-			}
-		}
+	_, bindings, err := nat.ParsePortSpecs(c.Ports)
+	if err != nil {
+		return nat.PortMap{}
 	}
-	return portBind
+	return bindings
 }
 
 func (c *ContainerConfig) GetNetworkMode() container.NetworkMode {
 	return container.NetworkMode(c.NetworkMode)
 }
 
+// RegistryAuthConfig holds the credentials of the registry an image is pulled
+// from. Values may be ${secret:<container>.<KEY>} references.
+type RegistryAuthConfig struct {
+	Username      string `yaml:"username,omitempty" json:"username,omitempty"` // Registry user name.
+	Password      string `yaml:"password,omitempty" json:"password,omitempty"` // Password or access token of the user.
+	IdentityToken string `yaml:"identity_token,omitempty" json:"identity_token,omitempty"` // OAuth refresh token, used instead of username and password.
+}
+
+// BuildConfig builds the image of a container from a Dockerfile, the result
+// is tagged with the image of the container.
+type BuildConfig struct {
+	Context    string            `yaml:"context,omitempty" json:"context,omitempty"` // Directory sent to the daemon, relative to the config file.
+	Dockerfile string            `yaml:"dockerfile,omitempty" json:"dockerfile,omitempty"` // Dockerfile path in the context, defaults to "Dockerfile".
+	Args       map[string]string `yaml:"args,omitempty" json:"args,omitempty"` // Build arguments (ARG) of the Dockerfile.
+	Target     string            `yaml:"target,omitempty" json:"target,omitempty"` // Stage of a multi-stage Dockerfile to build.
+	Labels     map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"` // Labels of the built image.
+	CacheFrom  []string          `yaml:"cache_from,omitempty" json:"cache_from,omitempty"` // Images used as cache sources.
+}
+
+// LoggingConfig selects the logging driver of a container.
+type LoggingConfig struct {
+	Driver  string            `yaml:"driver,omitempty" json:"driver,omitempty"` // Logging driver (e.g., "json-file", "journald").
+	Options map[string]string `yaml:"options,omitempty" json:"options,omitempty"` // Driver options (e.g., max-size: "10m").
+}
+
+//------------------- RUNTIME ------------------------
+
+func (c *ContainerConfig) GetEntrypoint() strslice.StrSlice {
+	return strslice.StrSlice(c.Entrypoint)
+}
+
+func (c *ContainerConfig) GetUser() string {
+	return c.User
+}
+
+func (c *ContainerConfig) GetLabels() map[string]string {
+	return c.Labels
+}
+
+func (c *ContainerConfig) GetStopSignal() string {
+	return c.StopSignal
+}
+
+// GetStopTimeout returns the stop timeout in seconds, nil when unset.
+func (c *ContainerConfig) GetStopTimeout() *int {
+	if c.StopTimeout == "" {
+		return nil
+	}
+	timeout, _ := time.ParseDuration(c.StopTimeout)
+	seconds := int(timeout.Round(time.Second) / time.Second)
+	return &seconds
+}
+
+func (c *ContainerConfig) GetTty() bool {
+	return c.Tty
+}
+
+func (c *ContainerConfig) GetCapAdd() strslice.StrSlice {
+	return strslice.StrSlice(c.CapAdd)
+}
+
+func (c *ContainerConfig) GetCapDrop() strslice.StrSlice {
+	return strslice.StrSlice(c.CapDrop)
+}
+
+func (c *ContainerConfig) GetPrivileged() bool {
+	return c.Privileged
+}
+
+func (c *ContainerConfig) GetReadOnly() bool {
+	return c.ReadOnly
+}
+
+func (c *ContainerConfig) GetSecurityOpt() []string {
+	return c.SecurityOpt
+}
+
+func (c *ContainerConfig) GetSysctls() map[string]string {
+	return c.Sysctls
+}
+
+// GetDevices returns the device mappings, a device without a container path
+// is mapped to the same path and gets rwm permissions.
+func (c *ContainerConfig) GetDevices() []container.DeviceMapping {
+	devices := make([]container.DeviceMapping, 0, len(c.Devices))
+	for _, d := range c.Devices {
+		device, _ := parseDevice(d)
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+func (c *ContainerConfig) GetDNS() []string {
+	return c.DNS
+}
+
+func (c *ContainerConfig) GetDNSSearch() []string {
+	return c.DNSSearch
+}
+
+// GetExtraHosts returns the extra hosts as Docker expects them, "host:ip".
+func (c *ContainerConfig) GetExtraHosts() []string {
+	hosts := make([]string, 0, len(c.ExtraHosts))
+	for _, h := range c.ExtraHosts {
+		host, ip, _ := parseExtraHost(h)
+		hosts = append(hosts, host+":"+ip)
+	}
+	return hosts
+}
+
+func (c *ContainerConfig) GetInit() *bool {
+	return c.Init
+}
+
+func (c *ContainerConfig) GetLogConfig() container.LogConfig {
+	if c.Logging == nil {
+		return container.LogConfig{}
+	}
+	return container.LogConfig{Type: c.Logging.Driver, Config: c.Logging.Options}
+}
+
 // HealthCheckConfig defines the configuration for Docker container health checks.
 type HealthCheckConfig struct {
 	// Test command to perform health check.
-	Test        []string `yaml:"test" json:"test"` // Command for checking health.
-	Interval    string   `yaml:"interval" json:"interval"` // Time between checks (e.g., "30s").
-	Timeout     string   `yaml:"timeout" json:"timeout"` // Timeout for health check (e.g., "5s").
-	Retries     int      `yaml:"retries" json:"retries"` // Number of retries before considering the container unhealthy.
-	StartPeriod string   `yaml:"start_period" json:"start_period"` // Initial delay before the first health check (e.g., "10s").
+	Test        []string `yaml:"test,omitempty" json:"test,omitempty"` // Command for checking health.
+	Interval    string   `yaml:"interval,omitempty" json:"interval,omitempty"` // Time between checks (e.g., "30s").
+	Timeout     string   `yaml:"timeout,omitempty" json:"timeout,omitempty"` // Timeout for health check (e.g., "5s").
+	Retries     int      `yaml:"retries,omitempty" json:"retries,omitempty"` // Number of retries before considering the container unhealthy.
+	StartPeriod string   `yaml:"start_period,omitempty" json:"start_period,omitempty"` // Initial delay before the first health check (e.g., "10s").
 }
 
 //------------------- HEALTH CHECK ------------------------
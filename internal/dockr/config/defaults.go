@@ -13,10 +13,9 @@ var PostgresConfig = ContainerConfig{
 		Image:            "postgres:latest",
 		Hostname:         "postgres-db",
 		EnvVars: map[string]string{
-			"POSTGRES_USER":     "admin",
-			"POSTGRES_PASSWORD": "securepassword",
 			"POSTGRES_DB":       "exampledb",
 		},
+		Credentials:   []string{"POSTGRES_USER", "POSTGRES_PASSWORD"},
 		WorkingDir:    "/var/lib/postgresql/data",
 		Cmd:           []string{"postgres"},
 		Volumes:       []string{"/host/data/postgres:/var/lib/postgresql/data"},
@@ -29,7 +28,7 @@ var PostgresConfig = ContainerConfig{
 			Timeout:     "10s",
 			StartPeriod: "10s",
 			Retries:     3,
-			Test:        []string{"CMD", "pg_isready", "-U", "admin"},
+			Test:        []string{"CMD-SHELL", "pg_isready -U \"$POSTGRES_USER\""},
 		},
 	}
 
@@ -39,10 +38,8 @@ var PostgresConfig = ContainerConfig{
 			ContainerService: "DB",
 			Image:            "mongo:latest",
 			Hostname:         "mongo-db",
-			EnvVars: map[string]string{
-				"MONGO_INITDB_ROOT_USERNAME": "admin",
-				"MONGO_INITDB_ROOT_PASSWORD": "securepassword",
-			},
+			EnvVars:          map[string]string{},
+			Credentials:      []string{"MONGO_INITDB_ROOT_USERNAME", "MONGO_INITDB_ROOT_PASSWORD"},
 			WorkingDir:    "/data/db",
 			Cmd:           []string{"mongod"},
 			Volumes:       []string{"/host/data/mongo:/data/db"},
@@ -144,6 +141,7 @@ var	RedisConfig = ContainerConfig{
 					"MUMBLE_PORT":    "64738",
 					"MUMBLE_MAXUSERS": "100",
 				},
+				Credentials:   []string{"MUMBLE_SUPERUSER_PASSWORD"},
 				WorkingDir:    "/etc/mumble",
 				Cmd:           []string{"murmurd", "-ini", "/etc/mumble/mumble.ini"},
 				Volumes:       []string{"/host/config/mumble:/etc/mumble"},
@@ -169,6 +167,7 @@ var	RedisConfig = ContainerConfig{
 				EnvVars: map[string]string{
 					"TS3SERVER_LICENSE": "accept",
 				},
+				Credentials:   []string{"TS3SERVER_SERVERADMIN_PASSWORD"},
 				WorkingDir:    "/var/ts3server",
 				Cmd:           []string{"ts3server"},
 				Volumes:       []string{"/host/config/ts3server:/var/ts3server"},
@@ -192,8 +191,14 @@ var	RedisConfig = ContainerConfig{
 				ContainerService: "Server_add",
 				Image:            "kong:latest",
 				Hostname:         "api-gateway",
+				// the gateway stores its config in the postgres preset, with the
+				// credentials generated for it
 				EnvVars: map[string]string{
-					"KONG_DATABASE":  "off",
+					"KONG_DATABASE":     "postgres",
+					"KONG_PG_HOST":      "postgres-db",
+					"KONG_PG_DATABASE":  "exampledb",
+					"KONG_PG_USER":      "${secret:DB.POSTGRES_USER}",
+					"KONG_PG_PASSWORD":  "${secret:DB.POSTGRES_PASSWORD}",
 					"KONG_PROXY_LISTEN": "0.0.0.0:8000",
 				},
 				WorkingDir:    "",
@@ -240,20 +245,17 @@ var	RedisConfig = ContainerConfig{
 
 // DEFAULT RESOURCES #############################################################################
 
+// The load level presets only use settings every cgroup version supports. The
+// CPU limit is set as NanoCPUs alone, the daemon rejects it when a CFS quota is
+// set too, and the PIDs and OOM killer defaults of the daemon are kept.
+
 var HighLoadConfig = container.Resources{
     CPUShares:          1024,    // Higher CPU share for more processing power
     Memory:             4 * 1024 * 1024 * 1024,  // 4GB of memory
     NanoCPUs:           2000000000,  // 2 CPUs in nano units
-    CPUPeriod:          100000,  // High CPU period
-    CPUQuota:           200000,  // High CPU quota
     MemoryReservation:  2 * 1024 * 1024 * 1024,  // 2GB reserved memory
     MemorySwap:         4 * 1024 * 1024 * 1024,  // Total of 4GB memory + swap
-    KernelMemory:       2 * 1024 * 1024 * 1024,  // 2GB kernel memory
     BlkioWeight:        1000,    // High block IO weight
-    CPURealtimePeriod:  100000,  // Real-time CPU period
-    CPURealtimeRuntime: 100000,  // Real-time CPU runtime
-    OomKillDisable:     new(bool), // Disable OOM Killer
-    PidsLimit:          new(int64), // Unlimited PIDs
 }
 
 
@@ -261,44 +263,51 @@ var MediumLoadConfig = container.Resources{
     CPUShares:          512,     // Moderate CPU share
     Memory:             2 * 1024 * 1024 * 1024,  // 2GB memory
     NanoCPUs:           1000000000,  // 1 CPU in nano units
-    CPUPeriod:          100000,  // Moderate CPU period
-    CPUQuota:           100000,  // Moderate CPU quota
     MemoryReservation:  1 * 1024 * 1024 * 1024,  // 1GB reserved memory
     MemorySwap:         2 * 1024 * 1024 * 1024,  // Total of 2GB memory + swap
-    KernelMemory:       1 * 1024 * 1024 * 1024,  // 1GB kernel memory
     BlkioWeight:        500,     // Moderate block IO weight
-    CPURealtimePeriod:  100000,  // Real-time CPU period
-    CPURealtimeRuntime: 100000,  // Real-time CPU runtime
-    OomKillDisable:     nil,     // Default OOM Killer behavior
-    PidsLimit:          new(int64), // Unlimited PIDs
 }
 
 var LowLoadConfig = container.Resources{
     CPUShares:          256,     // Lower CPU share
     Memory:             1 * 1024 * 1024 * 1024,  // 1GB memory
     NanoCPUs:           500000000,  // 0.5 CPU in nano units
-    CPUPeriod:          100000,  // Lower CPU period
-    CPUQuota:           50000,   // Lower CPU quota
     MemoryReservation:  512 * 1024 * 1024,  // 512MB reserved memory
     MemorySwap:         1 * 1024 * 1024 * 1024,  // Total of 1GB memory + swap
-    KernelMemory:       512 * 1024 * 1024,  // 512MB kernel memory
     BlkioWeight:        300,     // Lower block IO weight
-    CPURealtimePeriod:  100000,  // Real-time CPU period
-    CPURealtimeRuntime: 50000,   // Real-time CPU runtime
-    OomKillDisable:     nil,     // Default OOM Killer behavior
-    PidsLimit:          new(int64), // Unlimited PIDs
 }
 
-func randString(n int) string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	b := make([]byte, n)
-	_, err := rand.Read(b)
-	
-	if err != nil {
-		panic(err)
+// LoadLevelResources returns the resources of a load level, unknown levels
+// get the medium level.
+func LoadLevelResources(level int) container.Resources {
+	switch level {
+	case 0:
+		return LowLoadConfig
+	case 2:
+		return HighLoadConfig
 	}
-	for i, v := range b {
-		b[i] = letters[v%byte(len(letters))]
+	return MediumLoadConfig
+}
+
+// randString returns n random alphanumeric characters. Bytes that would bias
+// the distribution are rejected.
+func randString(n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	const limit = 256 - 256%len(letters)
+
+	b := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(b) < n {
+		_, err := rand.Read(buf)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range buf {
+			if int(v) >= limit || len(b) == n {
+				continue
+			}
+			b = append(b, letters[int(v)%len(letters)])
+		}
 	}
 	return string(b)
 }
@@ -0,0 +1,278 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a config file format.
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+	FormatHCL  Format = "hcl"
+)
+
+var formatExts = map[string]Format{
+	".yaml": FormatYAML,
+	".yml":  FormatYAML,
+	".json": FormatJSON,
+	".toml": FormatTOML,
+	".hcl":  FormatHCL,
+}
+
+// ParseFormat returns the format named s ("yaml", "yml", "json", "toml", "hcl").
+func ParseFormat(s string) (Format, error) {
+	if f, ok := formatExts["."+strings.ToLower(s)]; ok {
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported config format: %s", s)
+}
+
+// FormatFromPath detects the format of a config file by its extension.
+func FormatFromPath(path string) (Format, error) {
+	ext := filepath.Ext(path)
+	if f, ok := formatExts[ext]; ok {
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported config file extension: %s", ext)
+}
+
+// decodeDocument decodes a config file into a generic document: a list of
+// containers or a mapping (stack or compose file).
+//
+// TOML and HCL have no list roots, their files are stack files with the
+// containers in [[containers]] tables and container "<name>" blocks. HCL
+// strings are templates, secret references are written as $${secret:...}.
+func decodeDocument(file []byte, format Format) (any, error) {
+	var doc any
+	switch format {
+	case FormatYAML:
+		if err := yaml.Unmarshal(file, &doc); err != nil {
+			return nil, err
+		}
+	case FormatJSON:
+		if err := json.Unmarshal(file, &doc); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		if err := toml.Unmarshal(file, &doc); err != nil {
+			return nil, err
+		}
+	case FormatHCL:
+		return decodeHCL(file)
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", format)
+	}
+	return doc, nil
+}
+
+// decodeDocumentInto decodes a generic document into v through YAML, so all
+// formats share the scalar conversions of the YAML loader (e.g. a numeric
+// env var value is read as a string).
+func decodeDocumentInto(doc any, v any) error {
+	raw, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(raw, v)
+}
+
+func decodeHCL(file []byte) (any, error) {
+	f, diags := hclsyntax.ParseConfig(file, "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	body := f.Body.(*hclsyntax.Body)
+	doc, err := hclBody(body, "container")
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]any, 0, len(body.Blocks))
+	for _, b := range body.Blocks {
+		if b.Type != "container" {
+			continue
+		}
+		if len(b.Labels) != 1 {
+			return nil, fmt.Errorf("%s: container block needs exactly one name label", b.TypeRange)
+		}
+		c, err := hclBody(b.Body, "")
+		if err != nil {
+			return nil, err
+		}
+		c["name"] = b.Labels[0]
+		containers = append(containers, c)
+	}
+	doc["containers"] = containers
+	return doc, nil
+}
+
+// hclBody converts the attributes and nested blocks of body into a mapping,
+// blocks of type skip are left to the caller.
+func hclBody(body *hclsyntax.Body, skip string) (map[string]any, error) {
+	res := make(map[string]any, len(body.Attributes)+len(body.Blocks))
+	for name, attr := range body.Attributes {
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		v, err := ctyToGo(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", attr.SrcRange, err)
+		}
+		res[name] = v
+	}
+
+	for _, b := range body.Blocks {
+		if b.Type == skip {
+			continue
+		}
+		if _, ok := res[b.Type]; ok || len(b.Labels) > 0 {
+			return nil, fmt.Errorf("%s: unexpected %s block", b.TypeRange, b.Type)
+		}
+		nested, err := hclBody(b.Body, "")
+		if err != nil {
+			return nil, err
+		}
+		res[b.Type] = nested
+	}
+	return res, nil
+}
+
+func ctyToGo(val cty.Value) (any, error) {
+	raw, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	err = json.Unmarshal(raw, &v)
+	return v, err
+}
+
+// Encode writes the configuration in format as a stack file of the current
+// version, containers sorted by name.
+func (c *UltimateConfig) Encode(format Format) ([]byte, error) {
+	stack := stackFile{Version: CurrentVersion}
+	for _, name := range c.Names() {
+		stack.Containers = append(stack.Containers, c.Containers[name].GetFull())
+	}
+
+	switch format {
+	case FormatYAML:
+		return yaml.Marshal(stack)
+	case FormatJSON:
+		return json.MarshalIndent(stack, "", "  ")
+	}
+
+	// TOML and HCL are written from the same generic document the readers
+	// produce, keys come from the json tags
+	docs := make([]any, 0, len(stack.Containers))
+	for _, cc := range stack.Containers {
+		raw, err := json.Marshal(cc)
+		if err != nil {
+			return nil, err
+		}
+		var doc map[string]any
+		if err = json.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		doc["name"] = cc.GetName()
+		docs = append(docs, doc)
+	}
+	return encodeDocument(map[string]any{"version": CurrentVersion, "containers": docs}, format)
+}
+
+// Save writes the configuration to path in the format of its extension.
+func (c *UltimateConfig) Save(path string) error {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.Encode(format)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0o644)
+}
+
+// encodeHCL writes a stack document, the top level keys as attributes and the
+// containers as container "<name>" blocks.
+func encodeHCL(doc map[string]any) ([]byte, error) {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+
+	containers, _ := doc["containers"].([]any)
+	for _, k := range sortedKeys(doc) {
+		if k == "containers" {
+			continue
+		}
+		if err := setHCLAttribute(body, k, doc[k]); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, c := range containers {
+		cont, ok := c.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("container %d is not a mapping", i)
+		}
+		if i > 0 || len(doc) > 1 {
+			body.AppendNewline()
+		}
+
+		name, _ := cont["name"].(string)
+		block := body.AppendNewBlock("container", []string{name}).Body()
+		for _, k := range sortedKeys(cont) {
+			if k == "name" {
+				continue
+			}
+			if err := setHCLAttribute(block, k, cont[k]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return f.Bytes(), nil
+}
+
+func setHCLAttribute(body *hclwrite.Body, name string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	typ, err := ctyjson.ImpliedType(raw)
+	if err != nil {
+		return err
+	}
+	val, err := ctyjson.Unmarshal(raw, typ)
+	if err != nil {
+		return err
+	}
+	body.SetAttributeValue(name, val)
+	return nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Stdin is the config path that reads the configuration from standard input.
+const Stdin = "-"
+
+// configFS is where config files and their includes are read from: the host
+// filesystem when fsys is nil, fsys otherwise. Paths of an fs.FS are slash
+// separated and relative to its root. When files is set, every file and
+// directory read is recorded in it.
+type configFS struct {
+	fsys  fs.FS
+	files map[string]struct{}
+}
+
+var hostFS = configFS{}
+
+// LoadContainersConfigReader loads a config file read from r in format.
+// Includes are resolved relative to the working directory.
+func LoadContainersConfigReader(r io.Reader, format Format) (*UltimateConfig, error) {
+	conf, err := readConfigReader(r, "<reader>", format)
+	if err != nil {
+		return nil, err
+	}
+	return newUltimateConfig(conf)
+}
+
+// LoadFS loads a config file, or config directory, of fsys (e.g. an embed.FS).
+// Includes are resolved within fsys and relative bind mounts are kept as
+// written, as there is no host directory to resolve them against.
+func LoadFS(fsys fs.FS, path string) (*UltimateConfig, error) {
+	conf, err := configFS{fsys: fsys}.readPath(path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return newUltimateConfig(conf)
+}
+
+// readConfigReader reads a config file from r, name is used as its source in
+// errors. An empty format is read as YAML.
+func readConfigReader(r io.Reader, name string, format Format) (*stackFile, error) {
+	if format == "" {
+		format = FormatYAML
+	}
+
+	file, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", name, err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve working directory: %w", err)
+	}
+	return hostFS.readConfig(file, name, wd, format, nil)
+}
+
+// readConfigFile decodes the container entries of a config file (following
+// its includes) or config directory as written, without presets merged in.
+// The path "-" reads stdin.
+func (c configFS) readConfigFile(path string, format Format) (*stackFile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("config file path is empty")
+	}
+	if path == Stdin {
+		return readConfigReader(os.Stdin, "<stdin>", format)
+	}
+	return c.readPath(path, format, nil)
+}
+
+func (c configFS) record(p string) {
+	if c.files != nil {
+		c.files[p] = struct{}{}
+	}
+}
+
+func (c configFS) abs(p string) (string, error) {
+	if c.fsys == nil {
+		return filepath.Abs(p)
+	}
+	p = path.Clean(p)
+	if !fs.ValidPath(p) {
+		return "", fmt.Errorf("invalid path %s", p)
+	}
+	return p, nil
+}
+
+func (c configFS) stat(p string) (fs.FileInfo, error) {
+	if c.fsys == nil {
+		return os.Stat(p)
+	}
+	return fs.Stat(c.fsys, p)
+}
+
+func (c configFS) readFile(p string) ([]byte, error) {
+	if c.fsys == nil {
+		return os.ReadFile(p)
+	}
+	return fs.ReadFile(c.fsys, p)
+}
+
+func (c configFS) readDirEntries(p string) ([]fs.DirEntry, error) {
+	if c.fsys == nil {
+		return os.ReadDir(p)
+	}
+	return fs.ReadDir(c.fsys, p)
+}
+
+func (c configFS) glob(pattern string) ([]string, error) {
+	if c.fsys == nil {
+		return filepath.Glob(pattern)
+	}
+	return fs.Glob(c.fsys, pattern)
+}
+
+func (c configFS) isAbs(p string) bool {
+	return c.fsys == nil && filepath.IsAbs(p)
+}
+
+func (c configFS) join(elem ...string) string {
+	if c.fsys == nil {
+		return filepath.Join(elem...)
+	}
+	return path.Join(elem...)
+}
+
+func (c configFS) dir(p string) string {
+	if c.fsys == nil {
+		return filepath.Dir(p)
+	}
+	return path.Dir(p)
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// LockFile is the name of the lockfile written next to the config.
+	LockFile = "infra.lock"
+
+	// lockVersion is the version of the lockfile format.
+	lockVersion = 1
+)
+
+// Lock pins the images of a config to their content digests, so every host
+// deploying the config runs the same images.
+type Lock struct {
+	Version int               `yaml:"version"`
+	Images  map[string]string `yaml:"images"` // Image of the config to its digest reference (e.g. "nginx:latest" to "nginx@sha256:...").
+}
+
+// LockPath returns the lockfile of the config at path: infra.lock in the
+// config directory, or next to the config file. Built-in configs (an empty
+// path) and stdin are locked in the working directory.
+func LockPath(path string) string {
+	if path == "" || path == "-" {
+		return LockFile
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, LockFile)
+	}
+	return filepath.Join(filepath.Dir(path), LockFile)
+}
+
+// LoadLock reads the lockfile at path.
+func LoadLock(path string) (*Lock, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("lockfile %s does not exist, lock the config first", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+
+	var lock Lock
+	if err = yaml.Unmarshal(raw, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %w", path, err)
+	}
+	if lock.Version != lockVersion {
+		return nil, fmt.Errorf("lockfile %s has version %d, expected %d", path, lock.Version, lockVersion)
+	}
+	return &lock, nil
+}
+
+// Write writes the lockfile to path, images in alphabetical order.
+func (l *Lock) Write(path string) error {
+	l.Version = lockVersion
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by infra, do not edit. Relock to update the image digests.\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(l); err != nil {
+		return fmt.Errorf("failed to marshal lockfile: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to marshal lockfile: %w", err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// Pin replaces the image of every container of ulti with its digest
+// reference, images built from a Dockerfile are not locked. It fails listing
+// the images that are not locked.
+func (l *Lock) Pin(ulti *UltimateConfig) error {
+	if ulti == nil {
+		return fmt.Errorf("ultimate config is nil")
+	}
+
+	var missing []string
+	for _, v := range ulti.Containers {
+		c := v.GetFull()
+		if c.Build != nil {
+			continue
+		}
+		pinned, ok := l.Images[c.Image]
+		if !ok {
+			if !slices.Contains(missing, c.Image) {
+				missing = append(missing, c.Image)
+			}
+			continue
+		}
+		c.Image = pinned
+	}
+
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return fmt.Errorf("images are not locked: %v, relock the config", missing)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// List merge strategies, see ContainerConfig.ListMerge.
+const (
+	ListReplace = "replace"
+	ListAppend  = "append"
+)
+
+// MergeDefaults merges the partial configuration c over its preset from
+// DefaultPresets. Configurations with neither Preset nor IsDefault are
+// returned unchanged.
+//
+// The preset is the one named by Preset. Otherwise it is the preset of the
+// same service whose image repository matches the image of c (postgres:16
+// selects the postgres preset), or the first preset of the service.
+//
+// Merge rules:
+//   - scalars set in c win; zero values ("", 0, false) only win when c was
+//     decoded from a file that sets them (load_level: 0), otherwise they
+//     inherit the preset;
+//   - maps (env_vars) are merged key by key, keys of c win;
+//   - lists replace the preset list, or are appended to it when ListMerge is
+//     "append"; an empty list set in the file clears the preset list;
+//     credentials are always merged and the health check test
+//     is always replaced;
+//   - nested structs (health_check, resources, logging, registry_auth, build)
+//     follow the same rules field by field.
+func MergeDefaults(c ContainerConfig) (ContainerConfig, error) {
+	if c.Preset != "" {
+		preset, err := DefaultPresets.Lookup(c.Preset)
+		if err != nil {
+			return c, fmt.Errorf("container %s: %w", c.ContainerService, err)
+		}
+		res := mergeConfig(preset, c)
+		res.Preset, res.ListMerge = "", ""
+		return res, nil
+	}
+
+	if !c.IsDefault {
+		return c, nil
+	}
+
+	preset, ok := DefaultPresets.find(c.ContainerService, c.Image)
+	if !ok {
+		log.Printf("no default configuration for service %s, using config as is\n", c.ContainerService)
+		return c, nil
+	}
+
+	res := mergeConfig(preset, c)
+	res.ListMerge = ""
+	return res, nil
+}
+
+// imageRepository strips the tag and digest of an image reference.
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// mergeConfig returns over merged on top of base following the MergeDefaults
+// rules, neither of them is modified.
+func mergeConfig(base, over ContainerConfig) ContainerConfig {
+	strategy := over.ListMerge
+	if strategy == "" {
+		strategy = ListReplace
+	}
+
+	res := base
+	mergeValue(reflect.ValueOf(&res).Elem(), reflect.ValueOf(over), strategy, over.keys, "")
+	res.keys = unionKeys(base.keys, over.keys)
+
+	res.Credentials = union(base.Credentials, over.Credentials)
+	if len(over.HealthCheck.Test) > 0 {
+		res.HealthCheck.Test = slices.Clone(over.HealthCheck.Test)
+	}
+	return res
+}
+
+// mergeValue merges src over dst. keys are the keys set in the file src was
+// decoded from (see ContainerConfig.UnmarshalYAML), path the key of src.
+func mergeValue(dst, src reflect.Value, strategy string, keys map[string]bool, path string) {
+	switch src.Kind() {
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			if !dst.Field(i).CanSet() {
+				continue
+			}
+			key, _, _ := strings.Cut(src.Type().Field(i).Tag.Get("yaml"), ",")
+			if path != "" {
+				key = path + "." + key
+			}
+			mergeValue(dst.Field(i), src.Field(i), strategy, keys, key)
+		}
+	case reflect.Pointer:
+		// the result never shares a struct with base or over, so editing a
+		// merged config leaves the presets as they are
+		if src.IsNil() && dst.IsNil() {
+			return
+		}
+		res := reflect.New(dst.Type().Elem())
+		if !dst.IsNil() {
+			mergeValue(res.Elem(), dst.Elem(), strategy, nil, "")
+		}
+		if !src.IsNil() {
+			mergeValue(res.Elem(), src.Elem(), strategy, keys, path)
+		}
+		dst.Set(res)
+	case reflect.Map:
+		if src.Len() == 0 {
+			if !dst.IsNil() {
+				dst.Set(cloneMap(dst))
+			}
+			return
+		}
+		merged := reflect.MakeMapWithSize(src.Type(), dst.Len()+src.Len())
+		for _, m := range []reflect.Value{dst, src} {
+			iter := m.MapRange()
+			for iter.Next() {
+				merged.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+		dst.Set(merged)
+	case reflect.Slice:
+		if src.Len() == 0 && keys[path] && strategy == ListReplace {
+			dst.Set(reflect.Zero(dst.Type()))
+			return
+		}
+		if src.Len() == 0 {
+			if !dst.IsNil() {
+				dst.Set(reflect.AppendSlice(reflect.MakeSlice(dst.Type(), 0, dst.Len()), dst))
+			}
+			return
+		}
+		res := reflect.MakeSlice(src.Type(), 0, dst.Len()+src.Len())
+		if strategy == ListAppend {
+			res = reflect.AppendSlice(res, dst)
+		}
+		dst.Set(reflect.AppendSlice(res, src))
+	default:
+		if !src.IsZero() || keys[path] {
+			dst.Set(src)
+		}
+	}
+}
+
+// unionKeys returns the keys of a and b in a new map, nil when both are nil.
+func unionKeys(a, b map[string]bool) map[string]bool {
+	if a == nil && b == nil {
+		return nil
+	}
+	res := make(map[string]bool, len(a)+len(b))
+	maps.Copy(res, a)
+	maps.Copy(res, b)
+	return res
+}
+
+func cloneMap(m reflect.Value) reflect.Value {
+	res := reflect.MakeMapWithSize(m.Type(), m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		res.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return res
+}
+
+// union returns the elements of a followed by those of b not already in a.
+func union(a, b []string) []string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	res := slices.Clone(a)
+	for _, v := range b {
+		if !slices.Contains(res, v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
@@ -0,0 +1,296 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config schema version of this release. Config files
+// declare their version in a top level `version` key; files without one, and
+// files with a list root, are version 1.
+const CurrentVersion = 2
+
+// migration upgrades a config document from version from to from+1. The
+// document is a mapping node with the containers in `containers`; warnf
+// reports deprecated fields the migration rewrote.
+type migration struct {
+	from        int
+	description string
+	migrate     func(doc *yaml.Node, warnf func(string, ...any)) error
+}
+
+// migrations are applied in order, one per version step.
+var migrations = []migration{
+	{
+		from:        1,
+		description: "health_check.test_command is renamed to health_check.test",
+		migrate:     migrateV1,
+	},
+}
+
+func migrateV1(doc *yaml.Node, warnf func(string, ...any)) error {
+	return eachContainer(doc, func(c *yaml.Node) error {
+		hc := mappingValue(c, "health_check")
+		if hc == nil || hc.Kind != yaml.MappingNode {
+			return nil
+		}
+		return renameKey(hc, "test_command", "test", "health_check.", warnf)
+	})
+}
+
+// migrateNode upgrades a decoded config document (a list of containers or a
+// stack mapping) to CurrentVersion. List roots become stack mappings. It
+// returns the migrated mapping and the version the document had.
+func migrateNode(root *yaml.Node, warnf func(string, ...any)) (*yaml.Node, int, error) {
+	if root.Kind == yaml.SequenceNode {
+		seq := *root
+		seq.HeadComment = ""
+		root = &yaml.Node{
+			Kind:        yaml.MappingNode,
+			Tag:         "!!map",
+			HeadComment: root.HeadComment,
+			Content:     []*yaml.Node{scalarNode("containers"), &seq},
+		}
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, 0, fmt.Errorf("expected a list of containers or a stack mapping")
+	}
+
+	version := 1
+	if v := mappingValue(root, "version"); v != nil {
+		n, err := strconv.Atoi(v.Value)
+		if err != nil || v.Kind != yaml.ScalarNode || n < 1 {
+			return nil, 0, fmt.Errorf("invalid config version %q", v.Value)
+		}
+		version = n
+	}
+	if version > CurrentVersion {
+		return nil, 0, fmt.Errorf("config version %d is newer than the supported version %d", version, CurrentVersion)
+	}
+
+	for _, m := range migrations {
+		if m.from < version {
+			continue
+		}
+		if err := m.migrate(root, warnf); err != nil {
+			return nil, 0, fmt.Errorf("migrating from version %d (%s): %w", m.from, m.description, err)
+		}
+	}
+
+	if v := mappingValue(root, "version"); v != nil {
+		v.SetString(strconv.Itoa(CurrentVersion))
+		v.Tag = "!!int"
+	} else {
+		root.Content = append([]*yaml.Node{scalarNode("version"), {
+			Kind:  yaml.ScalarNode,
+			Tag:   "!!int",
+			Value: strconv.Itoa(CurrentVersion),
+		}}, root.Content...)
+	}
+	return root, version, nil
+}
+
+// migrateDocument upgrades a generic document, see migrateNode. Deprecated
+// fields are logged with the file they were found in.
+func migrateDocument(doc any, path string) (*yaml.Node, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(doc); err != nil {
+		return nil, err
+	}
+
+	warned := false
+	root, _, err := migrateNode(node, func(format string, args ...any) {
+		log.Printf("%s: %s\n", path, fmt.Sprintf(format, args...))
+		warned = true
+	})
+	if warned {
+		log.Printf("%s: run `infra config migrate %s` to upgrade the file\n", path, path)
+	}
+	return root, err
+}
+
+// decodePreset decodes a preset file, a single container mapping, migrated
+// like the containers of a version 1 config file. Empty files are an error.
+func decodePreset(file []byte, path string) (ContainerConfig, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(file, &node); err != nil {
+		return ContainerConfig{}, err
+	}
+	if len(node.Content) == 0 {
+		return ContainerConfig{}, fmt.Errorf("preset file is empty")
+	}
+
+	doc, _, err := migrateNode(&yaml.Node{Kind: yaml.SequenceNode, Content: node.Content}, func(format string, args ...any) {
+		log.Printf("%s: %s\n", path, fmt.Sprintf(format, args...))
+	})
+	if err != nil {
+		return ContainerConfig{}, err
+	}
+
+	var stack stackFile
+	if err = doc.Decode(&stack); err != nil {
+		return ContainerConfig{}, err
+	}
+	if len(stack.Containers) == 0 || stack.Containers[0] == nil {
+		return ContainerConfig{}, fmt.Errorf("preset file is empty")
+	}
+	return *stack.Containers[0], nil
+}
+
+// MigrateFile rewrites a config file in place in the current schema version
+// and returns the deprecation warnings. Files already in the current version
+// are left untouched. YAML files keep their comments and key order, the other
+// formats are rewritten from the decoded document. Included files are not
+// followed, they are migrated on their own.
+func MigrateFile(path string) (changed bool, warnings []string, err error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return false, nil, err
+	}
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	warnf := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	var doc yaml.Node
+	if format == FormatYAML {
+		err = yaml.Unmarshal(file, &doc)
+	} else {
+		var raw any
+		if raw, err = decodeDocument(file, format); err == nil {
+			err = doc.Encode(raw)
+		}
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to unmarshal config file %s: %w", path, err)
+	}
+
+	root := &doc
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	if root.Kind == yaml.MappingNode && mappingValue(root, "services") != nil {
+		return false, nil, fmt.Errorf("%s is a compose file, compose files are not versioned by infra", path)
+	}
+
+	migrated, version, err := migrateNode(root, warnf)
+	if err != nil {
+		return false, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if version == CurrentVersion && root.Kind == yaml.MappingNode {
+		return false, warnings, nil
+	}
+
+	var out []byte
+	switch format {
+	case FormatYAML:
+		if doc.Kind == yaml.DocumentNode {
+			doc.Content[0] = migrated
+		} else {
+			doc = *migrated
+		}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err = enc.Encode(&doc); err == nil {
+			err = enc.Close()
+		}
+		out = buf.Bytes()
+	default:
+		var m map[string]any
+		if err = migrated.Decode(&m); err != nil {
+			break
+		}
+		out, err = encodeDocument(m, format)
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to encode config file %s: %w", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, warnings, os.WriteFile(path, out, info.Mode().Perm())
+}
+
+// encodeDocument writes a stack document in a non-YAML format.
+func encodeDocument(doc map[string]any, format Format) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		out, err := json.MarshalIndent(doc, "", "  ")
+		return append(out, '\n'), err
+	case FormatTOML:
+		var buf bytes.Buffer
+		err := toml.NewEncoder(&buf).Encode(doc)
+		return buf.Bytes(), err
+	case FormatHCL:
+		return encodeHCL(doc)
+	}
+	return nil, fmt.Errorf("unsupported config format: %s", format)
+}
+
+func eachContainer(doc *yaml.Node, fn func(c *yaml.Node) error) error {
+	containers := mappingValue(doc, "containers")
+	if containers == nil {
+		return nil
+	}
+	if containers.Kind != yaml.SequenceNode {
+		return fmt.Errorf("containers must be a list")
+	}
+	for _, c := range containers.Content {
+		if c.Kind != yaml.MappingNode {
+			continue
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in a mapping node, nil when unset.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// renameKey renames the key old of a mapping node to new. prefix is the path
+// of node used in the warning.
+func renameKey(node *yaml.Node, old, new, prefix string, warnf func(string, ...any)) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != old {
+			continue
+		}
+		if mappingValue(node, new) != nil {
+			return fmt.Errorf("both %s%s and %s%s are set", prefix, old, prefix, new)
+		}
+		node.Content[i].Value = new
+		warnf("%s%s is deprecated, use %s%s", prefix, old, prefix, new)
+		return nil
+	}
+	return nil
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
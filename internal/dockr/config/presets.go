@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+)
+
+// DefaultPresets is the registry used by the loaders. House presets can be
+// added with DefaultPresets.LoadDir before loading configs.
+var DefaultPresets = NewPresetRegistry()
+
+// PresetRegistry is a catalog of named container configurations that configs
+// reference with `preset: <name>`.
+type PresetRegistry struct {
+	presets map[string]ContainerConfig
+	order   []string
+
+	mu *sync.RWMutex
+}
+
+// NewPresetRegistry returns a registry with the built-in presets.
+func NewPresetRegistry() *PresetRegistry {
+	r := &PresetRegistry{
+		presets: make(map[string]ContainerConfig),
+		mu:      &sync.RWMutex{},
+	}
+
+	builtin := []struct {
+		name string
+		conf ContainerConfig
+	}{
+		{"postgres", PostgresConfig},
+		{"mongo", MongoConfig},
+		{"redis", RedisConfig},
+		{"nginx", NginxConfig},
+		{"haproxy", HaproxyConfig},
+		{"mumble", VoipConfig1},
+		{"teamspeak", VoipConfig2},
+		{"kong", ApiGatewayConfig},
+		{"prometheus", MonitoringConfig},
+	}
+	for _, p := range builtin {
+		r.presets[p.name] = p.conf
+		r.order = append(r.order, p.name)
+	}
+	return r
+}
+
+// Register adds a named preset. A preset may itself reference a parent with
+// Preset, it is merged over the parent on lookup.
+func (r *PresetRegistry) Register(name string, conf ContainerConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if name == "" {
+		return fmt.Errorf("preset name is empty")
+	}
+	if _, ok := r.presets[name]; ok {
+		return fmt.Errorf("duplicate preset: %s", name)
+	}
+	r.presets[name] = conf
+	r.order = append(r.order, name)
+	return nil
+}
+
+// Lookup returns the preset with its parents merged in.
+func (r *PresetRegistry) Lookup(name string) (ContainerConfig, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lookup(name, nil)
+}
+
+func (r *PresetRegistry) lookup(name string, seen []string) (ContainerConfig, error) {
+	if slices.Contains(seen, name) {
+		return ContainerConfig{}, fmt.Errorf("preset cycle: %s", strings.Join(append(seen, name), " -> "))
+	}
+
+	conf, ok := r.presets[name]
+	if !ok {
+		return ContainerConfig{}, fmt.Errorf("unknown preset: %s", name)
+	}
+	if conf.Preset == "" {
+		return conf, nil
+	}
+
+	parent, err := r.lookup(conf.Preset, append(seen, name))
+	if err != nil {
+		return ContainerConfig{}, err
+	}
+	res := mergeConfig(parent, conf)
+	res.Preset, res.ListMerge = "", ""
+	return res, nil
+}
+
+// Names returns the preset names in registration order.
+func (r *PresetRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.order)
+}
+
+// find returns the preset of the service whose image repository matches
+// image, otherwise the first preset of the service.
+func (r *PresetRegistry) find(service, image string) (ContainerConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	first := ""
+	for _, name := range r.order {
+		p := r.presets[name]
+		if p.ContainerService != service {
+			continue
+		}
+		if image != "" && imageRepository(p.Image) == imageRepository(image) {
+			first = name
+			break
+		}
+		if first == "" {
+			first = name
+		}
+	}
+	if first == "" {
+		return ContainerConfig{}, false
+	}
+
+	conf, err := r.lookup(first, nil)
+	return conf, err == nil
+}
+
+// LoadDir registers every *.yaml / *.yml file of dir as a preset named after
+// the file (acme-postgres.yaml -> acme-postgres). Each file holds a single
+// container configuration.
+func (r *PresetRegistry) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read preset dir: %w", err)
+	}
+
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		file, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read preset file: %w", err)
+		}
+
+		conf, err := decodePreset(file, path)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal preset %s: %w", path, err)
+		}
+
+		if err = r.Register(strings.TrimSuffix(e.Name(), ext), conf); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
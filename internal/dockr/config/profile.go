@@ -0,0 +1,142 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"strings"
+)
+
+// ProfilePath returns the overlay file of a profile next to the base config,
+// conf.yaml + prod -> conf.prod.yaml.
+func ProfilePath(base, profile string) string {
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + profile + ext
+}
+
+// LoadProfile loads the base config file with the overlay of profile applied.
+// An empty profile loads the base file only.
+//
+// Overlay entries are matched to base entries by name (name, or
+// container_service when unset) and merged over them with the MergeDefaults
+// rules: keys set in the overlay win, including zero values such as
+// load_level: 0 or tty: false, env vars are merged, lists replace the
+// base list unless the overlay sets list_merge: append. `enabled: false` leaves
+// a container out of the profile, entries without a base entry are added.
+func LoadProfile(path, profile string) (*UltimateConfig, error) {
+	return hostFS.loadProfile(path, profile)
+}
+
+func (c configFS) loadProfile(path, profile string) (*UltimateConfig, error) {
+	base, err := c.readConfigFile(path, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if profile == "" {
+		return newUltimateConfig(base)
+	}
+
+	overlay, err := c.readConfigFile(ProfilePath(path, profile), "")
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", profile, err)
+	}
+
+	return newUltimateConfig(applyOverlay(base, overlay))
+}
+
+// LoadFiles loads several config files as one config: the containers of a
+// file are merged over the containers of the same name in the files before it
+// with the overlay rules of LoadProfile. With a profile, the overlay of every
+// file that has one is applied right after the file, and at least one file
+// needs one. A single file loads as with LoadProfile.
+func LoadFiles(paths []string, profile string) (*UltimateConfig, error) {
+	return hostFS.loadFiles(paths, profile)
+}
+
+func (c configFS) loadFiles(paths []string, profile string) (*UltimateConfig, error) {
+	switch len(paths) {
+	case 0:
+		return nil, fmt.Errorf("no config files given")
+	case 1:
+		return c.loadProfile(paths[0], profile)
+	}
+
+	stack, overlays := &stackFile{}, 0
+	for _, path := range paths {
+		file, err := c.readConfigFile(path, "")
+		if err != nil {
+			return nil, err
+		}
+		stack = applyOverlay(stack, file)
+		if profile == "" || path == Stdin {
+			continue
+		}
+
+		overlayPath := ProfilePath(path, profile)
+		if _, err = c.stat(overlayPath); errors.Is(err, fs.ErrNotExist) {
+			// watch for the overlay being added
+			if abs, err := c.abs(overlayPath); err == nil {
+				c.record(abs)
+			}
+			continue
+		}
+		overlay, err := c.readConfigFile(overlayPath, "")
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", profile, err)
+		}
+		stack = applyOverlay(stack, overlay)
+		overlays++
+	}
+	if profile != "" && overlays == 0 {
+		return nil, fmt.Errorf("profile %s: none of the config files has an overlay", profile)
+	}
+	return newUltimateConfig(stack)
+}
+
+// applyOverlay merges the overlay containers over the base containers by name,
+// resource profiles of the overlay replace base profiles of the same name.
+func applyOverlay(base, overlay *stackFile) *stackFile {
+	res := &stackFile{
+		ResourceProfiles: maps.Clone(base.ResourceProfiles),
+		Containers:       make([]*ContainerConfig, 0, len(base.Containers)+len(overlay.Containers)),
+	}
+	if res.ResourceProfiles == nil {
+		res.ResourceProfiles = make(map[string]ResourceConfig, len(overlay.ResourceProfiles))
+	}
+	maps.Copy(res.ResourceProfiles, overlay.ResourceProfiles)
+
+	index := make(map[string]int, len(base.Containers))
+	for _, c := range base.Containers {
+		index[c.GetName()] = len(res.Containers)
+		res.Containers = append(res.Containers, c)
+	}
+
+	for _, o := range overlay.Containers {
+		i, ok := index[o.GetName()]
+		if !ok {
+			index[o.GetName()] = len(res.Containers)
+			res.Containers = append(res.Containers, o)
+			continue
+		}
+		merged := mergeConfig(*res.Containers[i], *o)
+		merged.Source = res.Containers[i].Source
+		res.Containers[i] = &merged
+	}
+	return res
+}
+
+// Render encodes the effective configuration in one of the formats the
+// loaders read ("yaml", "json", "toml" or "hcl").
+func (c *UltimateConfig) Render(format string) ([]byte, error) {
+	if format == "" {
+		format = string(FormatYAML)
+	}
+	f, err := ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return c.Encode(f)
+}
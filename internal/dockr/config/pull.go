@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Pull policies decide when the image of a container is pulled.
+const (
+	PullAlways       = "always"         // pull before every deploy
+	PullIfNotPresent = "if-not-present" // pull when the image is not on the host
+	PullNever        = "never"          // only use images on the host
+)
+
+var pullPolicies = []string{PullAlways, PullIfNotPresent, PullNever}
+
+// ParsePullPolicy validates a pull policy, the compose spellings "missing"
+// and "if_not_present" are accepted for if-not-present.
+func ParsePullPolicy(s string) (string, error) {
+	switch s {
+	case "missing", "if_not_present":
+		return PullIfNotPresent, nil
+	}
+	if !slices.Contains(pullPolicies, s) {
+		return "", fmt.Errorf("invalid pull policy %q, expected one of %s", s, strings.Join(pullPolicies, ", "))
+	}
+	return s, nil
+}
+
+// PullPolicyOf returns the pull policy of c: its own, else the global policy,
+// else always for images without a tag or tagged latest and if-not-present
+// for every other image.
+func PullPolicyOf(c *ContainerConfig, global string) string {
+	if c.PullPolicy != "" {
+		return c.PullPolicy
+	}
+	if global != "" {
+		return global
+	}
+
+	image := c.Image
+	if i := strings.Index(image, "@"); i >= 0 {
+		// pinned by digest, the content cannot change
+		return PullIfNotPresent
+	}
+	tag := "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		tag = image[i+1:]
+	}
+	if tag == "latest" {
+		return PullAlways
+	}
+	return PullIfNotPresent
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ReplicaName returns the name of replica i (counted from 1) of a container,
+// the first replica keeps the name of the container.
+func ReplicaName(name string, i int) string {
+	if i <= 1 {
+		return name
+	}
+	return name + "_" + strconv.Itoa(i)
+}
+
+// Scale sets the number of replicas of the container name, overriding the
+// replicas of its config.
+func (c *UltimateConfig) Scale(name string, replicas int) error {
+	v, ok := c.Containers[name]
+	if !ok {
+		return fmt.Errorf("container %s is not part of the config", name)
+	}
+
+	// presets are shared, never write into them
+	scaled := *v.GetFull()
+	scaled.Replicas = replicas
+	if err := validateRuntime(&scaled); err != nil {
+		return fmt.Errorf("container %s: %w", name, err)
+	}
+	c.Containers[name] = &scaled
+	return nil
+}
+
+// ExpandReplicas replaces every container that has replicas with one
+// container per replica (see ReplicaName). The replicas have the config of
+// the container with replicas unset, so scaling a container does not change
+// the replicas it already runs. Containers depending on a scaled container
+// start after its first replica.
+func (c *UltimateConfig) ExpandReplicas() error {
+	for _, name := range c.Names() {
+		full := c.Containers[name].GetFull()
+		if full.Replicas == 0 {
+			continue
+		}
+
+		replica := *full
+		replica.Replicas = 0
+		c.Containers[name] = &replica
+		for i := 2; i <= full.Replicas; i++ {
+			r := replica
+			r.Name = ReplicaName(name, i)
+			if _, ok := c.Containers[r.Name]; ok {
+				return fmt.Errorf("replica %s of %s: duplicate container name", r.Name, name)
+			}
+			c.Containers[r.Name] = &r
+		}
+	}
+	return nil
+}
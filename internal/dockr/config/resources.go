@@ -0,0 +1,269 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"gopkg.in/yaml.v3"
+)
+
+// ResourceConfig sets the resources of a container in human units. The
+// settings are layered over a named profile: a load level profile ("low",
+// "medium", "high") or one of the resource_profiles of the config files,
+// which may itself be based on another profile. Without a profile they are
+// layered over the resources of the container's load level.
+type ResourceConfig struct {
+	Profile           string            `yaml:"profile,omitempty" json:"profile,omitempty"`                       // Named profile the settings are layered over.
+	CPUs              string            `yaml:"cpus,omitempty" json:"cpus,omitempty"`                             // CPU limit, "1.5" or "1500m".
+	CPUShares         int64             `yaml:"cpu_shares,omitempty" json:"cpu_shares,omitempty"`                 // Relative CPU weight, 1024 is one CPU.
+	CPUSet            string            `yaml:"cpuset,omitempty" json:"cpuset,omitempty"`                         // CPUs the container may run on, "0-2,4".
+	Memory            string            `yaml:"memory,omitempty" json:"memory,omitempty"`                         // Memory limit, "512Mi", "1g".
+	MemoryReservation string            `yaml:"memory_reservation,omitempty" json:"memory_reservation,omitempty"` // Soft memory limit.
+	MemorySwap        string            `yaml:"memory_swap,omitempty" json:"memory_swap,omitempty"`               // Memory plus swap limit, "-1" for unlimited swap.
+	PidsLimit         *int64            `yaml:"pids_limit,omitempty" json:"pids_limit,omitempty"`                 // Maximum number of processes, -1 for unlimited.
+	BlkioWeight       uint16            `yaml:"blkio_weight,omitempty" json:"blkio_weight,omitempty"`             // Block IO weight, 10 to 1000.
+	ShmSize           string            `yaml:"shm_size,omitempty" json:"shm_size,omitempty"`                     // Size of /dev/shm.
+	Ulimits           map[string]Ulimit `yaml:"ulimits,omitempty" json:"ulimits,omitempty"`                       // Ulimits by name (nofile, nproc, ...).
+}
+
+// Ulimit is a soft and hard limit, written as {soft: 1024, hard: 4096} or as
+// a single number for both.
+type Ulimit struct {
+	Soft int64 `yaml:"soft" json:"soft"`
+	Hard int64 `yaml:"hard" json:"hard"`
+}
+
+func (u *Ulimit) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		n, err := strconv.ParseInt(node.Value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ulimit %q", node.Value)
+		}
+		u.Soft, u.Hard = n, n
+		return nil
+	}
+
+	type plain Ulimit
+	return node.Decode((*plain)(u))
+}
+
+// loadLevelProfiles are the built-in resource profiles.
+var loadLevelProfiles = map[string]int{
+	"low":    0,
+	"medium": 1,
+	"high":   2,
+}
+
+var cpusetPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+// ContainerResources returns the Docker resources of a container: the load
+// level profile (or load level) with the explicit settings applied. Resource
+// profiles of the config files are resolved when the config is loaded.
+func ContainerResources(c *ContainerConfig) (container.Resources, error) {
+	level := c.LoadLevel
+	if c.Resources != nil && c.Resources.Profile != "" {
+		l, ok := loadLevelProfiles[c.Resources.Profile]
+		if !ok {
+			return container.Resources{}, fmt.Errorf("unknown resource profile %s", c.Resources.Profile)
+		}
+		level = l
+	}
+
+	res := LoadLevelResources(level)
+	if c.Resources == nil {
+		return res, nil
+	}
+	err := c.Resources.apply(&res)
+	return res, err
+}
+
+// ShmBytes returns the parsed shm size, 0 when unset.
+func (r *ResourceConfig) ShmBytes() (int64, error) {
+	if r == nil || r.ShmSize == "" {
+		return 0, nil
+	}
+	return ParseBytes(r.ShmSize)
+}
+
+// apply sets the explicit settings on res. A memory limit without a swap limit
+// keeps the swap allowance of the profile, and the profile's reservation is
+// lowered to the limit when it would exceed it.
+func (r *ResourceConfig) apply(res *container.Resources) error {
+	if r.CPUs != "" {
+		nano, err := ParseCPUs(r.CPUs)
+		if err != nil {
+			return err
+		}
+		// docker rejects a CPU limit set both ways
+		res.NanoCPUs, res.CPUPeriod, res.CPUQuota = nano, 0, 0
+	}
+	if r.CPUShares != 0 {
+		if r.CPUShares < 2 {
+			return fmt.Errorf("cpu_shares must be at least 2")
+		}
+		res.CPUShares = r.CPUShares
+	}
+	if r.CPUSet != "" {
+		if !cpusetPattern.MatchString(r.CPUSet) {
+			return fmt.Errorf("invalid cpuset %q", r.CPUSet)
+		}
+		res.CpusetCpus = r.CPUSet
+	}
+
+	if r.Memory != "" {
+		mem, err := ParseBytes(r.Memory)
+		if err != nil {
+			return err
+		}
+		if res.MemorySwap > 0 {
+			res.MemorySwap = max(res.MemorySwap-res.Memory, 0) + mem
+		}
+		if r.MemoryReservation == "" && res.MemoryReservation > mem {
+			res.MemoryReservation = mem
+		}
+		res.Memory = mem
+	}
+	if r.MemoryReservation != "" {
+		reservation, err := ParseBytes(r.MemoryReservation)
+		if err != nil {
+			return err
+		}
+		if res.Memory > 0 && reservation > res.Memory {
+			return fmt.Errorf("memory_reservation %s exceeds the memory limit", r.MemoryReservation)
+		}
+		res.MemoryReservation = reservation
+	}
+	if r.MemorySwap != "" {
+		swap := int64(-1)
+		if r.MemorySwap != "-1" {
+			var err error
+			if swap, err = ParseBytes(r.MemorySwap); err != nil {
+				return err
+			}
+			if swap < res.Memory {
+				return fmt.Errorf("memory_swap %s is lower than the memory limit", r.MemorySwap)
+			}
+		}
+		res.MemorySwap = swap
+	}
+
+	if r.PidsLimit != nil {
+		limit := *r.PidsLimit
+		res.PidsLimit = &limit
+	}
+	if r.BlkioWeight != 0 {
+		if r.BlkioWeight < 10 || r.BlkioWeight > 1000 {
+			return fmt.Errorf("blkio_weight must be between 10 and 1000")
+		}
+		res.BlkioWeight = r.BlkioWeight
+	}
+	if _, err := r.ShmBytes(); err != nil {
+		return err
+	}
+
+	// ulimits of the config replace the ones of the profile with their name
+	res.Ulimits = slices.DeleteFunc(slices.Clone(res.Ulimits), func(u *units.Ulimit) bool {
+		_, ok := r.Ulimits[u.Name]
+		return ok
+	})
+	names := make([]string, 0, len(r.Ulimits))
+	for name := range r.Ulimits {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		u := r.Ulimits[name]
+		if u.Soft > u.Hard {
+			return fmt.Errorf("ulimit %s: soft limit exceeds hard limit", name)
+		}
+		res.Ulimits = append(res.Ulimits, &units.Ulimit{Name: name, Soft: u.Soft, Hard: u.Hard})
+	}
+	return nil
+}
+
+// resolveResources layers the resources of c over the resource profiles of
+// the config files they name, until only a load level profile is left, and
+// validates the result.
+func resolveResources(c *ContainerConfig, profiles map[string]ResourceConfig) error {
+	if c.Resources == nil {
+		return nil
+	}
+
+	res := *c.Resources
+	seen := make([]string, 0)
+	for res.Profile != "" {
+		if _, ok := loadLevelProfiles[res.Profile]; ok {
+			break
+		}
+		if slices.Contains(seen, res.Profile) {
+			return fmt.Errorf("resource profile cycle: %s", strings.Join(append(seen, res.Profile), " -> "))
+		}
+		seen = append(seen, res.Profile)
+
+		profile, ok := profiles[res.Profile]
+		if !ok {
+			return fmt.Errorf("container %s: unknown resource profile %s", c.GetName(), res.Profile)
+		}
+		over := res
+		over.Profile = ""
+		res = profile
+		mergeValue(reflect.ValueOf(&res).Elem(), reflect.ValueOf(over), ListReplace, nil, "")
+	}
+
+	c.Resources = &res
+	if _, err := ContainerResources(c); err != nil {
+		return fmt.Errorf("container %s: resources: %w", c.GetName(), err)
+	}
+	return nil
+}
+
+// ParseCPUs parses a number of CPUs, "1.5" or "1500m", into nano CPUs.
+func ParseCPUs(s string) (int64, error) {
+	v := strings.TrimSpace(s)
+	scale := 1e9
+	if strings.HasSuffix(v, "m") {
+		v, scale = strings.TrimSuffix(v, "m"), 1e6
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid cpus %q", s)
+	}
+	return int64(n * scale), nil
+}
+
+// ParseBytes parses a byte size with an optional binary unit: 512, 64k,
+// 512Mi, 512m, 1.5G, 1gb. Units are powers of 1024 whether written as k, ki,
+// kb or kib, as in Docker and Compose; any other suffix is an error.
+func ParseBytes(s string) (int64, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	i := strings.IndexFunc(v, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(v)
+	}
+
+	mult, ok := byteUnits[v[i:]]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, v[i:])
+	}
+	n, err := strconv.ParseFloat(v[:i], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// byteUnits are the units ParseBytes accepts, lower case.
+var byteUnits = map[string]int64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "ki": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mi": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gi": 1 << 30, "gib": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "ti": 1 << 40, "tib": 1 << 40,
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+)
+
+const (
+	userCredentialLen     = 16
+	passwordCredentialLen = 32
+)
+
+// secretRef matches ${secret:<container>.<KEY>} references in env values.
+var secretRef = regexp.MustCompile(`\$\{secret:([^.}]+)\.([^}]+)\}`)
+
+// SecretRef is a ${secret:<container>.<KEY>} reference.
+type SecretRef struct {
+	Container string
+	Key       string
+}
+
+// ReplaceSecretRefs returns value with every secret reference replaced by the
+// result of fn.
+func ReplaceSecretRefs(value string, fn func(SecretRef) string) string {
+	return secretRef.ReplaceAllStringFunc(value, func(ref string) string {
+		m := secretRef.FindStringSubmatch(ref)
+		return fn(SecretRef{Container: m[1], Key: m[2]})
+	})
+}
+
+// SecretStore persists credentials so they survive redeploys.
+type SecretStore interface {
+	GetSecret(service, key string) (string, bool)
+	SetSecret(service, key, value string) error
+}
+
+// ResolveSecrets fills the credentials of default configurations and replaces
+// ${secret:<container>.<KEY>} references in env vars and registry credentials
+// of all containers.
+//
+// A credential keeps the value set in the config, otherwise the one from the
+// store, otherwise a random one is generated and persisted on first deploy.
+func ResolveSecrets(ulti *UltimateConfig, store SecretStore) error {
+	if ulti == nil {
+		return fmt.Errorf("ultimate config is nil")
+	}
+	if store == nil {
+		return fmt.Errorf("secret store is nil")
+	}
+
+	for name, v := range ulti.Containers {
+		c := v.GetFull()
+		if !c.IsDefault || len(c.Credentials) == 0 {
+			continue
+		}
+
+		// presets share their env map, never write into it
+		env := maps.Clone(c.EnvVars)
+		if env == nil {
+			env = make(map[string]string, len(c.Credentials))
+		}
+
+		for _, key := range c.Credentials {
+			value, err := credential(store, name, key, env[key])
+			if err != nil {
+				return err
+			}
+			env[key] = value
+		}
+		c.EnvVars = env
+	}
+
+	for name, v := range ulti.Containers {
+		c := v.GetFull()
+
+		var env map[string]string
+		for key, value := range c.EnvVars {
+			if !strings.Contains(value, "${secret:") {
+				continue
+			}
+			resolved, err := resolveSecretRefs(store, value)
+			if err != nil {
+				return fmt.Errorf("container %s env %s: %w", name, key, err)
+			}
+			if env == nil {
+				env = maps.Clone(c.EnvVars)
+			}
+			env[key] = resolved
+		}
+		if env != nil {
+			c.EnvVars = env
+		}
+
+		if c.RegistryAuth == nil {
+			continue
+		}
+		// presets share their registry credentials as well
+		auth := *c.RegistryAuth
+		for key, value := range map[string]*string{
+			"username":       &auth.Username,
+			"password":       &auth.Password,
+			"identity_token": &auth.IdentityToken,
+		} {
+			resolved, err := resolveSecretRefs(store, *value)
+			if err != nil {
+				return fmt.Errorf("container %s registry_auth %s: %w", name, key, err)
+			}
+			*value = resolved
+		}
+		c.RegistryAuth = &auth
+	}
+	return nil
+}
+
+func credential(store SecretStore, service, key, value string) (string, error) {
+	stored, ok := store.GetSecret(service, key)
+	if value == "" && ok {
+		return stored, nil
+	}
+
+	if value == "" {
+		value = generateCredential(key)
+	}
+	if value != stored {
+		if err := store.SetSecret(service, key, value); err != nil {
+			return "", fmt.Errorf("failed to store credential %s of %s: %w", key, service, err)
+		}
+	}
+	return value, nil
+}
+
+func resolveSecretRefs(store SecretStore, value string) (string, error) {
+	var missing []string
+
+	resolved := ReplaceSecretRefs(value, func(ref SecretRef) string {
+		secret, ok := store.GetSecret(ref.Container, ref.Key)
+		if !ok {
+			missing = append(missing, ref.Container+"."+ref.Key)
+		}
+		return secret
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unknown secret references: %v", missing)
+	}
+	return resolved, nil
+}
+
+// generateCredential returns a lowercase user name for *USER/*USERNAME keys
+// and a long password for anything else.
+func generateCredential(key string) string {
+	key = strings.ToUpper(key)
+	if strings.HasSuffix(key, "USER") || strings.HasSuffix(key, "USERNAME") {
+		return "u" + strings.ToLower(randString(userCredentialLen-1))
+	}
+	return randString(passwordCredentialLen)
+}
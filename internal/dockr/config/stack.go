@@ -0,0 +1,191 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// stackFile is a config file with a mapping root. It includes other config
+// files (paths, globs or directories relative to the file) next to its own
+// containers. Config files with a list root hold containers only.
+type stackFile struct {
+	Version          int                       `yaml:"version,omitempty" json:"version,omitempty"`
+	Include          []string                  `yaml:"include,omitempty" json:"include,omitempty"`
+	ResourceProfiles map[string]ResourceConfig `yaml:"resource_profiles,omitempty" json:"resource_profiles,omitempty"`
+	Containers       []*ContainerConfig        `yaml:"containers" json:"containers"`
+}
+
+var configExts = []string{".yaml", ".yml", ".json", ".toml", ".hcl"}
+
+// LoadDir loads every config file of dir (*.yaml, *.yml, *.json, *.toml,
+// *.hcl) in name order as a single stack.
+func LoadDir(dir string) (*UltimateConfig, error) {
+	abs, err := hostFS.abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config path %s: %w", dir, err)
+	}
+	conf, err := hostFS.readDir(abs, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newUltimateConfig(conf)
+}
+
+// readPath reads a config file, or all config files of a directory,
+// following includes. seen holds the files being read to detect cycles, an
+// empty format is detected by extension.
+func (c configFS) readPath(path string, format Format, seen []string) (*stackFile, error) {
+	abs, err := c.abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config path %s: %w", path, err)
+	}
+	c.record(abs)
+
+	info, err := c.stat(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if info.IsDir() {
+		return c.readDir(abs, seen)
+	}
+
+	file, err := c.readFile(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return c.readConfig(file, abs, c.dir(abs), format, seen)
+}
+
+// readConfig decodes file, read from the resolved path abs, and follows its
+// includes relative to dir.
+func (c configFS) readConfig(file []byte, abs, dir string, format Format, seen []string) (*stackFile, error) {
+	if slices.Contains(seen, abs) {
+		return nil, fmt.Errorf("include cycle: %s", strings.Join(append(seen, abs), " -> "))
+	}
+	seen = append(seen, abs)
+
+	stack, err := decodeConfig(file, abs, format)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &stackFile{}
+	for _, pattern := range stack.Include {
+		if !c.isAbs(pattern) {
+			pattern = c.join(dir, pattern)
+		}
+
+		matches, err := c.glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include %s: %w", abs, pattern, err)
+		}
+		if strings.ContainsAny(pattern, "*?[") {
+			// new matches show up as a change of the directory
+			c.record(c.dir(pattern))
+		}
+		if len(matches) == 0 {
+			if !strings.ContainsAny(pattern, "*?[") {
+				return nil, fmt.Errorf("%s: included file %s does not exist", abs, pattern)
+			}
+			log.Printf("%s: include %s matched no files\n", abs, pattern)
+		}
+
+		for _, m := range matches {
+			included, err := c.readPath(m, "", seen)
+			if err != nil {
+				return nil, err
+			}
+			if err = conf.add(included, m); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, cc := range stack.Containers {
+		cc.Source = abs
+		if c.fsys == nil {
+			cc.Volumes = resolveVolumes(dir, cc.Volumes)
+			resolveBuildContext(dir, cc.Build)
+		}
+	}
+	stack.Include = nil
+	if err = conf.add(stack, abs); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+func (c configFS) readDir(dir string, seen []string) (*stackFile, error) {
+	entries, err := c.readDirEntries(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config dir: %w", err)
+	}
+
+	conf := &stackFile{}
+	for _, e := range entries {
+		if e.IsDir() || !slices.Contains(configExts, path.Ext(e.Name())) {
+			continue
+		}
+
+		path := c.join(dir, e.Name())
+		stack, err := c.readPath(path, "", seen)
+		if err != nil {
+			return nil, err
+		}
+		if err = conf.add(stack, path); err != nil {
+			return nil, err
+		}
+	}
+	return conf, nil
+}
+
+// add appends the containers and resource profiles of other, read from
+// path. A profile may be defined in several files as long as the definitions
+// are the same.
+func (s *stackFile) add(other *stackFile, path string) error {
+	s.Containers = append(s.Containers, other.Containers...)
+	for name, p := range other.ResourceProfiles {
+		if _, ok := loadLevelProfiles[name]; ok {
+			return fmt.Errorf("%s: resource profile %s is built in and cannot be redefined", path, name)
+		}
+		if prev, ok := s.ResourceProfiles[name]; ok && !reflect.DeepEqual(prev, p) {
+			return fmt.Errorf("%s: resource profile %s is already defined differently", path, name)
+		}
+		if s.ResourceProfiles == nil {
+			s.ResourceProfiles = make(map[string]ResourceConfig)
+		}
+		s.ResourceProfiles[name] = p
+	}
+	return nil
+}
+
+// resolveBuildContext makes a relative build context relative to dir, no
+// context is dir itself.
+func resolveBuildContext(dir string, build *BuildConfig) {
+	if build != nil && !filepath.IsAbs(build.Context) {
+		build.Context = filepath.Join(dir, build.Context)
+	}
+}
+
+// resolveVolumes makes relative bind sources (./data:/data, ../x:/x) relative
+// to dir. Absolute paths and named volumes are kept.
+func resolveVolumes(dir string, volumes []string) []string {
+	if len(volumes) == 0 {
+		return volumes
+	}
+
+	res := make([]string, 0, len(volumes))
+	for _, v := range volumes {
+		src, rest, ok := strings.Cut(v, ":")
+		if ok && (src == "." || src == ".." || strings.HasPrefix(src, "./") || strings.HasPrefix(src, "../")) {
+			v = filepath.Join(dir, src) + ":" + rest
+		}
+		res = append(res, v)
+	}
+	return res
+}
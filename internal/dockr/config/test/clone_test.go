@@ -0,0 +1,62 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"reflect"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+
+	pids := int64(100)
+	ulti, err := config.NewContainersConfig(config.ContainerConfig{
+		Name:         "api",
+		Image:        "api:1",
+		Replicas:     2,
+		EnvVars:      map[string]string{"TOKEN": "${secret:env:API_TOKEN}"},
+		Cmd:          []string{"serve"},
+		RegistryAuth: &config.RegistryAuthConfig{Username: "ci"},
+		Build:        &config.BuildConfig{Context: ".", Args: map[string]string{"VERSION": "1"}},
+		Resources: &config.ResourceConfig{
+			PidsLimit: &pids,
+			Ulimits:   map[string]config.Ulimit{"nofile": {Soft: 1024, Hard: 4096}},
+		},
+		Logging:     &config.LoggingConfig{Driver: "json-file", Options: map[string]string{"max-size": "10m"}},
+		HealthCheck: config.HealthCheckConfig{Test: []string{"CMD", "true"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clone := ulti.Clone()
+	if !reflect.DeepEqual(clone.Containers, ulti.Containers) {
+		t.Fatalf("clone differs from the config:\n%+v\n%+v", clone.Containers["api"], ulti.Containers["api"])
+	}
+
+	c := clone.Containers["api"].GetFull()
+	c.EnvVars["TOKEN"] = "resolved"
+	c.Cmd[0] = "migrate"
+	c.RegistryAuth.Username = "admin"
+	c.Build.Args["VERSION"] = "2"
+	*c.Resources.PidsLimit = 1
+	c.Resources.Ulimits["nofile"] = config.Ulimit{Soft: 1, Hard: 1}
+	c.Logging.Options["max-size"] = "1m"
+	c.HealthCheck.Test[1] = "false"
+	if err = clone.ExpandReplicas(); err != nil {
+		t.Fatal(err)
+	}
+
+	orig := ulti.Containers["api"].GetFull()
+	if len(ulti.Containers) != 1 || orig.Replicas != 2 {
+		t.Errorf("expanding the clone expanded the config: %v", ulti.Names())
+	}
+	if orig.EnvVars["TOKEN"] != "${secret:env:API_TOKEN}" || orig.Cmd[0] != "serve" || orig.RegistryAuth.Username != "ci" {
+		t.Errorf("config changed with its clone: %+v", orig)
+	}
+	if orig.Build.Args["VERSION"] != "1" || *orig.Resources.PidsLimit != 100 || orig.Resources.Ulimits["nofile"].Soft != 1024 {
+		t.Errorf("build or resources changed with the clone: %+v %+v", orig.Build, orig.Resources)
+	}
+	if orig.Logging.Options["max-size"] != "10m" || orig.HealthCheck.Test[1] != "true" {
+		t.Errorf("logging or health check changed with the clone: %+v %+v", orig.Logging, orig.HealthCheck)
+	}
+}
@@ -0,0 +1,167 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+)
+
+func TestCompose(t *testing.T) {
+
+	ulti, warnings, err := config.LoadCompose("compose/docker-compose.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Services", func(t *testing.T) {
+		if !slices.Equal(ulti.Names(), []string{"api", "db", "web"}) {
+			t.Fatalf("unexpected containers %v", ulti.Names())
+		}
+
+		web := ulti.Containers["web"].GetFull()
+		if !slices.Equal(web.Cmd, []string{"nginx", "-g", "daemon off;"}) {
+			t.Errorf("unexpected cmd %q", web.Cmd)
+		}
+		if web.EnvVars["LOG_LEVEL"] != "debug" || web.EnvVars["UPSTREAM"] != "http://db:5432" {
+			t.Errorf("unexpected env %v", web.EnvVars)
+		}
+		if !slices.Equal(web.Ports, []string{"8080:80", "127.0.0.1:8443:443", "[::1]:8081:81", "[::1]:8082:82", "9000:9000/udp"}) {
+			t.Errorf("unexpected ports %v", web.Ports)
+		}
+
+		dir, _ := filepath.Abs("compose")
+		want := []string{filepath.Join(dir, "html") + ":/usr/share/nginx/html:ro", "cache:/var/cache/nginx"}
+		if !slices.Equal(web.Volumes, want) {
+			t.Errorf("unexpected volumes %v", web.Volumes)
+		}
+		if web.NetworkID != "front" || web.RestartPolicy != "on-failure" {
+			t.Errorf("unexpected network %s / restart %s", web.NetworkID, web.RestartPolicy)
+		}
+		if !slices.Equal(web.HealthCheck.Test, []string{"CMD-SHELL", "curl -f http://localhost"}) {
+			t.Errorf("unexpected health check %v", web.HealthCheck)
+		}
+		if !slices.Equal(web.DependsOn, []string{"db"}) {
+			t.Errorf("unexpected depends_on %v", web.DependsOn)
+		}
+		if web.Labels["team"] != "edge" || web.User != "101:101" || !web.ReadOnly {
+			t.Errorf("unexpected labels %v / user %s / read_only %v", web.Labels, web.User, web.ReadOnly)
+		}
+		if !slices.Equal(web.CapDrop, []string{"ALL"}) || !slices.Equal(web.CapAdd, []string{"NET_BIND_SERVICE"}) {
+			t.Errorf("unexpected capabilities %v / %v", web.CapAdd, web.CapDrop)
+		}
+		if !slices.Equal(web.GetExtraHosts(), []string{"metrics:10.0.0.5"}) {
+			t.Errorf("unexpected extra hosts %v", web.GetExtraHosts())
+		}
+		if timeout := web.GetStopTimeout(); timeout == nil || *timeout != 30 {
+			t.Errorf("unexpected stop timeout %v", timeout)
+		}
+		if web.Logging == nil || web.Logging.Driver != "json-file" || web.Logging.Options["max-size"] != "10m" {
+			t.Errorf("unexpected logging %+v", web.Logging)
+		}
+
+		api := ulti.Containers["api"].GetFull()
+		if api.Build == nil || api.Build.Context != filepath.Join(dir, "api") || api.Build.Dockerfile != "docker/Dockerfile" {
+			t.Fatalf("unexpected build %+v", api.Build)
+		}
+		if api.Build.Args["VERSION"] != "1.4" || api.Build.Target != "runtime" || api.Image != "infra/api:latest" {
+			t.Errorf("unexpected build %+v of image %s", api.Build, api.Image)
+		}
+
+		db := ulti.Containers["db"].GetFull()
+		if db.EnvVars["POSTGRES_DB"] != "app" {
+			t.Errorf("unexpected db config %+v", db)
+		}
+		res, err := config.ContainerResources(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.NanoCPUs != 1e9 || res.Memory != 1<<30 {
+			t.Errorf("deploy.resources not mapped: cpus %d memory %d", res.NanoCPUs, res.Memory)
+		}
+	})
+
+	t.Run("DeployKeepsServiceResources", func(t *testing.T) {
+		api := ulti.Containers["api"].GetFull()
+		if api.Resources == nil || api.Resources.CPUs != "0.5" || api.Resources.Memory != "512m" {
+			t.Errorf("deploy.resources overrode keys it does not set: %+v", api.Resources)
+		}
+
+		if !slices.ContainsFunc(warnings, func(w string) bool {
+			return strings.Contains(w, "deploy.resources.limits.memory 512m overrides mem_limit 256m")
+		}) {
+			t.Errorf("missing warning about the overridden mem_limit in %v", warnings)
+		}
+
+		placement := slices.IndexFunc(warnings, func(w string) bool { return strings.Contains(w, "deploy.placement") })
+		update := slices.IndexFunc(warnings, func(w string) bool { return strings.Contains(w, "deploy.update_config") })
+		if placement < 0 || update < placement {
+			t.Errorf("deploy warnings missing or not in key order: %v", warnings)
+		}
+	})
+
+	t.Run("Ports", func(t *testing.T) {
+		ports := ulti.Containers["web"].GetPorts()
+		want := nat.PortMap{
+			"80/tcp":   {{HostPort: "8080"}},
+			"443/tcp":  {{HostIP: "127.0.0.1", HostPort: "8443"}},
+			"9000/udp": {{HostPort: "9000"}},
+			"81/tcp":   {{HostIP: "::1", HostPort: "8081"}},
+			"82/tcp":   {{HostIP: "::1", HostPort: "8082"}},
+		}
+		if !reflect.DeepEqual(ports, want) {
+			t.Errorf("unexpected port bindings %v", ports)
+		}
+
+		murmur := config.ContainerConfig{Ports: []string{"64738:64738", "64738:64738/udp"}}
+		ports = murmur.GetPorts()
+		if len(ports["64738/tcp"]) != 1 || len(ports["64738/udp"]) != 1 || len(ports) != 2 {
+			t.Errorf("unexpected murmur port bindings %v", ports)
+		}
+	})
+
+	t.Run("Warnings", func(t *testing.T) {
+		for _, want := range []string{"secrets", "pid", "replicas", "back", "service_healthy", "restart retry"} {
+			found := false
+			for _, w := range warnings {
+				if strings.Contains(w, want) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("missing warning about %s in %v", want, warnings)
+			}
+		}
+	})
+
+	t.Run("Interpolation", func(t *testing.T) {
+		web := ulti.Containers["web"].GetFull()
+		if web.EnvVars["API_URL"] != "http://${API_HOST:-api}:8080" || web.EnvVars["PRICE"] != "$5" {
+			t.Errorf("unexpected env %v", web.EnvVars)
+		}
+
+		var found []string
+		for _, w := range warnings {
+			if strings.Contains(w, "interpolation") {
+				found = append(found, w)
+			}
+		}
+		if len(found) != 1 || !strings.Contains(found[0], "${API_HOST:-api}") {
+			t.Errorf("expected a single interpolation warning, got %v", found)
+		}
+	})
+
+	t.Run("Include", func(t *testing.T) {
+		ulti, err := config.LoadContainersConfig("compose/docker-compose.yml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ulti.Containers) != 3 {
+			t.Errorf("unexpected containers %v", ulti.Names())
+		}
+	})
+}
@@ -0,0 +1,25 @@
+include = ["multi/voice"]
+
+container "db" {
+  preset     = "postgres"
+  image      = "postgres:16"
+  load_level = 1
+
+  env_vars = {
+    POSTGRES_DB     = "app"
+    MAX_CONNECTIONS = 200
+  }
+}
+
+container "lb" {
+  container_service = "LB"
+  image             = "nginx:latest"
+  ports             = ["80:80", "443:443"]
+  restart_policy    = "always"
+
+  health_check {
+    test     = ["CMD", "curl", "-f", "http://localhost"]
+    interval = "30s"
+    retries  = 3
+  }
+}
@@ -0,0 +1,78 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestFormats(t *testing.T) {
+
+	load := func(t *testing.T, path string) *config.UltimateConfig {
+		t.Helper()
+		ulti, err := config.LoadContainersConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ulti
+	}
+
+	t.Run("Identical", func(t *testing.T) {
+		toml := load(t, "conf.toml")
+		hcl := load(t, "conf.hcl")
+
+		if !slices.Equal(toml.Names(), []string{"db", "lb", "mumble"}) {
+			t.Fatalf("unexpected containers %v", toml.Names())
+		}
+		for _, name := range toml.Names() {
+			a, b := toml.Containers[name].GetFull(), hcl.Containers[name].GetFull()
+			a.Source, b.Source = "", ""
+			if !reflect.DeepEqual(a, b) {
+				t.Errorf("%s differs:\ntoml: %+v\nhcl:  %+v", name, a, b)
+			}
+		}
+
+		db := toml.Containers["db"].GetFull()
+		if db.EnvVars["MAX_CONNECTIONS"] != "200" || db.Hostname != config.PostgresConfig.Hostname {
+			t.Errorf("unexpected db config %+v", db)
+		}
+	})
+
+	t.Run("Explicit", func(t *testing.T) {
+		// stack.conf is TOML under an extension no format is known by
+		path := "stack.conf"
+		if _, err := config.LoadContainersConfig(path); err == nil {
+			t.Errorf("expected error for unknown extension")
+		}
+		ulti, err := config.LoadContainersConfigAs(path, config.FormatTOML)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ulti.Containers) != 2 {
+			t.Errorf("unexpected containers %v", ulti.Names())
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		orig := load(t, "conf.toml")
+		dir := t.TempDir()
+
+		for _, ext := range []string{".yaml", ".json", ".toml", ".hcl"} {
+			path := filepath.Join(dir, "saved"+ext)
+			if err := orig.Save(path); err != nil {
+				t.Fatal(err)
+			}
+
+			saved := load(t, path)
+			for _, name := range orig.Names() {
+				a, b := orig.Containers[name].GetFull(), saved.Containers[name].GetFull()
+				a.Source, b.Source = "", ""
+				if !reflect.DeepEqual(a, b) {
+					t.Errorf("%s: %s differs after round trip:\nwant: %+v\ngot:  %+v", ext, name, a, b)
+				}
+			}
+		}
+	})
+}
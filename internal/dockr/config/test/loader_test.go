@@ -0,0 +1,90 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoaders(t *testing.T) {
+
+	t.Run("FS", func(t *testing.T) {
+		ulti, err := config.LoadFS(os.DirFS("multi"), "stack.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ulti.Names(), []string{"db", "lb", "monitoring", "mumble"}) {
+			t.Fatalf("unexpected containers %v", ulti.Names())
+		}
+
+		db := ulti.Containers["db"].GetFull()
+		if db.Source != "db.yaml" {
+			t.Errorf("unexpected source %s", db.Source)
+		}
+		if db.Volumes[0] != "./data/postgres:/var/lib/postgresql/data" {
+			t.Errorf("relative volume should be kept: %v", db.Volumes)
+		}
+	})
+
+	t.Run("FSIncludeOutside", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"stack.yaml": {Data: []byte("include: [../db.yaml]\n")},
+		}
+		if _, err := config.LoadFS(fsys, "stack.yaml"); err == nil {
+			t.Fatal("expected include outside of the filesystem to fail")
+		}
+	})
+
+	t.Run("Reader", func(t *testing.T) {
+		conf := `{"containers": [{"name": "cache", "preset": "redis", "env_vars": {"PORT": 6380}}]}`
+		ulti, err := config.LoadContainersConfigReader(strings.NewReader(conf), config.FormatJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cache := ulti.Containers["cache"].GetFull()
+		if cache.Image != config.RedisConfig.Image || cache.EnvVars["PORT"] != "6380" {
+			t.Errorf("unexpected cache config %+v", cache)
+		}
+		if cache.Source != "<reader>" {
+			t.Errorf("unexpected source %s", cache.Source)
+		}
+	})
+
+	t.Run("ReaderDefaultsToYAML", func(t *testing.T) {
+		conf := "- name: web\n  image: nginx:alpine\n"
+		ulti, err := config.LoadContainersConfigReader(strings.NewReader(conf), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ulti.Names(), []string{"web"}) {
+			t.Fatalf("unexpected containers %v", ulti.Names())
+		}
+	})
+
+	t.Run("Stdin", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdin := os.Stdin
+		os.Stdin = r
+		t.Cleanup(func() { os.Stdin = stdin })
+
+		go func() {
+			w.WriteString("[[containers]]\nname = \"web\"\nimage = \"nginx:alpine\"\n")
+			w.Close()
+		}()
+
+		ulti, err := config.LoadContainersConfigAs(config.Stdin, config.FormatTOML)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ulti.Names(), []string{"web"}) {
+			t.Fatalf("unexpected containers %v", ulti.Names())
+		}
+	})
+}
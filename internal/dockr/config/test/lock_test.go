@@ -0,0 +1,77 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, config.LockFile)
+
+	lock := &config.Lock{Images: map[string]string{
+		"nginx:latest":       "nginx@sha256:0123",
+		"ghcr.io/acme/api:1": "ghcr.io/acme/api@sha256:4567",
+	}}
+	if err := lock.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Load", func(t *testing.T) {
+		loaded, err := config.LoadLock(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Version != 1 || loaded.Images["nginx:latest"] != "nginx@sha256:0123" {
+			t.Errorf("unexpected lock %+v", loaded)
+		}
+
+		if _, err = config.LoadLock(filepath.Join(dir, "missing.lock")); err == nil {
+			t.Error("expected an error for a missing lockfile")
+		}
+	})
+
+	t.Run("Pin", func(t *testing.T) {
+		ulti, err := config.NewContainersConfig(
+			config.ContainerConfig{Name: "web", Image: "nginx:latest"},
+			config.ContainerConfig{Name: "api", Image: "ghcr.io/acme/api:1"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = lock.Pin(ulti); err != nil {
+			t.Fatal(err)
+		}
+		if got := ulti.Containers["api"].GetImage(); got != "ghcr.io/acme/api@sha256:4567" {
+			t.Errorf("image was pinned to %s", got)
+		}
+	})
+
+	t.Run("NotLocked", func(t *testing.T) {
+		ulti, err := config.NewContainersConfig(config.ContainerConfig{Name: "db", Image: "postgres:16"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = lock.Pin(ulti); err == nil {
+			t.Error("expected an error for an image that is not locked")
+		}
+	})
+
+	t.Run("Path", func(t *testing.T) {
+		file := filepath.Join(dir, "stack.yaml")
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for in, want := range map[string]string{
+			"":   config.LockFile,
+			dir:  path,
+			file: path,
+		} {
+			if got := config.LockPath(in); got != want {
+				t.Errorf("LockPath(%q) = %s, expected %s", in, got, want)
+			}
+		}
+	})
+}
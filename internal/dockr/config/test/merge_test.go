@@ -0,0 +1,114 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"slices"
+	"testing"
+)
+
+func TestMergeDefaults(t *testing.T) {
+
+	t.Run("Postgres", func(t *testing.T) {
+		c, _ := config.MergeDefaults(config.ContainerConfig{
+			IsDefault:        true,
+			ContainerService: "DB",
+			Image:            "postgres:16",
+			EnvVars:          map[string]string{"POSTGRES_DB": "app", "TZ": "UTC"},
+		})
+
+		if c.Image != "postgres:16" {
+			t.Errorf("image overridden: %s", c.Image)
+		}
+		if c.Hostname != config.PostgresConfig.Hostname {
+			t.Errorf("hostname not inherited: %s", c.Hostname)
+		}
+		if c.EnvVars["POSTGRES_DB"] != "app" || c.EnvVars["TZ"] != "UTC" {
+			t.Errorf("env not merged: %v", c.EnvVars)
+		}
+		if c.HealthCheck.Retries != config.PostgresConfig.HealthCheck.Retries {
+			t.Errorf("health check not inherited: %+v", c.HealthCheck)
+		}
+		if config.PostgresConfig.EnvVars["POSTGRES_DB"] != "exampledb" {
+			t.Errorf("preset was modified")
+		}
+	})
+
+	t.Run("SelectByImage", func(t *testing.T) {
+		c, _ := config.MergeDefaults(config.ContainerConfig{
+			IsDefault:        true,
+			ContainerService: "DB",
+			Image:            "mongo:7",
+		})
+
+		if c.Hostname != config.MongoConfig.Hostname {
+			t.Errorf("expected mongo preset, got hostname %s", c.Hostname)
+		}
+	})
+
+	t.Run("Lists", func(t *testing.T) {
+		replaced, _ := config.MergeDefaults(config.ContainerConfig{
+			IsDefault:        true,
+			ContainerService: "LB",
+			Image:            "nginx:1.27",
+			Ports:            []string{"8080:80"},
+		})
+		if !slices.Equal(replaced.Ports, []string{"8080:80"}) {
+			t.Errorf("ports not replaced: %v", replaced.Ports)
+		}
+
+		appended, _ := config.MergeDefaults(config.ContainerConfig{
+			IsDefault:        true,
+			ContainerService: "LB",
+			Image:            "nginx:1.27",
+			ListMerge:        config.ListAppend,
+			Volumes:          []string{"/host/certs:/etc/certs"},
+		})
+		want := append(slices.Clone(config.NginxConfig.Volumes), "/host/certs:/etc/certs")
+		if !slices.Equal(appended.Volumes, want) {
+			t.Errorf("volumes not appended: %v", appended.Volumes)
+		}
+	})
+
+	t.Run("NotDefault", func(t *testing.T) {
+		c, _ := config.MergeDefaults(config.ContainerConfig{
+			ContainerService: "DB",
+			Image:            "postgres:16",
+		})
+		if c.Hostname != "" {
+			t.Errorf("config without is_default was merged")
+		}
+	})
+
+	t.Run("Pointers", func(t *testing.T) {
+		err := config.DefaultPresets.Register("merge-pointers", config.ContainerConfig{
+			ContainerService: "app",
+			Image:            "app:1",
+			Resources:        &config.ResourceConfig{CPUs: "1", Memory: "1g"},
+			Logging:          &config.LoggingConfig{Driver: "json-file", Options: map[string]string{"max-size": "10m"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inherited, err := config.MergeDefaults(config.ContainerConfig{Preset: "merge-pointers"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		inherited.Resources.CPUs = "2"
+		inherited.Logging.Options["max-size"] = "1g"
+
+		merged, err := config.MergeDefaults(config.ContainerConfig{
+			Preset:    "merge-pointers",
+			Resources: &config.ResourceConfig{Memory: "2g"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if merged.Resources.CPUs != "1" || merged.Resources.Memory != "2g" {
+			t.Errorf("resources not merged field by field: %+v", merged.Resources)
+		}
+		if merged.Logging.Options["max-size"] != "10m" {
+			t.Errorf("preset was modified through a merged config: %v", merged.Logging.Options)
+		}
+	})
+}
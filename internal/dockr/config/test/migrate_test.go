@@ -0,0 +1,144 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+
+	const legacy = `# web tier
+- name: web
+  image: nginx:alpine # pinned below
+  health_check:
+    interval: 30s
+    test_command: ["CMD", "curl", "-f", "http://localhost"]
+`
+
+	write := func(t *testing.T, name, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("Load", func(t *testing.T) {
+		ulti, err := config.LoadContainersConfig(write(t, "stack.yaml", legacy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test := ulti.Containers["web"].GetHealthTest()
+		if !slices.Equal(test, []string{"CMD", "curl", "-f", "http://localhost"}) {
+			t.Errorf("test_command not migrated: %v", test)
+		}
+	})
+
+	t.Run("LoadWarns", func(t *testing.T) {
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		defer log.SetOutput(os.Stderr)
+
+		path := write(t, "stack.yaml", legacy)
+		if _, err := config.LoadContainersConfig(path); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{
+			path + ": health_check.test_command is deprecated, use health_check.test",
+			"run `infra config migrate " + path + "`",
+		} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("missing warning %q in:\n%s", want, buf.String())
+			}
+		}
+	})
+
+	t.Run("CurrentNotMigrated", func(t *testing.T) {
+		// migrations only run for the versions before the one of the file
+		path := write(t, "stack.yaml", "version: 2\ncontainers:\n  - name: web\n    image: nginx\n    health_check:\n      test_command: [CMD, \"true\"]\n")
+		ulti, err := config.LoadContainersConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test := ulti.Containers["web"].GetHealthTest(); len(test) != 0 {
+			t.Errorf("version 2 file was migrated: %v", test)
+		}
+	})
+
+	t.Run("RewriteYAML", func(t *testing.T) {
+		path := write(t, "stack.yaml", legacy)
+
+		changed, warnings, err := config.MigrateFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !changed || len(warnings) != 1 || !strings.Contains(warnings[0], "test_command") {
+			t.Fatalf("unexpected migration result %v %v", changed, warnings)
+		}
+
+		out, _ := os.ReadFile(path)
+		for _, want := range []string{"# web tier", "# pinned below", "version: 2", "containers:", "test: ["} {
+			if !strings.Contains(string(out), want) {
+				t.Errorf("migrated file misses %q:\n%s", want, out)
+			}
+		}
+		if strings.Contains(string(out), "test_command") {
+			t.Errorf("migrated file still uses test_command:\n%s", out)
+		}
+
+		changed, _, err = config.MigrateFile(path)
+		if err != nil || changed {
+			t.Errorf("current file rewritten again: %v %v", changed, err)
+		}
+
+		ulti, err := config.LoadContainersConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ulti.Containers["web"].GetHealthTest()) != 4 {
+			t.Errorf("migrated file lost the health check")
+		}
+	})
+
+	t.Run("RewriteJSON", func(t *testing.T) {
+		path := write(t, "stack.json", `[{"name": "web", "image": "nginx", "health_check": {"test_command": ["CMD", "true"]}}]`)
+
+		if _, _, err := config.MigrateFile(path); err != nil {
+			t.Fatal(err)
+		}
+		ulti, err := config.LoadContainersConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ulti.Containers["web"].GetHealthTest(), []string{"CMD", "true"}) {
+			t.Errorf("unexpected health test %v", ulti.Containers["web"].GetHealthTest())
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		path := write(t, "stack.yaml", "- name: web\n  image: nginx\n  health_check:\n    test: [CMD, a]\n    test_command: [CMD, b]\n")
+		if _, err := config.LoadContainersConfig(path); err == nil {
+			t.Error("expected error for both test and test_command")
+		}
+	})
+
+	t.Run("NewerVersion", func(t *testing.T) {
+		path := write(t, "stack.yaml", "version: 99\ncontainers: []\n")
+		if _, err := config.LoadContainersConfig(path); err == nil {
+			t.Error("expected error for unsupported version")
+		}
+	})
+
+	t.Run("Compose", func(t *testing.T) {
+		if _, _, err := config.MigrateFile("compose/docker-compose.yml"); err == nil {
+			t.Error("expected error for compose file")
+		}
+	})
+}
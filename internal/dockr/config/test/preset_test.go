@@ -0,0 +1,70 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPresets(t *testing.T) {
+
+	t.Run("Builtin", func(t *testing.T) {
+		names := config.DefaultPresets.Names()
+		for _, name := range []string{"postgres", "mongo", "redis", "nginx", "haproxy", "mumble", "teamspeak", "kong", "prometheus"} {
+			if !slices.Contains(names, name) {
+				t.Errorf("missing preset %s", name)
+			}
+		}
+
+		c, err := config.MergeDefaults(config.ContainerConfig{Preset: "redis", Image: "redis:7"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.ContainerService != config.Cache || c.Image != "redis:7" {
+			t.Errorf("unexpected config %+v", c)
+		}
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		if _, err := config.MergeDefaults(config.ContainerConfig{Preset: "nope"}); err == nil {
+			t.Errorf("expected error for unknown preset")
+		}
+	})
+
+	t.Run("LoadDir", func(t *testing.T) {
+		reg := config.NewPresetRegistry()
+		if err := reg.LoadDir("presets"); err != nil {
+			t.Fatal(err)
+		}
+
+		acme, err := reg.Lookup("acme-postgres")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if acme.Hostname != "acme-db" || acme.EnvVars["POSTGRES_DB"] != "acme" {
+			t.Errorf("house preset not applied: %+v", acme)
+		}
+		if acme.ContainerService != config.DB || !slices.Contains(acme.Credentials, "POSTGRES_PASSWORD") {
+			t.Errorf("parent preset not merged: %+v", acme)
+		}
+
+		if _, err = reg.Lookup("acme-redis"); err != nil {
+			t.Error(err)
+		}
+
+		if err = reg.LoadDir("presets"); err == nil {
+			t.Errorf("expected duplicate preset error")
+		}
+	})
+	t.Run("EmptyFile", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "blank.yaml"), []byte("# nothing yet\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.NewPresetRegistry().LoadDir(dir); err == nil {
+			t.Errorf("expected error for empty preset file")
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+
+	t.Run("Base", func(t *testing.T) {
+		ulti, err := config.LoadProfile("stack.yaml", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ulti.Names(), []string{"cache", "db", "debug"}) {
+			t.Errorf("unexpected containers %v", ulti.Names())
+		}
+	})
+
+	t.Run("Prod", func(t *testing.T) {
+		ulti, err := config.LoadProfile("stack.yaml", "prod")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ulti.Names(), []string{"cache", "db", "lb"}) {
+			t.Fatalf("unexpected containers %v", ulti.Names())
+		}
+
+		db := ulti.Containers["db"].GetFull()
+		if db.Image != "postgres:16.4" || db.LoadLevel != 2 || db.EnvVars["POSTGRES_DB"] != "prod" {
+			t.Errorf("overlay not applied: %+v", db)
+		}
+		if db.Hostname != config.PostgresConfig.Hostname {
+			t.Errorf("preset not merged: %s", db.Hostname)
+		}
+
+		cache := ulti.Containers["cache"].GetFull()
+		if !slices.Equal(cache.Ports, []string{"6379:6379", "16379:6379"}) {
+			t.Errorf("ports not appended: %v", cache.Ports)
+		}
+	})
+
+	t.Run("ZeroValues", func(t *testing.T) {
+		dir := t.TempDir()
+		base := filepath.Join(dir, "stack.yaml")
+		err := os.WriteFile(base, []byte(`
+- name: "worker"
+  image: "busybox:latest"
+  load_level: 2
+  tty: true
+  read_only: true
+  health_check:
+    test: ["CMD", "true"]
+    retries: 3
+`), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(config.ProfilePath(base, "small"), []byte(`
+- name: "worker"
+  load_level: 0
+  tty: false
+  read_only: false
+  health_check:
+    retries: 0
+`), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ulti, err := config.LoadProfile(base, "small")
+		if err != nil {
+			t.Fatal(err)
+		}
+		worker := ulti.Containers["worker"].GetFull()
+		if worker.LoadLevel != 0 || worker.Tty || worker.ReadOnly || worker.HealthCheck.Retries != 0 {
+			t.Errorf("zero values of the overlay not applied: %+v", worker)
+		}
+		if worker.Image != "busybox:latest" || len(worker.HealthCheck.Test) != 2 {
+			t.Errorf("keys missing in the overlay not inherited: %+v", worker)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		if _, err := config.LoadProfile("stack.yaml", "nope"); err == nil {
+			t.Errorf("expected error for missing overlay")
+		}
+	})
+
+	t.Run("Render", func(t *testing.T) {
+		ulti, err := config.LoadProfile("stack.yaml", "prod")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := ulti.Render("yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(out), "postgres:16.4") {
+			t.Errorf("rendered config misses overlay:\n%s", out)
+		}
+	})
+}
+
+func TestLoadFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	base := write("base.yaml", `
+- name: "db"
+  preset: "postgres"
+  image: "postgres:16"
+- name: "web"
+  image: "nginx:1.27"
+`)
+	override := write("override.yaml", `
+- name: "db"
+  image: "postgres:17"
+- name: "worker"
+  image: "busybox:latest"
+`)
+	write("override.prod.yaml", `
+- name: "worker"
+  enabled: false
+`)
+
+	t.Run("Merged", func(t *testing.T) {
+		ulti, err := config.LoadFiles([]string{base, override}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ulti.Names(), []string{"db", "web", "worker"}) {
+			t.Fatalf("unexpected containers %v", ulti.Names())
+		}
+		db := ulti.Containers["db"].GetFull()
+		if db.Image != "postgres:17" || db.Hostname != config.PostgresConfig.Hostname {
+			t.Errorf("override not merged over the base: %+v", db)
+		}
+	})
+
+	t.Run("Profile", func(t *testing.T) {
+		ulti, err := config.LoadFiles([]string{base, override}, "prod")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ulti.Names(), []string{"db", "web"}) {
+			t.Errorf("overlay of the second file not applied: %v", ulti.Names())
+		}
+	})
+
+	t.Run("MissingProfile", func(t *testing.T) {
+		if _, err := config.LoadFiles([]string{base, override}, "nope"); err == nil {
+			t.Errorf("expected error when no file has an overlay")
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"testing"
+)
+
+func TestPullPolicy(t *testing.T) {
+
+	t.Run("Default", func(t *testing.T) {
+		cases := map[string]string{
+			"nginx":                          config.PullAlways,
+			"nginx:latest":                   config.PullAlways,
+			"registry:5000/team/api":         config.PullAlways,
+			"nginx:1.27":                     config.PullIfNotPresent,
+			"registry:5000/team/api:2":       config.PullIfNotPresent,
+			"nginx@sha256:0123456789abcdef0": config.PullIfNotPresent,
+		}
+		for image, want := range cases {
+			if got := config.PullPolicyOf(&config.ContainerConfig{Image: image}, ""); got != want {
+				t.Errorf("%s: expected %s, got %s", image, want, got)
+			}
+		}
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		c := &config.ContainerConfig{Image: "nginx:latest"}
+		if got := config.PullPolicyOf(c, config.PullNever); got != config.PullNever {
+			t.Errorf("expected the global policy, got %s", got)
+		}
+		c.PullPolicy = config.PullIfNotPresent
+		if got := config.PullPolicyOf(c, config.PullNever); got != config.PullIfNotPresent {
+			t.Errorf("expected the container policy, got %s", got)
+		}
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		if policy, err := config.ParsePullPolicy("missing"); err != nil || policy != config.PullIfNotPresent {
+			t.Errorf("expected the compose spelling to be accepted, got %s %v", policy, err)
+		}
+		if _, err := config.NewContainersConfig(config.ContainerConfig{Name: "web", Image: "nginx", PullPolicy: "sometimes"}); err == nil {
+			t.Error("expected an invalid pull policy to fail")
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReplicas(t *testing.T) {
+
+	t.Run("Expand", func(t *testing.T) {
+		ulti, err := config.NewContainersConfig(
+			config.ContainerConfig{Name: "web", Image: "nginx:1.27", Replicas: 3},
+			config.ContainerConfig{Name: "db", Image: "postgres:16", Replicas: 1},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ulti.ExpandReplicas(); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ulti.Names(), []string{"db", "web", "web_2", "web_3"}) {
+			t.Fatalf("unexpected containers %v", ulti.Names())
+		}
+		for _, name := range ulti.Names() {
+			if c := ulti.Containers[name].GetFull(); c.Replicas != 0 || c.GetName() != name {
+				t.Errorf("replica %s: got name %s, replicas %d", name, c.GetName(), c.Replicas)
+			}
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		ulti, err := config.NewContainersConfig(
+			config.ContainerConfig{Name: "web", Image: "nginx:1.27", Replicas: 2},
+			config.ContainerConfig{Name: "web_2", Image: "nginx:1.27"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ulti.ExpandReplicas(); err == nil || !strings.Contains(err.Error(), "web_2") {
+			t.Errorf("expected duplicate replica error, got %v", err)
+		}
+	})
+
+	t.Run("Scale", func(t *testing.T) {
+		ulti, err := config.NewContainersConfig(
+			config.ContainerConfig{Name: "web", Image: "nginx:1.27"},
+			config.ContainerConfig{Name: "lb", Image: "nginx:1.27", Ports: []string{"80:80"}},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ulti.Scale("web", 2); err != nil {
+			t.Fatal(err)
+		}
+		if n := ulti.Containers["web"].GetFull().Replicas; n != 2 {
+			t.Errorf("expected 2 replicas, got %d", n)
+		}
+		if err = ulti.Scale("lb", 2); err == nil {
+			t.Errorf("expected error scaling a container with host ports")
+		}
+		if err = ulti.Scale("nope", 2); err == nil {
+			t.Errorf("expected error scaling an unknown container")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := config.NewContainersConfig(config.ContainerConfig{Name: "web", Image: "nginx:1.27", Replicas: -1})
+		if err == nil {
+			t.Errorf("expected error for negative replicas")
+		}
+	})
+}
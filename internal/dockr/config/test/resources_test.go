@@ -0,0 +1,144 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResources(t *testing.T) {
+
+	load := func(t *testing.T, content string) (*config.UltimateConfig, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "stack.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return config.LoadContainersConfig(path)
+	}
+
+	t.Run("ParseBytes", func(t *testing.T) {
+		cases := map[string]int64{
+			"512":   512,
+			"64k":   64 << 10,
+			"512Mi": 512 << 20,
+			"512m":  512 << 20,
+			"1.5G":  3 << 29,
+			"1gb":   1 << 30,
+			"2Ti":   2 << 40,
+			"1KiB":  1 << 10,
+			"3mb":   3 << 20,
+		}
+		for in, want := range cases {
+			got, err := config.ParseBytes(in)
+			if err != nil || got != want {
+				t.Errorf("ParseBytes(%q) = %d, %v, want %d", in, got, err, want)
+			}
+		}
+		for _, in := range []string{"", "x", "-1g", "1.5x", "512i", "1ib", "1kk", "5mbb", "1 g"} {
+			if _, err := config.ParseBytes(in); err == nil {
+				t.Errorf("ParseBytes(%q) should fail", in)
+			}
+		}
+	})
+
+	t.Run("Profiles", func(t *testing.T) {
+		ulti, err := load(t, `
+resource_profiles:
+  small:
+    profile: low
+    memory: 256Mi
+    ulimits:
+      nofile: 1024
+  tiny:
+    profile: small
+    cpus: "0.25"
+containers:
+  - name: cache
+    image: redis:7
+    resources:
+      profile: tiny
+      cpuset: "0-1"
+      ulimits:
+        nproc: {soft: 64, hard: 128}
+  - name: db
+    image: postgres:16
+    load_level: 2
+    resources:
+      memory: 8g
+`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := config.ContainerResources(ulti.Containers["cache"].GetFull())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Memory != 256<<20 || res.MemoryReservation != 256<<20 || res.MemorySwap != 256<<20 {
+			t.Errorf("unexpected memory %d / %d / %d", res.Memory, res.MemoryReservation, res.MemorySwap)
+		}
+		if res.NanoCPUs != 25e7 || res.CPUQuota != 0 || res.CPUShares != config.LowLoadConfig.CPUShares {
+			t.Errorf("unexpected cpu settings %d / %d / %d", res.NanoCPUs, res.CPUQuota, res.CPUShares)
+		}
+		if res.CpusetCpus != "0-1" || len(res.Ulimits) != 2 || res.Ulimits[0].Name != "nofile" || res.Ulimits[1].Hard != 128 {
+			t.Errorf("unexpected cpuset %s / ulimits %v", res.CpusetCpus, res.Ulimits)
+		}
+
+		res, err = config.ContainerResources(ulti.Containers["db"].GetFull())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Memory != 8<<30 || res.NanoCPUs != config.HighLoadConfig.NanoCPUs {
+			t.Errorf("load level not used as base: memory %d cpus %d", res.Memory, res.NanoCPUs)
+		}
+	})
+
+	t.Run("UlimitOverride", func(t *testing.T) {
+		ulti, err := load(t, `
+resource_profiles:
+  files:
+    profile: low
+    ulimits:
+      nofile: 1024
+      nproc: 64
+containers:
+  - name: api
+    image: api:1
+    resources:
+      profile: files
+      ulimits:
+        nofile: {soft: 4096, hard: 8192}
+`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := config.ContainerResources(ulti.Containers["api"].GetFull())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Ulimits) != 2 || res.Ulimits[0].Name != "nofile" || res.Ulimits[0].Hard != 8192 || res.Ulimits[1].Name != "nproc" {
+			t.Errorf("unexpected ulimits %v", res.Ulimits)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		cases := map[string]string{
+			"UnknownProfile": "- name: a\n  image: a\n  resources: {profile: nope}\n",
+			"Memory":         "- name: a\n  image: a\n  resources: {memory: lots}\n",
+			"Reservation":    "- name: a\n  image: a\n  resources: {memory: 1g, memory_reservation: 2g}\n",
+			"Swap":           "- name: a\n  image: a\n  resources: {memory: 1g, memory_swap: 512m}\n",
+			"Cpuset":         "- name: a\n  image: a\n  resources: {cpuset: \"0-\"}\n",
+			"Ulimit":         "- name: a\n  image: a\n  resources: {ulimits: {nofile: {soft: 10, hard: 1}}}\n",
+			"Builtin":        "resource_profiles: {low: {memory: 1g}}\ncontainers: []\n",
+			"Cycle":          "resource_profiles: {a: {profile: b}, b: {profile: a}}\ncontainers: [{name: a, image: a, resources: {profile: a}}]\n",
+		}
+		for name, content := range cases {
+			if _, err := load(t, content); err == nil {
+				t.Errorf("%s: expected error", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"testing"
+)
+
+type memStore map[string]map[string]string
+
+func (m memStore) GetSecret(service, key string) (string, bool) {
+	v, ok := m[service][key]
+	return v, ok
+}
+
+func (m memStore) SetSecret(service, key, value string) error {
+	if m[service] == nil {
+		m[service] = make(map[string]string)
+	}
+	m[service][key] = value
+	return nil
+}
+
+func TestSecrets(t *testing.T) {
+
+	gateway := config.ApiGatewayConfig
+
+	t.Run("Generate", func(t *testing.T) {
+		store := memStore{}
+
+		ulti, err := config.NewContainersConfig(config.PostgresConfig, gateway)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = config.ResolveSecrets(ulti, store); err != nil {
+			t.Fatal(err)
+		}
+
+		db := ulti.Containers["DB"].GetFull()
+		password := db.EnvVars["POSTGRES_PASSWORD"]
+		if len(password) != 32 {
+			t.Errorf("unexpected password %q", password)
+		}
+		if db.EnvVars["POSTGRES_USER"] == "" {
+			t.Errorf("user was not generated")
+		}
+		if store["DB"]["POSTGRES_PASSWORD"] != password {
+			t.Errorf("password was not persisted")
+		}
+
+		api := ulti.Containers["Server_add"].GetFull()
+		if api.EnvVars["KONG_PG_USER"] != db.EnvVars["POSTGRES_USER"] || api.EnvVars["KONG_PG_PASSWORD"] != password {
+			t.Errorf("reference resolved to %q", api.EnvVars["KONG_PG_PASSWORD"])
+		}
+
+		if config.ApiGatewayConfig.EnvVars["KONG_PG_PASSWORD"] != "${secret:DB.POSTGRES_PASSWORD}" {
+			t.Errorf("preset secret references were resolved in place")
+		}
+		if _, ok := config.PostgresConfig.EnvVars["POSTGRES_PASSWORD"]; ok {
+			t.Errorf("preset env vars were modified")
+		}
+	})
+
+	t.Run("Redeploy", func(t *testing.T) {
+		store := memStore{"DB": {"POSTGRES_USER": "kept", "POSTGRES_PASSWORD": "kept-password"}}
+
+		ulti, err := config.NewContainersConfig(config.PostgresConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = config.ResolveSecrets(ulti, store); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := ulti.Containers["DB"].GetFull().EnvVars["POSTGRES_PASSWORD"]; got != "kept-password" {
+			t.Errorf("credentials changed on redeploy: %q", got)
+		}
+	})
+
+	t.Run("UnknownReference", func(t *testing.T) {
+		ulti, err := config.NewContainersConfig(gateway)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = config.ResolveSecrets(ulti, memStore{}); err == nil {
+			t.Errorf("expected error for unknown secret reference")
+		}
+	})
+
+	t.Run("RegistryAuth", func(t *testing.T) {
+		auth := &config.RegistryAuthConfig{Username: "deploy", Password: "${secret:registry.TOKEN}"}
+		ulti, err := config.NewContainersConfig(config.ContainerConfig{Name: "api", Image: "ghcr.io/acme/api:1", RegistryAuth: auth})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = config.ResolveSecrets(ulti, memStore{"registry": {"TOKEN": "ghp-token"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := ulti.Containers["api"].GetFull().RegistryAuth; got.Username != "deploy" || got.Password != "ghp-token" {
+			t.Errorf("unexpected registry credentials %+v", got)
+		}
+		if auth.Password != "${secret:registry.TOKEN}" {
+			t.Errorf("config registry credentials were modified")
+		}
+	})
+}
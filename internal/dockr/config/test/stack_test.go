@@ -0,0 +1,61 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStack(t *testing.T) {
+
+	t.Run("Include", func(t *testing.T) {
+		ulti, err := config.LoadContainersConfig("multi/stack.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ulti.Names(), []string{"db", "lb", "monitoring", "mumble"}) {
+			t.Fatalf("unexpected containers %v", ulti.Names())
+		}
+
+		dir, _ := filepath.Abs("multi")
+
+		db := ulti.Containers["db"].GetFull()
+		if db.Source != filepath.Join(dir, "db.yaml") {
+			t.Errorf("unexpected source %s", db.Source)
+		}
+		want := []string{filepath.Join(dir, "data/postgres") + ":/var/lib/postgresql/data", "pgrun:/var/run/postgresql"}
+		if !slices.Equal(db.Volumes, want) {
+			t.Errorf("volumes not resolved: %v", db.Volumes)
+		}
+
+		lb := ulti.Containers["lb"].GetFull()
+		if lb.Volumes[0] != filepath.Join(dir, "nginx")+":/etc/nginx" {
+			t.Errorf("volume not resolved relative to including file: %v", lb.Volumes)
+		}
+	})
+
+	t.Run("Dir", func(t *testing.T) {
+		ulti, err := config.LoadDir("multi/voice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := ulti.Containers["mumble"]; !ok {
+			t.Errorf("mumble not loaded: %v", ulti.Names())
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		_, err := config.LoadContainersConfig("multi/duplicate.yaml")
+		if err == nil || !strings.Contains(err.Error(), "db.yaml") || !strings.Contains(err.Error(), "duplicate.yaml") {
+			t.Errorf("expected duplicate error naming both files, got %v", err)
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		if _, err := config.LoadContainersConfig("multi/cycle.yaml"); err == nil {
+			t.Errorf("expected include cycle error")
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestValidateRuntime(t *testing.T) {
+
+	valid := config.ContainerConfig{
+		Name:        "voice",
+		Image:       "voice:1",
+		Entrypoint:  []string{"/entrypoint.sh"},
+		User:        "1000:1000",
+		Labels:      map[string]string{"team": "voice"},
+		StopSignal:  "SIGINT",
+		StopTimeout: "45s",
+		CapAdd:      []string{"net_admin", "CAP_SYS_NICE"},
+		CapDrop:     []string{"ALL"},
+		SecurityOpt: []string{"no-new-privileges", "seccomp=unconfined"},
+		Sysctls:     map[string]string{"net.core.somaxconn": "1024"},
+		Devices:     []string{"/dev/snd", "/dev/ttyUSB0:/dev/modem:rw"},
+		DNS:         []string{"1.1.1.1", "2606:4700:4700::1111"},
+		DNSSearch:   []string{"voice.internal"},
+		ExtraHosts:  []string{"gateway:host-gateway", "db=10.0.0.2"},
+		Logging:     &config.LoggingConfig{Driver: "journald"},
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		ulti, err := config.NewContainersConfig(valid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := ulti.Containers["voice"]
+
+		if timeout := c.GetStopTimeout(); timeout == nil || *timeout != 45 {
+			t.Errorf("unexpected stop timeout %v", timeout)
+		}
+		if !slices.Equal(c.GetExtraHosts(), []string{"gateway:host-gateway", "db:10.0.0.2"}) {
+			t.Errorf("unexpected extra hosts %v", c.GetExtraHosts())
+		}
+		want := []container.DeviceMapping{
+			{PathOnHost: "/dev/snd", PathInContainer: "/dev/snd", CgroupPermissions: "rwm"},
+			{PathOnHost: "/dev/ttyUSB0", PathInContainer: "/dev/modem", CgroupPermissions: "rw"},
+		}
+		if !slices.Equal(c.GetDevices(), want) {
+			t.Errorf("unexpected devices %v", c.GetDevices())
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		cases := map[string]func(c *config.ContainerConfig){
+			"user":         func(c *config.ContainerConfig) { c.User = "app:group:extra" },
+			"infra.":       func(c *config.ContainerConfig) { c.Labels = map[string]string{"infra.name": "x"} },
+			"stop_signal":  func(c *config.ContainerConfig) { c.StopSignal = "sig int" },
+			"stop_timeout": func(c *config.ContainerConfig) { c.StopTimeout = "soon" },
+			"capability":   func(c *config.ContainerConfig) { c.CapAdd = []string{"NET_MAGIC"} },
+			"security_opt": func(c *config.ContainerConfig) { c.SecurityOpt = []string{"selinux=off"} },
+			"sysctl":       func(c *config.ContainerConfig) { c.Sysctls = map[string]string{"somaxconn": "1"} },
+			"device":       func(c *config.ContainerConfig) { c.Devices = []string{"/dev/snd:/dev/snd:rwx"} },
+			"dns server":   func(c *config.ContainerConfig) { c.DNS = []string{"dns.google"} },
+			"extra host":   func(c *config.ContainerConfig) { c.ExtraHosts = []string{"db"} },
+			"driver":       func(c *config.ContainerConfig) { c.Logging = &config.LoggingConfig{Options: map[string]string{"a": "b"}} },
+			"dockerfile":   func(c *config.ContainerConfig) { c.Build = &config.BuildConfig{Dockerfile: "../Dockerfile"} },
+		}
+		for want, mutate := range cases {
+			c := valid
+			mutate(&c)
+			_, err := config.NewContainersConfig(c)
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("expected an error about %s, got %v", want, err)
+			}
+		}
+	})
+}
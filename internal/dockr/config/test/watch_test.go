@@ -0,0 +1,128 @@
+package config_test
+
+import (
+	"Infra/internal/dockr/config"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+
+	write := func(t *testing.T, path, content string, mod time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// modification times are set explicitly, the filesystem may not have
+		// a fine enough resolution to tell quick edits apart
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Changed", func(t *testing.T) {
+		dir := t.TempDir()
+		stack := filepath.Join(dir, "stack.yaml")
+		now := time.Now()
+		write(t, stack, "include: [conf.d/*.yaml]\ncontainers:\n  - name: web\n    image: nginx:alpine\n", now)
+		os.Mkdir(filepath.Join(dir, "conf.d"), 0o755)
+
+		w := config.NewWatcher(stack, "", time.Millisecond)
+		conf, err := w.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(conf.Names(), []string{"web"}) {
+			t.Fatalf("unexpected containers %v", conf.Names())
+		}
+		if !slices.Equal(w.Files(), []string{filepath.Join(dir, "conf.d"), stack}) {
+			t.Errorf("unexpected watched files %v", w.Files())
+		}
+		if w.Changed() {
+			t.Fatal("unchanged files reported as changed")
+		}
+
+		write(t, filepath.Join(dir, "conf.d", "db.yaml"), "- name: db\n  image: postgres:16\n", now)
+		os.Chtimes(filepath.Join(dir, "conf.d"), now.Add(time.Second), now.Add(time.Second))
+		if !w.Changed() {
+			t.Fatal("new included file not detected")
+		}
+
+		conf, err = w.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(conf.Names(), []string{"db", "web"}) {
+			t.Fatalf("unexpected containers %v", conf.Names())
+		}
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		dir := t.TempDir()
+		stack := filepath.Join(dir, "stack.yaml")
+		now := time.Now()
+		write(t, stack, "- name: web\n  image: nginx:1.26\n", now)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		applied := make(chan *config.UltimateConfig)
+		done := make(chan error)
+		go func() {
+			done <- config.NewWatcher(stack, "", 10*time.Millisecond).Watch(ctx, func(c *config.UltimateConfig) error {
+				applied <- c
+				return nil
+			})
+		}()
+
+		image := func() string {
+			select {
+			case c := <-applied:
+				web, ok := c.Containers["web"]
+				if !ok {
+					t.Fatalf("applied config without web: %v", c.Names())
+				}
+				return web.GetImage()
+			case <-ctx.Done():
+				t.Fatal("config not applied")
+			}
+			return ""
+		}
+
+		if img := image(); img != "nginx:1.26" {
+			t.Fatalf("unexpected initial image %s", img)
+		}
+
+		// an invalid edit is rejected, the next valid one is applied
+		write(t, stack, "- name: web\n  preset: nope\n", now.Add(time.Second))
+		time.Sleep(50 * time.Millisecond)
+		write(t, stack, "- name: web\n  image: nginx:1.27\n", now.Add(2*time.Second))
+
+		if img := image(); img != "nginx:1.27" {
+			t.Fatalf("unexpected image after edit %s", img)
+		}
+
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("InvalidInitial", func(t *testing.T) {
+		dir := t.TempDir()
+		stack := filepath.Join(dir, "stack.yaml")
+		write(t, stack, "- name: web\n  preset: nope\n", time.Now())
+
+		err := config.NewWatcher(stack, "", time.Millisecond).Watch(context.Background(), func(*config.UltimateConfig) error {
+			t.Error("invalid config applied")
+			return nil
+		})
+		if err == nil {
+			t.Error("expected error for invalid config")
+		}
+	})
+}
@@ -1,11 +1,11 @@
 package config
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"maps"
+	"slices"
+	"strings"
 
 	"sync"
 	"gopkg.in/yaml.v3"
@@ -24,53 +24,216 @@ func (c *UltimateConfig) GetContainerType(containerType string) ContainerConfigu
 }
 
 func NewContainersConfig(configs ...ContainerConfig) (*UltimateConfig, error) {
-	ult := &UltimateConfig{
-		Containers: make(map[string]ContainerConfiguration, len(configs)),
-	}
+	conf := make([]*ContainerConfig, 0, len(configs))
 	for _, config := range configs {
-				ult.Containers[config.ContainerService] = &config
+		conf = append(conf, &config)
 	}
-
-	log.Printf("loaded %v configs\n", len(ult.Containers))
-	return ult, nil
+	return newUltimateConfig(&stackFile{Containers: conf})
 }
 
 func LoadContainersConfig(path string) (*UltimateConfig, error) {
+	return LoadContainersConfigAs(path, "")
+}
 
-	conf := make([]*ContainerConfig, 0)
-	
-	if path == "" {
-		return nil, fmt.Errorf("config file path is empty")
+// LoadContainersConfigAs loads a config file in an explicit format regardless
+// of its extension, included files are detected by their own extension.
+func LoadContainersConfigAs(path string, format Format) (*UltimateConfig, error) {
+	conf, err := hostFS.readConfigFile(path, format)
+	if err != nil {
+		return nil, err
 	}
+	return newUltimateConfig(conf)
+}
 
-	file, err := os.ReadFile(path)
+// decodeConfig decodes a single config file read from path, either a list of
+// containers, a stack file or a compose file. An empty format is detected by
+// extension.
+func decodeConfig(file []byte, path string, format Format) (*stackFile, error) {
+	var err error
+	if format == "" {
+		if format, err = FormatFromPath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, err := decodeDocument(file, format)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal config file %s: %w", path, err)
 	}
 
-	ext := filepath.Ext(path)
+	stack := &stackFile{}
+	switch root := doc.(type) {
+	case nil:
+	case []any:
+		err = decodeStack(root, path, stack)
+	case map[string]any:
+		if _, ok := root["services"]; ok {
+			return decodeComposeDocument(root, path)
+		}
+		err = decodeStack(root, path, stack)
+	default:
+		err = fmt.Errorf("expected a list of containers or a stack mapping")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config file %s: %w", path, err)
+	}
+	return stack, nil
+}
 
-	switch ext {
-	case ".yaml", ".yml":
-		err = yaml.Unmarshal(file, &conf)
-		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal config file: %w", err)
+// decodeStack migrates a list of containers or a stack mapping to the current
+// version and decodes it into stack.
+func decodeStack(doc any, path string, stack *stackFile) error {
+	node, err := migrateDocument(doc, path)
+	if err != nil {
+		return err
+	}
+	return node.Decode(stack)
+}
+
+func decodeComposeDocument(doc map[string]any, path string) (*stackFile, error) {
+	raw, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal compose file %s: %w", path, err)
+	}
+
+	conf, warnings, err := decodeCompose(raw, path)
+	for _, w := range warnings {
+		log.Printf("%s: %s\n", path, w)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stackFile{Containers: conf}, nil
+}
+
+// newUltimateConfig drops disabled containers, merges presets, resolves the
+// resource profiles, names built images, validates the runtime settings and keys the containers
+// by name.
+func newUltimateConfig(stack *stackFile) (*UltimateConfig, error) {
+	ulti := make(map[string]ContainerConfiguration, len(stack.Containers))
+	for _, c := range stack.Containers {
+		if !c.GetEnabled() {
+			log.Printf("container %s is disabled, skipping\n", c.GetName())
+			continue
 		}
-	case ".json":
-		err = json.Unmarshal(file, &conf)
+
+		merged, err := MergeDefaults(*c)
 		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal config file: %w", err)
+			return nil, sourceError(c, err)
+		}
+		// the keys of the files only matter for merging
+		merged.keys = nil
+		if err = resolveResources(&merged, stack.ResourceProfiles); err != nil {
+			return nil, sourceError(c, err)
+		}
+		if merged.Build != nil && merged.Image == "" {
+			// built images without a name are tagged after their container
+			merged.Image = "infra/" + strings.ToLower(merged.GetName()) + ":latest"
+		}
+		if err = validateRuntime(&merged); err != nil {
+			return nil, sourceError(c, fmt.Errorf("container %s: %w", merged.GetName(), err))
 		}
-	default:
-		return nil, fmt.Errorf("unsupported config file extension: %s", ext)
-	}
 
-	ulti := make(map[string]ContainerConfiguration, 0)
-	for _, c := range conf {
-		ulti[c.ContainerService] = c
+		name := merged.GetName()
+		if prev, ok := ulti[name]; ok {
+			return nil, sourceError(c, fmt.Errorf("duplicate container name: %s (first defined in %s)", name, sourceName(prev.GetFull())))
+		}
+		ulti[name] = &merged
 	}
 
 	log.Printf("loaded %v configs\n", len(ulti))
 	
-	return &UltimateConfig{Containers: ulti}, nil
+	return &UltimateConfig{Containers: ulti, mu: &sync.RWMutex{}}, nil
+}
+
+// Clone returns a deep copy of c, so that resolving secrets, pinning images
+// or expanding replicas on it leaves c as loaded.
+func (c *UltimateConfig) Clone() *UltimateConfig {
+	containers := make(map[string]ContainerConfiguration, len(c.Containers))
+	for name, v := range c.Containers {
+		containers[name] = v.GetFull().clone()
+	}
+	return &UltimateConfig{Containers: containers, mu: &sync.RWMutex{}}
+}
+
+// clone returns a deep copy of c.
+func (c *ContainerConfig) clone() *ContainerConfig {
+	clone := *c
+	clone.keys = maps.Clone(c.keys)
+	clone.Enabled = clonePtr(c.Enabled)
+	clone.Init = clonePtr(c.Init)
+	if c.RegistryAuth != nil {
+		auth := *c.RegistryAuth
+		clone.RegistryAuth = &auth
+	}
+	if c.Build != nil {
+		build := *c.Build
+		build.Args = maps.Clone(c.Build.Args)
+		build.Labels = maps.Clone(c.Build.Labels)
+		build.CacheFrom = slices.Clone(c.Build.CacheFrom)
+		clone.Build = &build
+	}
+	if c.Resources != nil {
+		res := *c.Resources
+		res.PidsLimit = clonePtr(c.Resources.PidsLimit)
+		res.Ulimits = maps.Clone(c.Resources.Ulimits)
+		clone.Resources = &res
+	}
+	if c.Logging != nil {
+		logging := *c.Logging
+		logging.Options = maps.Clone(c.Logging.Options)
+		clone.Logging = &logging
+	}
+
+	clone.EnvVars = maps.Clone(c.EnvVars)
+	clone.Labels = maps.Clone(c.Labels)
+	clone.Sysctls = maps.Clone(c.Sysctls)
+	clone.Credentials = slices.Clone(c.Credentials)
+	clone.Cmd = slices.Clone(c.Cmd)
+	clone.Entrypoint = slices.Clone(c.Entrypoint)
+	clone.Volumes = slices.Clone(c.Volumes)
+	clone.Ports = slices.Clone(c.Ports)
+	clone.CapAdd = slices.Clone(c.CapAdd)
+	clone.CapDrop = slices.Clone(c.CapDrop)
+	clone.SecurityOpt = slices.Clone(c.SecurityOpt)
+	clone.Devices = slices.Clone(c.Devices)
+	clone.DNS = slices.Clone(c.DNS)
+	clone.DNSSearch = slices.Clone(c.DNSSearch)
+	clone.ExtraHosts = slices.Clone(c.ExtraHosts)
+	clone.DependsOn = slices.Clone(c.DependsOn)
+	clone.HealthCheck.Test = slices.Clone(c.HealthCheck.Test)
+	return &clone
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// Names returns the container names in sorted order.
+func (c *UltimateConfig) Names() []string {
+	names := make([]string, 0, len(c.Containers))
+	for name := range c.Containers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func sourceName(c *ContainerConfig) string {
+	if c.Source == "" {
+		return "<inline>"
+	}
+	return c.Source
+}
+
+// sourceError prefixes err with the file the container was defined in.
+func sourceError(c *ContainerConfig, err error) error {
+	if c.Source == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", c.Source, err)
 }
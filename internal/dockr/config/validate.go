@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+// capabilities are the Linux capabilities Docker can add or drop, without
+// their CAP_ prefix.
+var capabilities = []string{
+	"AUDIT_CONTROL", "AUDIT_READ", "AUDIT_WRITE", "BLOCK_SUSPEND", "BPF",
+	"CHECKPOINT_RESTORE", "CHOWN", "DAC_OVERRIDE", "DAC_READ_SEARCH", "FOWNER",
+	"FSETID", "IPC_LOCK", "IPC_OWNER", "KILL", "LEASE", "LINUX_IMMUTABLE",
+	"MAC_ADMIN", "MAC_OVERRIDE", "MKNOD", "NET_ADMIN", "NET_BIND_SERVICE",
+	"NET_BROADCAST", "NET_RAW", "PERFMON", "SETFCAP", "SETGID", "SETPCAP",
+	"SETUID", "SYSLOG", "SYS_ADMIN", "SYS_BOOT", "SYS_CHROOT", "SYS_MODULE",
+	"SYS_NICE", "SYS_PACCT", "SYS_PTRACE", "SYS_RAWIO", "SYS_RESOURCE",
+	"SYS_TIME", "SYS_TTY_CONFIG", "WAKE_ALARM",
+}
+
+// securityOptions are the keys of the security_opt entries.
+var securityOptions = []string{"apparmor", "label", "no-new-privileges", "seccomp", "systempaths", "writable-cgroups"}
+
+var (
+	userPattern   = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*(:[A-Za-z0-9_][A-Za-z0-9_.-]*)?$`)
+	signalPattern = regexp.MustCompile(`^(SIG)?[A-Z][A-Z0-9+-]*$|^[0-9]+$`)
+	sysctlPattern = regexp.MustCompile(`^[a-z0-9_]+(\.[a-z0-9_-]+)+$`)
+	hostPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+)
+
+// validateRuntime checks the runtime settings of c that Docker would only
+// reject when the container is created.
+func validateRuntime(c *ContainerConfig) error {
+	if c.PullPolicy != "" && !slices.Contains(pullPolicies, c.PullPolicy) {
+		return fmt.Errorf("invalid pull_policy %q, expected one of %s", c.PullPolicy, strings.Join(pullPolicies, ", "))
+	}
+	if c.User != "" && !userPattern.MatchString(c.User) {
+		return fmt.Errorf("invalid user %q, expected user[:group]", c.User)
+	}
+	for key := range c.Labels {
+		if strings.HasPrefix(key, "infra.") {
+			return fmt.Errorf("label %s: the infra. prefix is reserved", key)
+		}
+	}
+	if c.StopSignal != "" && !signalPattern.MatchString(c.StopSignal) {
+		return fmt.Errorf("invalid stop_signal %q", c.StopSignal)
+	}
+	if c.StopTimeout != "" {
+		if timeout, err := time.ParseDuration(c.StopTimeout); err != nil || timeout < 0 {
+			return fmt.Errorf("invalid stop_timeout %q", c.StopTimeout)
+		}
+	}
+
+	for _, list := range []struct {
+		key  string
+		caps []string
+	}{{"cap_add", c.CapAdd}, {"cap_drop", c.CapDrop}} {
+		for _, capability := range list.caps {
+			name := strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+			if name != "ALL" && !slices.Contains(capabilities, name) {
+				return fmt.Errorf("%s: unknown capability %s", list.key, capability)
+			}
+		}
+	}
+	for _, opt := range c.SecurityOpt {
+		// docker still reads key:value, the form before key=value
+		key, _, _ := strings.Cut(opt, "=")
+		if key == opt {
+			key, _, _ = strings.Cut(opt, ":")
+		}
+		if !slices.Contains(securityOptions, key) {
+			return fmt.Errorf("invalid security_opt %q", opt)
+		}
+	}
+	for key := range c.Sysctls {
+		if !sysctlPattern.MatchString(key) {
+			return fmt.Errorf("invalid sysctl %q", key)
+		}
+	}
+
+	for _, d := range c.Devices {
+		if _, err := parseDevice(d); err != nil {
+			return err
+		}
+	}
+	for _, server := range c.DNS {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("invalid dns server %q", server)
+		}
+	}
+	for _, domain := range c.DNSSearch {
+		if domain != "." && !hostPattern.MatchString(domain) {
+			return fmt.Errorf("invalid dns_search domain %q", domain)
+		}
+	}
+	for _, h := range c.ExtraHosts {
+		if _, _, err := parseExtraHost(h); err != nil {
+			return err
+		}
+	}
+
+	if _, _, err := nat.ParsePortSpecs(c.Ports); err != nil {
+		return fmt.Errorf("invalid ports: %w", err)
+	}
+
+	if c.Replicas < 0 {
+		return fmt.Errorf("invalid replicas %d", c.Replicas)
+	}
+	if c.Replicas > 1 && len(c.Ports) > 0 {
+		return fmt.Errorf("%d replicas cannot publish the same host ports", c.Replicas)
+	}
+
+	if c.Logging != nil && c.Logging.Driver == "" && len(c.Logging.Options) > 0 {
+		return fmt.Errorf("logging options need a driver")
+	}
+	if c.Build != nil && c.Build.Dockerfile != "" {
+		dockerfile := path.Clean(filepath.ToSlash(c.Build.Dockerfile))
+		if path.IsAbs(dockerfile) || dockerfile == ".." || strings.HasPrefix(dockerfile, "../") {
+			return fmt.Errorf("build dockerfile %q must be inside the build context", c.Build.Dockerfile)
+		}
+	}
+	return nil
+}
+
+// parseDevice parses a device mapping, "host[:container[:permissions]]".
+func parseDevice(s string) (container.DeviceMapping, error) {
+	parts := strings.Split(s, ":")
+	device := container.DeviceMapping{
+		PathOnHost:        parts[0],
+		PathInContainer:   parts[0],
+		CgroupPermissions: "rwm",
+	}
+
+	switch len(parts) {
+	case 1:
+	case 2:
+		// "host:rw" sets the permissions only
+		if strings.HasPrefix(parts[1], "/") {
+			device.PathInContainer = parts[1]
+		} else {
+			device.CgroupPermissions = parts[1]
+		}
+	case 3:
+		device.PathInContainer, device.CgroupPermissions = parts[1], parts[2]
+	default:
+		return device, fmt.Errorf("invalid device %q", s)
+	}
+
+	if !path.IsAbs(device.PathOnHost) || !path.IsAbs(device.PathInContainer) {
+		return device, fmt.Errorf("invalid device %q, paths must be absolute", s)
+	}
+	if device.CgroupPermissions == "" || strings.Trim(device.CgroupPermissions, "rwm") != "" {
+		return device, fmt.Errorf("invalid device %q, permissions are a combination of r, w and m", s)
+	}
+	return device, nil
+}
+
+// parseExtraHost parses an extra host, "host:ip" or "host=ip". The IP may be
+// host-gateway, which Docker replaces with the IP of the host.
+func parseExtraHost(s string) (string, string, error) {
+	host, ip, ok := strings.Cut(s, "=")
+	if !ok {
+		host, ip, ok = strings.Cut(s, ":")
+	}
+	if !ok || !hostPattern.MatchString(host) || (ip != "host-gateway" && net.ParseIP(ip) == nil) {
+		return "", "", fmt.Errorf("invalid extra host %q, expected host:ip", s)
+	}
+	return host, ip, nil
+}
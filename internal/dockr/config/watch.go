@@ -0,0 +1,164 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultWatchInterval is the polling interval of a Watcher created without one.
+const DefaultWatchInterval = 2 * time.Second
+
+// Watcher reloads the config files, with their includes and profile
+// overlays, when any of the files they were loaded from changes. Changes are detected by polling
+// modification times and sizes, which also catches editors that replace the
+// file on save and directories gaining files matched by an include glob.
+type Watcher struct {
+	paths    []string
+	profile  string
+	interval time.Duration
+
+	stamps map[string]fileStamp
+}
+
+type fileStamp struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher returns a Watcher of the config at path with the overlay of
+// profile applied (see LoadProfile).
+func NewWatcher(path, profile string, interval time.Duration) *Watcher {
+	return NewFilesWatcher([]string{path}, profile, interval)
+}
+
+// NewFilesWatcher returns a Watcher of the config files at paths loaded as
+// one config with the overlays of profile applied (see LoadFiles).
+func NewFilesWatcher(paths []string, profile string, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	return &Watcher{paths: paths, profile: profile, interval: interval}
+}
+
+// Load loads the configuration and remembers the files it was read from. The
+// files are remembered even when loading fails, so a broken file is reloaded
+// once it changes again rather than on every poll.
+func (w *Watcher) Load() (*UltimateConfig, error) {
+	files := make(map[string]struct{})
+	conf, err := configFS{files: files}.loadFiles(w.paths, w.profile)
+
+	w.stamps = make(map[string]fileStamp, len(files))
+	for f := range files {
+		w.stamps[f] = stamp(f)
+	}
+	return conf, err
+}
+
+// Changed reports whether any file of the last Load changed since.
+func (w *Watcher) Changed() bool {
+	return !stampsEqual(w.stamps, w.current())
+}
+
+func (w *Watcher) current() map[string]fileStamp {
+	cur := make(map[string]fileStamp, len(w.stamps))
+	for f := range w.stamps {
+		cur[f] = stamp(f)
+	}
+	return cur
+}
+
+// Files returns the sorted files and directories the last Load read from.
+func (w *Watcher) Files() []string {
+	files := make([]string, 0, len(w.stamps))
+	for f := range w.stamps {
+		files = append(files, f)
+	}
+	slices.Sort(files)
+	return files
+}
+
+// Watch loads the configuration, passes it to apply and does so again every
+// time the files change, until ctx is done. Changed files are reloaded once
+// they stayed the same for an interval, so a file is not read while it is
+// being written. An invalid initial configuration is returned as an error;
+// later invalid edits are logged and skipped, so apply only ever sees
+// configurations that loaded and validated. Errors of apply are logged, the
+// next change is applied again.
+func (w *Watcher) Watch(ctx context.Context, apply func(*UltimateConfig) error) error {
+	if slices.Contains(w.paths, Stdin) {
+		return fmt.Errorf("cannot watch stdin")
+	}
+	name := strings.Join(w.paths, ", ")
+
+	conf, err := w.Load()
+	if err != nil {
+		return err
+	}
+	if err = apply(conf); err != nil {
+		log.Printf("failed to apply %s: %v\n", name, err)
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	var settling map[string]fileStamp
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		cur := w.current()
+		if stampsEqual(w.stamps, cur) {
+			settling = nil
+			continue
+		}
+		if !stampsEqual(settling, cur) {
+			settling = cur
+			continue
+		}
+		settling = nil
+
+		conf, err := w.Load()
+		if err != nil {
+			log.Printf("rejected change of %s, keeping the current deployment: %v\n", name, err)
+			continue
+		}
+		log.Printf("%s changed, applying\n", name)
+		if err = apply(conf); err != nil {
+			log.Printf("failed to apply %s: %v\n", name, err)
+		}
+	}
+}
+
+func stamp(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, modTime: info.ModTime(), size: info.Size()}
+}
+
+func (s fileStamp) equal(o fileStamp) bool {
+	return s.exists == o.exists && s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+func stampsEqual(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for f, s := range a {
+		o, ok := b[f]
+		if !ok || !s.equal(o) {
+			return false
+		}
+	}
+	return true
+}
@@ -2,10 +2,12 @@ package entity
 
 import (
 	"Infra/internal/dockr/config"
+	"fmt"
 	"sync"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
 )
 
 var _ ContainerConfiguration = &containerEntity{}
@@ -51,14 +53,13 @@ type containerEntity struct {
 
 func NewContainer(conf config.ContainerConfiguration) (ContainerConfiguration, error) {
 
-	var res = container.Resources{}
-
-	switch conf.GetLoadLevel() {
-		case 0: res = config.LowLoadConfig
-		case 1: res = config.MediumLoadConfig
-		case 2: res = config.HighLoadConfig
-		default:
-		res = config.MediumLoadConfig
+	res, err := config.ContainerResources(conf.GetFull())
+	if err != nil {
+		return nil, fmt.Errorf("container %s: %s", conf.GetName(), err)
+	}
+	shm, err := conf.GetFull().Resources.ShmBytes()
+	if err != nil {
+		return nil, fmt.Errorf("container %s: %s", conf.GetName(), err)
 	}
 
 	containerConfig := &container.Config{
@@ -67,6 +68,12 @@ func NewContainer(conf config.ContainerConfiguration) (ContainerConfiguration, e
 		Hostname: conf.GetHostname(),
 		WorkingDir: conf.GetWorkingDir(),
 		Cmd: conf.GetCMD(),
+		Entrypoint: conf.GetEntrypoint(),
+		User: conf.GetUser(),
+		Labels: conf.GetLabels(),
+		StopSignal: conf.GetStopSignal(),
+		StopTimeout: conf.GetStopTimeout(),
+		Tty: conf.GetTty(),
 	}
 
 	hostConfig := &container.HostConfig{
@@ -75,7 +82,20 @@ func NewContainer(conf config.ContainerConfiguration) (ContainerConfiguration, e
 		PortBindings: conf.GetPorts(),
 		RestartPolicy: conf.GetRestartPolicy(),
 		Resources: res,
+		ShmSize: shm,
+		CapAdd: conf.GetCapAdd(),
+		CapDrop: conf.GetCapDrop(),
+		Privileged: conf.GetPrivileged(),
+		ReadonlyRootfs: conf.GetReadOnly(),
+		SecurityOpt: conf.GetSecurityOpt(),
+		Sysctls: conf.GetSysctls(),
+		DNS: conf.GetDNS(),
+		DNSSearch: conf.GetDNSSearch(),
+		ExtraHosts: conf.GetExtraHosts(),
+		Init: conf.GetInit(),
+		LogConfig: conf.GetLogConfig(),
 	}
+	hostConfig.Devices = conf.GetDevices()
 	
 	healthCheckConfig := &container.HealthConfig{
 			Test:        conf.GetHealthTest(),       
@@ -84,13 +104,31 @@ func NewContainer(conf config.ContainerConfiguration) (ContainerConfiguration, e
 			Retries:     conf.GetHealthRetries(),    
 			StartPeriod: conf.GetHealthStartPeriod(),
 	}
-	networkConfig := &network.NetworkingConfig{
-			EndpointsConfig: map[string]*network.EndpointSettings{
-				conf.GetNetworkID(): {
-					NetworkID: conf.GetNetworkID(),
-					Aliases:   []string{conf.GetHostname()},
-				},
-			},
+	if len(healthCheckConfig.Test) > 0 {
+		containerConfig.Healthcheck = healthCheckConfig
+	}
+
+	// published ports have to be exposed as well
+	if len(hostConfig.PortBindings) > 0 {
+		containerConfig.ExposedPorts = make(nat.PortSet, len(hostConfig.PortBindings))
+		for port := range hostConfig.PortBindings {
+			containerConfig.ExposedPorts[port] = struct{}{}
+		}
+	}
+
+	// the hostname alias only resolves on a user defined network, so the
+	// container joins it instead of the default bridge; the container name
+	// resolves there without an alias
+	networkConfig := &network.NetworkingConfig{}
+	if id := conf.GetNetworkID(); id != "" {
+		endpoint := &network.EndpointSettings{NetworkID: id}
+		if hostname := conf.GetHostname(); hostname != "" {
+			endpoint.Aliases = []string{hostname}
+		}
+		networkConfig.EndpointsConfig = map[string]*network.EndpointSettings{id: endpoint}
+		if mode := hostConfig.NetworkMode; mode == "" || mode.IsBridge() || mode.IsDefault() {
+			hostConfig.NetworkMode = container.NetworkMode(id)
+		}
 	}
 
 	return &containerEntity{
@@ -76,4 +76,90 @@ func TestContainer(t *testing.T) {
 		
 		fmt.Println("created containers: ", len(ultiContainer.Containers))
 	}) 
-}
\ No newline at end of file
+
+	t.Run("Runtime", func(t *testing.T) {
+		enabled := true
+		cont, err := entity.NewContainer(&config.ContainerConfig{
+			Name:        "voice",
+			Image:       "voice:1",
+			Entrypoint:  []string{"/entrypoint.sh"},
+			User:        "1000",
+			StopTimeout: "1m",
+			CapDrop:     []string{"ALL"},
+			ReadOnly:    true,
+			Devices:     []string{"/dev/snd"},
+			ExtraHosts:  []string{"db=10.0.0.2"},
+			Init:        &enabled,
+			Logging:     &config.LoggingConfig{Driver: "journald"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conf, host := cont.GetConfig(), cont.GetHostConfig()
+		if conf.Entrypoint[0] != "/entrypoint.sh" || conf.User != "1000" || conf.StopTimeout == nil || *conf.StopTimeout != 60 {
+			t.Errorf("unexpected container config %+v", conf)
+		}
+		if !host.ReadonlyRootfs || host.CapDrop[0] != "ALL" || host.Init == nil || !*host.Init {
+			t.Errorf("unexpected host config %+v", host)
+		}
+		if len(host.Devices) != 1 || host.Devices[0].PathInContainer != "/dev/snd" {
+			t.Errorf("unexpected devices %v", host.Devices)
+		}
+		if host.ExtraHosts[0] != "db:10.0.0.2" || host.LogConfig.Type != "journald" {
+			t.Errorf("unexpected extra hosts %v / log config %v", host.ExtraHosts, host.LogConfig)
+		}
+	})
+
+	t.Run("NetworkAliases", func(t *testing.T) {
+		for hostname, want := range map[string]int{"": 0, "voice-1": 1} {
+			cont, err := entity.NewContainer(&config.ContainerConfig{
+				Name:      "voice",
+				Image:     "voice:1",
+				Hostname:  hostname,
+				NetworkID: "voice-network",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			endpoint := cont.GetNetworkConfig().EndpointsConfig["voice-network"]
+			if endpoint == nil || len(endpoint.Aliases) != want || (want == 1 && endpoint.Aliases[0] != hostname) {
+				t.Errorf("hostname %q: unexpected endpoint %+v", hostname, endpoint)
+			}
+		}
+	})
+
+	t.Run("Spec", func(t *testing.T) {
+		cont, err := entity.NewContainer(&config.ContainerConfig{
+			Name:    "web",
+			Image:   "nginx:alpine",
+			EnvVars: map[string]string{"B": "2", "A": "1"},
+			Labels:  map[string]string{"team": "edge"},
+			Ports:   []string{"8443:443", "8080:80"},
+			HealthCheck: config.HealthCheckConfig{
+				Interval: "30s",
+				Test:     []string{"CMD", "true"},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		spec := entity.NewSpec(cont)
+		if spec.Name != "web" || spec.Image != "nginx:alpine" {
+			t.Errorf("unexpected spec %+v", spec)
+		}
+		if len(spec.Env) < 2 || spec.Env[0] != "A=1" || spec.Env[1] != "B=2" {
+			t.Errorf("env not sorted: %v", spec.Env)
+		}
+		if len(spec.Labels) != 1 || spec.Labels["team"] != "edge" {
+			t.Errorf("unexpected labels %v", spec.Labels)
+		}
+		if len(spec.Ports) < 2 || spec.Ports[0].ContainerPort != 80 || spec.Ports[len(spec.Ports)-1].ContainerPort != 443 {
+			t.Errorf("ports not sorted: %+v", spec.Ports)
+		}
+		if spec.HealthCheck == nil || spec.HealthCheck.Interval != "30s" {
+			t.Errorf("unexpected health check %+v", spec.HealthCheck)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package entity
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// Spec is the documented JSON and YAML form of a container: the Docker
+// settings Infra creates it with. Fields are only ever added to it, scripts
+// can rely on the existing ones.
+type Spec struct {
+	Name          string            `json:"name" yaml:"name"`
+	Service       string            `json:"service,omitempty" yaml:"service,omitempty"`
+	Image         string            `json:"image" yaml:"image"`
+	Hostname      string            `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	Cmd           []string          `json:"cmd,omitempty" yaml:"cmd,omitempty"`
+	Entrypoint    []string          `json:"entrypoint,omitempty" yaml:"entrypoint,omitempty"`
+	WorkingDir    string            `json:"working_dir,omitempty" yaml:"working_dir,omitempty"`
+	User          string            `json:"user,omitempty" yaml:"user,omitempty"`
+	Env           []string          `json:"env,omitempty" yaml:"env,omitempty"`       // KEY=VALUE, secrets as ${secret:...} references
+	Labels        map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"` // labels of the config, without the infra. labels
+	Ports         []Port            `json:"ports,omitempty" yaml:"ports,omitempty"`
+	Volumes       []string          `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+	Network       string            `json:"network,omitempty" yaml:"network,omitempty"`
+	NetworkMode   string            `json:"network_mode,omitempty" yaml:"network_mode,omitempty"`
+	RestartPolicy string            `json:"restart_policy,omitempty" yaml:"restart_policy,omitempty"`
+	Resources     SpecResources     `json:"resources" yaml:"resources"`
+	HealthCheck   *SpecHealthCheck  `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+	DependsOn     []string          `json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
+}
+
+// Port is a published port of a Spec.
+type Port struct {
+	HostIP        string `json:"host_ip,omitempty" yaml:"host_ip,omitempty"`
+	HostPort      string `json:"host_port,omitempty" yaml:"host_port,omitempty"`
+	ContainerPort int    `json:"container_port" yaml:"container_port"`
+	Protocol      string `json:"protocol" yaml:"protocol"`
+}
+
+// SpecResources are the effective resource limits of a Spec, zero is
+// unlimited.
+type SpecResources struct {
+	NanoCPUs          int64 `json:"nano_cpus,omitempty" yaml:"nano_cpus,omitempty"`
+	CPUShares         int64 `json:"cpu_shares,omitempty" yaml:"cpu_shares,omitempty"`
+	Memory            int64 `json:"memory,omitempty" yaml:"memory,omitempty"` // bytes
+	MemoryReservation int64 `json:"memory_reservation,omitempty" yaml:"memory_reservation,omitempty"`
+	PidsLimit         int64 `json:"pids_limit,omitempty" yaml:"pids_limit,omitempty"`
+	ShmSize           int64 `json:"shm_size,omitempty" yaml:"shm_size,omitempty"`
+}
+
+// SpecHealthCheck is the health check of a Spec, durations as Go durations
+// (e.g. "30s").
+type SpecHealthCheck struct {
+	Test        []string `json:"test" yaml:"test"`
+	Interval    string   `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout     string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	StartPeriod string   `json:"start_period,omitempty" yaml:"start_period,omitempty"`
+	Retries     int      `json:"retries,omitempty" yaml:"retries,omitempty"`
+}
+
+// NewSpec returns the Spec of a container.
+func NewSpec(c ContainerConfiguration) Spec {
+	conf, host := c.GetConfig(), c.GetHostConfig()
+	app := c.GetContainerConfig()
+
+	spec := Spec{
+		Name:          app.GetName(),
+		Service:       app.GetService(),
+		Image:         conf.Image,
+		Hostname:      conf.Hostname,
+		Cmd:           conf.Cmd,
+		Entrypoint:    conf.Entrypoint,
+		WorkingDir:    conf.WorkingDir,
+		User:          conf.User,
+		Env:           slices.Sorted(slices.Values(conf.Env)),
+		Volumes:       host.Binds,
+		Network:       app.GetNetworkID(),
+		NetworkMode:   string(host.NetworkMode),
+		RestartPolicy: string(host.RestartPolicy.Name),
+		Resources: SpecResources{
+			NanoCPUs:          host.NanoCPUs,
+			CPUShares:         host.CPUShares,
+			Memory:            host.Memory,
+			MemoryReservation: host.MemoryReservation,
+			ShmSize:           host.ShmSize,
+		},
+		DependsOn: app.GetFull().DependsOn,
+	}
+	if host.PidsLimit != nil {
+		spec.Resources.PidsLimit = *host.PidsLimit
+	}
+
+	for key, value := range conf.Labels {
+		if !strings.HasPrefix(key, "infra.") {
+			if spec.Labels == nil {
+				spec.Labels = make(map[string]string)
+			}
+			spec.Labels[key] = value
+		}
+	}
+
+	ports := slices.SortedFunc(maps.Keys(host.PortBindings), func(a, b nat.Port) int {
+		if a.Int() != b.Int() {
+			return a.Int() - b.Int()
+		}
+		return strings.Compare(a.Proto(), b.Proto())
+	})
+	for _, port := range ports {
+		for _, binding := range host.PortBindings[port] {
+			spec.Ports = append(spec.Ports, Port{
+				HostIP:        binding.HostIP,
+				HostPort:      binding.HostPort,
+				ContainerPort: port.Int(),
+				Protocol:      port.Proto(),
+			})
+		}
+	}
+
+	if hc := conf.Healthcheck; hc != nil {
+		spec.HealthCheck = &SpecHealthCheck{Test: hc.Test, Retries: hc.Retries}
+		if hc.Interval > 0 {
+			spec.HealthCheck.Interval = hc.Interval.String()
+		}
+		if hc.Timeout > 0 {
+			spec.HealthCheck.Timeout = hc.Timeout.String()
+		}
+		if hc.StartPeriod > 0 {
+			spec.HealthCheck.StartPeriod = hc.StartPeriod.String()
+		}
+	}
+	return spec
+}
@@ -26,8 +26,8 @@ func NewUltimateContainer(configs *config.UltimateConfig) (*UltimateContainer,er
 			return nil, fmt.Errorf("container creation error: %s", err)
 		}
 		
-		ulti[v.GetService()] = cont
-		log.Println("added container: ", v.GetService())
+		ulti[v.GetName()] = cont
+		log.Println("added container: ", v.GetName())
 	}
 	
 	if len(configs.Containers) != len(ulti) {
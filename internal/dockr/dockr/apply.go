@@ -0,0 +1,358 @@
+package dockr
+
+import (
+	"Infra/internal/dockr/config"
+	entity "Infra/internal/dockr/container"
+	"Infra/internal/dockr/state"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+)
+
+// previousSuffix is appended to the name of a container while its
+// replacement starts, so it can be brought back when the replacement fails.
+const previousSuffix = "_previous"
+
+// Plan resolves the secrets of a copy of conf, pins its images when a lock is
+// set (see SetLock), hashes its builds, expands its replicas and computes the
+// changes against the containers Infra runs. Planning is read-only: conf is
+// left as loaded, and credentials that are not in the state store yet are
+// generated for the plan and only stored when it is applied.
+func (d *Dockr) Plan(conf *config.UltimateConfig) (*Plan, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("ultimate config is nil")
+	}
+	conf = conf.Clone()
+
+	secrets := newPendingSecrets(d.store)
+	if err := config.ResolveSecrets(conf, secrets); err != nil {
+		return nil, fmt.Errorf("error resolve secrets %s", err)
+	}
+	if err := d.pin(conf); err != nil {
+		return nil, err
+	}
+	if err := labelBuilds(conf); err != nil {
+		return nil, err
+	}
+	if err := conf.ExpandReplicas(); err != nil {
+		return nil, err
+	}
+
+	running, err := d.deployed(conf)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := Diff(conf, running)
+	if err != nil {
+		return nil, err
+	}
+	plan.secrets = secrets.pending
+	return plan, nil
+}
+
+// Running lists the containers of the current deployment, of the project
+// only when one is set.
+func (d *Dockr) Running() ([]Running, error) {
+	args := filters.NewArgs(filters.Arg("label", LabelManaged+"=true"))
+	if d.project != "" {
+		args.Add("label", LabelProject+"="+d.project)
+	}
+	return d.list(args)
+}
+
+// deployed lists the containers a plan of conf is computed against: the
+// containers of the project, and the containers of conf deployed without a
+// project, which the plan adopts. Containers of other projects are never
+// replaced or removed, neither are containers without a project that conf
+// does not name when a project is set.
+func (d *Dockr) deployed(conf *config.UltimateConfig) ([]Running, error) {
+	all, err := d.list(filters.NewArgs(filters.Arg("label", LabelManaged+"=true")))
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Running, 0, len(all))
+	for _, r := range all {
+		_, named := conf.Containers[r.Name]
+		if r.Project == d.project || (r.Project == "" && named) {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+// list lists the containers matching args.
+func (d *Dockr) list(args filters.Args) ([]Running, error) {
+	list, err := d.cli.ContainerList(d.ctx, container.ListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("error list containers: %s", err)
+	}
+
+	// containers are matched by their actual name, a container left renamed
+	// by an interrupted update is not part of the config and gets removed
+	running := make([]Running, 0, len(list))
+	for _, c := range list {
+		if len(c.Names) == 0 {
+			continue
+		}
+		running = append(running, Running{
+			Name:    strings.TrimPrefix(c.Names[0], "/"),
+			ID:      c.ID,
+			Image:   c.Image,
+			Hash:    c.Labels[LabelConfigHash],
+			Service: c.Labels[LabelService],
+			Project: c.Labels[LabelProject],
+			State:   c.State,
+			Status:  c.Status,
+		})
+	}
+	return running, nil
+}
+
+// Apply executes a plan. The plan is checked against the host capacity, and
+// images are pulled or built and container configs validated before anything
+// is touched, so a plan that cannot be applied leaves the deployment as it
+// is; a plan that does not fit the host fails with a *CapacityError. Images
+// with a build section are only rebuilt when their build changed. Resources
+// are normalised to what the daemon supports, see NormalizeResources. An
+// updated container is stopped and kept until its replacement started, and
+// restarted if the replacement fails. The credentials generated by the plan
+// are stored before the first container starts, and the applied deployment is
+// recorded as a revision in the state store.
+func (d *Dockr) Apply(plan *Plan) error {
+	info, err := d.cli.Info(d.ctx)
+	if err != nil {
+		return fmt.Errorf("error read host info: %s", err)
+	}
+	features := FeaturesOf(info)
+
+	admission, err := d.admit(plan, info)
+	if err != nil {
+		return err
+	}
+	if !admission.Fits() {
+		return &CapacityError{Admission: admission}
+	}
+
+	containers := make(map[string]entity.ContainerConfiguration, len(plan.Changes))
+	pulls := make([]imagePull, 0, len(plan.Changes))
+	builds := make([]config.ContainerConfiguration, 0)
+	networks := make([]string, 0)
+	for _, c := range plan.Changes {
+		if c.Action == ActionRemove {
+			continue
+		}
+
+		cont, err := entity.NewContainer(c.Config)
+		if err != nil {
+			return fmt.Errorf("container %s: %s", c.Name, err)
+		}
+		warnings, err := NormalizeResources(&cont.GetHostConfig().Resources, features)
+		for _, w := range warnings {
+			d.logger.Warnf("%s: %s", c.Name, w)
+		}
+		if err != nil {
+			return fmt.Errorf("container %s: %s", c.Name, err)
+		}
+		containers[c.Name] = cont
+
+		if c.Config.GetBuild() != nil {
+			builds = append(builds, c.Config)
+		} else {
+			pulls = append(pulls, d.imagePullOf(c.Config))
+		}
+		if id := c.Config.GetNetworkID(); id != "" {
+			networks = append(networks, id)
+		}
+	}
+
+	if err := d.pullImages(pulls); err != nil {
+		return err
+	}
+	if err := d.buildImages(builds); err != nil {
+		return err
+	}
+	if err := d.ensureNetworks(networks); err != nil {
+		return err
+	}
+	if err := d.storeSecrets(plan.secrets); err != nil {
+		return err
+	}
+
+	for _, c := range plan.Changes {
+		var err error
+		switch c.Action {
+		case ActionCreate:
+			_, err = d.start(c, containers[c.Name])
+		case ActionUpdate:
+			err = d.replace(c, containers[c.Name])
+		case ActionRemove:
+			err = d.remove(c.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s %s: %s", c.Action, c.Name, err)
+		}
+		d.logger.Infof("%s %s", c.Action, c.Name)
+	}
+
+	revision := make(map[string]state.RevisionContainer, len(plan.hashes))
+	for name, hash := range plan.hashes {
+		revision[name] = state.RevisionContainer{
+			Image: plan.config.Containers[name].GetImage(),
+			Hash:  hash,
+		}
+	}
+	rev, err := d.store.AddRevision(revision)
+	if err != nil {
+		return fmt.Errorf("error record revision %s", err)
+	}
+
+	d.config = plan.config
+	d.logger.Infof("applied revision %d", rev.Number)
+	return nil
+}
+
+// Sync plans conf against the current deployment and applies the changes.
+func (d *Dockr) Sync(conf *config.UltimateConfig) error {
+	plan, err := d.Plan(conf)
+	if err != nil {
+		return err
+	}
+	if plan.Empty() {
+		d.logger.Infof("deployment is up to date")
+		return nil
+	}
+
+	d.logger.Infof("plan:\n%s", plan)
+	return d.Apply(plan)
+}
+
+// storeSecrets persists the credentials a plan generated, in a fixed order.
+func (d *Dockr) storeSecrets(secrets map[string]map[string]string) error {
+	for _, service := range slices.Sorted(maps.Keys(secrets)) {
+		for _, key := range slices.Sorted(maps.Keys(secrets[service])) {
+			if err := d.store.SetSecret(service, key, secrets[service][key]); err != nil {
+				return fmt.Errorf("error store secret %s of %s: %s", key, service, err)
+			}
+		}
+	}
+	return nil
+}
+
+// pendingSecrets is a config.SecretStore over the state store that keeps the
+// secrets set on it in memory, so resolving them does not write anything.
+type pendingSecrets struct {
+	store   config.SecretStore
+	pending map[string]map[string]string
+}
+
+func newPendingSecrets(store config.SecretStore) *pendingSecrets {
+	return &pendingSecrets{store: store, pending: make(map[string]map[string]string)}
+}
+
+func (p *pendingSecrets) GetSecret(service, key string) (string, bool) {
+	if v, ok := p.pending[service][key]; ok {
+		return v, true
+	}
+	return p.store.GetSecret(service, key)
+}
+
+func (p *pendingSecrets) SetSecret(service, key, value string) error {
+	if p.pending[service] == nil {
+		p.pending[service] = make(map[string]string)
+	}
+	p.pending[service][key] = value
+	return nil
+}
+
+// start creates and starts the container of a change and returns its ID.
+func (d *Dockr) start(c Change, cont entity.ContainerConfiguration) (string, error) {
+	conf := *cont.GetConfig()
+	conf.Labels = maps.Clone(conf.Labels)
+	if conf.Labels == nil {
+		conf.Labels = make(map[string]string, 4)
+	}
+	conf.Labels[LabelManaged] = "true"
+	conf.Labels[LabelName] = c.Name
+	conf.Labels[LabelService] = c.Config.GetService()
+	conf.Labels[LabelConfigHash] = c.Hash
+	if d.project != "" {
+		conf.Labels[LabelProject] = d.project
+	}
+
+	resp, err := d.cli.ContainerCreate(d.ctx, &conf, cont.GetHostConfig(), cont.GetNetworkConfig(), nil, c.Name)
+	if err != nil {
+		return "", err
+	}
+	for _, w := range resp.Warnings {
+		d.logger.Warnf("%s: %s", c.Name, w)
+	}
+
+	if err = d.cli.ContainerStart(d.ctx, resp.ID, container.StartOptions{}); err != nil {
+		if rmErr := d.remove(resp.ID); rmErr != nil {
+			d.logger.Errorf("error remove failed container %s: %v", c.Name, rmErr)
+		}
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// replace stops the running container of a change and starts its new config.
+// The old container is restored when the new one does not start.
+func (d *Dockr) replace(c Change, cont entity.ContainerConfiguration) error {
+	if err := d.cli.ContainerStop(d.ctx, c.ID, container.StopOptions{}); err != nil {
+		return err
+	}
+	if err := d.cli.ContainerRename(d.ctx, c.ID, c.Name+previousSuffix); err != nil {
+		return err
+	}
+
+	if _, err := d.start(c, cont); err != nil {
+		if rbErr := d.restore(c); rbErr != nil {
+			return fmt.Errorf("%s (restoring previous container failed: %s)", err, rbErr)
+		}
+		return err
+	}
+	return d.remove(c.ID)
+}
+
+func (d *Dockr) restore(c Change) error {
+	if err := d.cli.ContainerRename(d.ctx, c.ID, c.Name); err != nil {
+		return err
+	}
+	return d.cli.ContainerStart(d.ctx, c.ID, container.StartOptions{})
+}
+
+func (d *Dockr) remove(id string) error {
+	return d.cli.ContainerRemove(d.ctx, id, container.RemoveOptions{Force: true})
+}
+
+// ensureNetworks creates the user defined networks that do not exist yet.
+func (d *Dockr) ensureNetworks(names []string) error {
+	slices.Sort(names)
+	for _, name := range slices.Compact(names) {
+		_, err := d.cli.NetworkInspect(d.ctx, name, network.InspectOptions{})
+		if err == nil {
+			continue
+		}
+		if !errdefs.IsNotFound(err) {
+			return fmt.Errorf("error inspect network %s: %s", name, err)
+		}
+
+		_, err = d.cli.NetworkCreate(d.ctx, name, network.CreateOptions{
+			Driver: "bridge",
+			Labels: map[string]string{LabelManaged: "true"},
+		})
+		if err != nil {
+			return fmt.Errorf("error create network %s: %s", name, err)
+		}
+		d.logger.Infof("created network %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package dockr
+
+import (
+	"Infra/internal/dockr/config"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+)
+
+const (
+	// dockerHubServer is the key of Docker Hub in the docker CLI config and
+	// its credential helpers.
+	dockerHubServer = "https://index.docker.io/v1/"
+
+	// registrySecretPrefix prefixes the registry host to form the service of
+	// registry credentials in the state store.
+	registrySecretPrefix = "registry:"
+
+	// tokenUsername is the user name credential helpers return with an
+	// identity token as the secret.
+	tokenUsername = "<token>"
+)
+
+// RegistryHost returns the registry img is pulled from, docker.io for images
+// without one.
+func RegistryHost(img string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(img)
+	if err != nil {
+		return "", fmt.Errorf("error parse image reference %s: %s", img, err)
+	}
+	return reference.Domain(named), nil
+}
+
+// SetRegistryCredentials stores the credentials of the registry at host in
+// the state store, they are used for every image of that registry without
+// registry_auth of its own.
+func (d *Dockr) SetRegistryCredentials(host string, auth registry.AuthConfig) error {
+	service := registrySecretPrefix + host
+	for key, value := range map[string]string{
+		"USERNAME":       auth.Username,
+		"PASSWORD":       auth.Password,
+		"IDENTITY_TOKEN": auth.IdentityToken,
+	} {
+		if err := d.store.SetSecret(service, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registryAuth returns the encoded credentials to pull img with: override
+// (the registry_auth of its container), otherwise the credentials of its
+// registry in the state store, otherwise the ones of the docker CLI config.
+// Images of registries without credentials are pulled anonymously with an
+// empty string.
+func (d *Dockr) registryAuth(img string, override *config.RegistryAuthConfig) (string, error) {
+	host, err := RegistryHost(img)
+	if err != nil {
+		return "", err
+	}
+
+	auth, source := registry.AuthConfig{}, ""
+	switch {
+	case override != nil:
+		auth = registry.AuthConfig{
+			Username:      override.Username,
+			Password:      override.Password,
+			IdentityToken: override.IdentityToken,
+		}
+		source = "config"
+	case d.storedCredentials(host, &auth):
+		source = "state store"
+	default:
+		var ok bool
+		auth, ok, err = DockerConfigAuth(host)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", nil
+		}
+		source = "docker config"
+	}
+
+	auth.ServerAddress = serverAddress(host)
+	d.logger.Debugf("pulling %s with the %s credentials of %s", img, source, host)
+	encoded, err := registry.EncodeAuthConfig(auth)
+	if err != nil {
+		return "", fmt.Errorf("error encode credentials of %s: %s", host, err)
+	}
+	return encoded, nil
+}
+
+func (d *Dockr) storedCredentials(host string, auth *registry.AuthConfig) bool {
+	service := registrySecretPrefix + host
+	auth.Username, _ = d.store.GetSecret(service, "USERNAME")
+	auth.Password, _ = d.store.GetSecret(service, "PASSWORD")
+	auth.IdentityToken, _ = d.store.GetSecret(service, "IDENTITY_TOKEN")
+	return auth.Username != "" || auth.IdentityToken != ""
+}
+
+// dockerConfig is the part of the docker CLI config holding credentials.
+type dockerConfig struct {
+	Auths       map[string]dockerConfigAuth `json:"auths"`
+	CredsStore  string                      `json:"credsStore"`
+	CredHelpers map[string]string           `json:"credHelpers"`
+}
+
+type dockerConfigAuth struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// DockerConfigAuth looks up the credentials of the registry at host the way
+// the docker CLI does: the credential helper configured for the registry,
+// otherwise the credentials store, otherwise the auths of the config file.
+// The config is read from $DOCKER_CONFIG/config.json, ~/.docker/config.json
+// by default; a missing file has no credentials.
+func DockerConfigAuth(host string) (registry.AuthConfig, bool, error) {
+	path, err := dockerConfigPath()
+	if err != nil {
+		return registry.AuthConfig{}, false, err
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return registry.AuthConfig{}, false, nil
+	}
+	if err != nil {
+		return registry.AuthConfig{}, false, fmt.Errorf("error read docker config: %s", err)
+	}
+
+	var conf dockerConfig
+	if err = json.Unmarshal(raw, &conf); err != nil {
+		return registry.AuthConfig{}, false, fmt.Errorf("error parse docker config %s: %s", path, err)
+	}
+
+	helper := conf.CredsStore
+	if h, ok := conf.CredHelpers[host]; ok {
+		helper = h
+	}
+	if helper != "" {
+		auth, ok, err := helperAuth(helper, serverAddress(host))
+		if err != nil || ok {
+			return auth, ok, err
+		}
+	}
+
+	for key, entry := range conf.Auths {
+		if registryHostname(key) != host {
+			continue
+		}
+		auth := registry.AuthConfig{
+			Username:      entry.Username,
+			Password:      entry.Password,
+			IdentityToken: entry.IdentityToken,
+		}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return auth, false, fmt.Errorf("error decode docker config auth of %s: %s", key, err)
+			}
+			user, password, ok := strings.Cut(string(decoded), ":")
+			if !ok {
+				return auth, false, fmt.Errorf("invalid docker config auth of %s", key)
+			}
+			auth.Username, auth.Password = user, password
+		}
+		if auth.Username == "" && auth.IdentityToken == "" {
+			continue
+		}
+		return auth, true, nil
+	}
+	return registry.AuthConfig{}, false, nil
+}
+
+func dockerConfigPath() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error locate docker config: %s", err)
+	}
+	return filepath.Join(home, ".docker", "config.json"), nil
+}
+
+// helperAuth runs "docker-credential-<helper> get" for server. A helper that
+// knows no credentials for server reports them as not found.
+func helperAuth(helper, server string) (registry.AuthConfig, bool, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	if err := cmd.Run(); err != nil {
+		out := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(out, "credentials not found") {
+			return registry.AuthConfig{}, false, nil
+		}
+		return registry.AuthConfig{}, false, fmt.Errorf("error credential helper %s: %s %s", helper, err, out)
+	}
+
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return registry.AuthConfig{}, false, fmt.Errorf("error parse credential helper %s output: %s", helper, err)
+	}
+	if creds.Username == tokenUsername {
+		return registry.AuthConfig{IdentityToken: creds.Secret}, true, nil
+	}
+	return registry.AuthConfig{Username: creds.Username, Password: creds.Secret}, true, nil
+}
+
+// serverAddress returns the address credentials of host are keyed by.
+func serverAddress(host string) string {
+	if host == "docker.io" {
+		return dockerHubServer
+	}
+	return host
+}
+
+// registryHostname strips the scheme and path of a docker config auths key,
+// "https://ghcr.io/v2/" is stored for ghcr.io.
+func registryHostname(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host, _, _ := strings.Cut(key, "/")
+	if host == "index.docker.io" || host == "registry-1.docker.io" {
+		return "docker.io"
+	}
+	return host
+}
@@ -0,0 +1,157 @@
+package dockr_test
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/registry"
+)
+
+// fakeHelper answers "get" for registry.example.com and reports every other
+// server as not found, like the helpers of the docker CLI.
+const fakeHelper = `#!/bin/sh
+read server
+if [ "$server" = "registry.example.com" ]; then
+	echo '{"ServerURL":"registry.example.com","Username":"robot","Secret":"helper-secret"}'
+	exit 0
+fi
+echo "credentials not found in native keychain"
+exit 1
+`
+
+// dockerConfigDir writes a docker CLI config with basic auth for ghcr.io, a
+// credential helper for registry.example.com and puts the helper on PATH.
+func dockerConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	conf := fmt.Sprintf(`{
+		"auths": {
+			"https://ghcr.io": {"auth": %q},
+			"registry.example.com": {}
+		},
+		"credHelpers": {"registry.example.com": "fake"}
+	}`, base64.StdEncoding.EncodeToString([]byte("octocat:ghp-token")))
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(fakeHelper), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOCKER_CONFIG", dir)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRegistryHost(t *testing.T) {
+	for img, want := range map[string]string{
+		"nginx":                "docker.io",
+		"bitnami/redis:7":      "docker.io",
+		"ghcr.io/acme/api:1.2": "ghcr.io",
+		"localhost:5000/api@sha256:" + strings.Repeat("a", 64): "localhost:5000",
+	} {
+		host, err := dockr.RegistryHost(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host != want {
+			t.Errorf("%s: expected %s, got %s", img, want, host)
+		}
+	}
+
+	if _, err := dockr.RegistryHost("acme/API"); err == nil {
+		t.Error("expected an error for an invalid reference")
+	}
+}
+
+func TestDockerConfigAuth(t *testing.T) {
+	dockerConfigDir(t)
+
+	t.Run("Auths", func(t *testing.T) {
+		auth, ok, err := dockr.DockerConfigAuth("ghcr.io")
+		if err != nil || !ok {
+			t.Fatalf("expected credentials, got %v %v", ok, err)
+		}
+		if auth.Username != "octocat" || auth.Password != "ghp-token" {
+			t.Errorf("unexpected credentials %+v", auth)
+		}
+	})
+
+	t.Run("Helper", func(t *testing.T) {
+		auth, ok, err := dockr.DockerConfigAuth("registry.example.com")
+		if err != nil || !ok {
+			t.Fatalf("expected credentials, got %v %v", ok, err)
+		}
+		if auth.Username != "robot" || auth.Password != "helper-secret" {
+			t.Errorf("unexpected credentials %+v", auth)
+		}
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		if _, ok, err := dockr.DockerConfigAuth("quay.io"); err != nil || ok {
+			t.Errorf("expected no credentials, got %v %v", ok, err)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		t.Setenv("DOCKER_CONFIG", t.TempDir())
+		if _, ok, err := dockr.DockerConfigAuth("ghcr.io"); err != nil || ok {
+			t.Errorf("expected no credentials, got %v %v", ok, err)
+		}
+	})
+}
+
+func TestPullRegistryAuth(t *testing.T) {
+	daemon := newFakeDaemon(t)
+	dockerConfigDir(t)
+
+	d, err := dockr.NewDockr(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	err = d.SetRegistryCredentials("quay.io", registry.AuthConfig{Username: "stored", Password: "store-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := config.NewContainersConfig(
+		config.ContainerConfig{Name: "api", Image: "ghcr.io/acme/api:latest"},
+		config.ContainerConfig{Name: "worker", Image: "registry.example.com/acme/worker:latest"},
+		config.ContainerConfig{Name: "cache", Image: "quay.io/acme/cache:latest"},
+		config.ContainerConfig{
+			Name:         "web",
+			Image:        "ghcr.io/acme/web:latest",
+			RegistryAuth: &config.RegistryAuthConfig{Username: "deploy", Password: "override-secret"},
+		},
+		config.ContainerConfig{Name: "proxy", Image: "nginx:latest"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.InitContainers(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	for img, want := range map[string]registry.AuthConfig{
+		"ghcr.io/acme/api:latest":                 {Username: "octocat", Password: "ghp-token", ServerAddress: "ghcr.io"},
+		"registry.example.com/acme/worker:latest": {Username: "robot", Password: "helper-secret", ServerAddress: "registry.example.com"},
+		"quay.io/acme/cache:latest":               {Username: "stored", Password: "store-secret", ServerAddress: "quay.io"},
+		"ghcr.io/acme/web:latest":                 {Username: "deploy", Password: "override-secret", ServerAddress: "ghcr.io"},
+		"nginx:latest":                            {},
+	} {
+		got, ok := daemon.auths[img]
+		if !ok {
+			t.Errorf("%s was not pulled, pulled %v", img, daemon.auths)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %+v, got %+v", img, want, got)
+		}
+	}
+}
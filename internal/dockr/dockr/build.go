@@ -0,0 +1,336 @@
+package dockr
+
+import (
+	"Infra/internal/dockr/config"
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// LabelBuildHash labels built images and the containers running them with
+// the hash of their build, see BuildHash.
+const LabelBuildHash = "infra.build-hash"
+
+// defaultDockerfile is the Dockerfile of a build without one.
+const defaultDockerfile = "Dockerfile"
+
+// BuildHash returns the hash of a build: the files of its context that are
+// not excluded by the .dockerignore of the context, and the build settings.
+// Modification times and owners are not part of it.
+func BuildHash(b *config.BuildConfig) (string, error) {
+	files, err := contextFiles(b)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if err = archiveContext(b.Context, files, nil, h); err != nil {
+		return "", err
+	}
+
+	// moving the context does not change the build
+	settings := *b
+	settings.Context = ""
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return "", fmt.Errorf("error hash build settings: %s", err)
+	}
+	h.Write(raw)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// labelBuilds labels the containers of conf that are built with the hash of
+// their build, so a change of the build context replaces them.
+func labelBuilds(conf *config.UltimateConfig) error {
+	for name, v := range conf.Containers {
+		c := v.GetFull()
+		if c.Build == nil {
+			continue
+		}
+
+		hash, err := BuildHash(c.Build)
+		if err != nil {
+			return fmt.Errorf("container %s: %s", name, err)
+		}
+		// presets share their labels, never write into them
+		labels := maps.Clone(c.Labels)
+		if labels == nil {
+			labels = make(map[string]string, 1)
+		}
+		labels[LabelBuildHash] = hash
+		c.Labels = labels
+	}
+	return nil
+}
+
+// buildImages builds the images of the given containers that are missing or
+// were built from a different build, one at a time. Containers sharing an
+// image share its build.
+func (d *Dockr) buildImages(builds []config.ContainerConfiguration) error {
+	built := make(map[string]bool, len(builds))
+	for _, c := range builds {
+		img := c.GetImage()
+		if built[img] {
+			continue
+		}
+		built[img] = true
+
+		hash := c.GetLabels()[LabelBuildHash]
+		if hash == "" {
+			var err error
+			if hash, err = BuildHash(c.GetBuild()); err != nil {
+				return fmt.Errorf("container %s: %s", c.GetName(), err)
+			}
+		}
+
+		inspect, _, err := d.cli.ImageInspectWithRaw(d.ctx, img)
+		switch {
+		case err == nil && inspect.Config != nil && inspect.Config.Labels[LabelBuildHash] == hash:
+			d.logger.Infof("image %s is up to date", img)
+			continue
+		case err != nil && !client.IsErrNotFound(err):
+			return fmt.Errorf("error inspect image: %s", err)
+		}
+
+		if err = d.buildImage(img, c.GetBuild(), hash); err != nil {
+			return fmt.Errorf("error build image %s: %s", img, err)
+		}
+	}
+	return nil
+}
+
+func (d *Dockr) buildImage(img string, b *config.BuildConfig, hash string) error {
+	files, err := contextFiles(b)
+	if err != nil {
+		return err
+	}
+
+	labels := maps.Clone(b.Labels)
+	if labels == nil {
+		labels = make(map[string]string, 1)
+	}
+	labels[LabelBuildHash] = hash
+	args := make(map[string]*string, len(b.Args))
+	for k, v := range b.Args {
+		args[k] = &v
+	}
+	dockerfile := b.Dockerfile
+	if dockerfile == "" {
+		dockerfile = defaultDockerfile
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := archiveContext(b.Context, files, tw, nil)
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	start := time.Now()
+	resp, err := d.cli.ImageBuild(d.ctx, pr, types.ImageBuildOptions{
+		Tags:       []string{img},
+		Dockerfile: filepath.ToSlash(dockerfile),
+		BuildArgs:  args,
+		Target:     b.Target,
+		Labels:     labels,
+		CacheFrom:  b.CacheFrom,
+		Remove:     true,
+	})
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	id, err := ReadBuildOutput(resp.Body, func(line string) {
+		d.logger.Infof("%s: %s", img, line)
+	})
+	if err != nil {
+		return err
+	}
+	d.logger.Infof("built %s (%s in %s)", img, id, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// ReadBuildOutput decodes the JSON message stream of an image build, passes
+// every output line to fn and returns the ID of the built image. Errors
+// reported in the stream are returned.
+func ReadBuildOutput(r io.Reader, fn func(string)) (string, error) {
+	var id string
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return id, fmt.Errorf("error read build output: %s", err)
+		}
+		if msg.Error != nil {
+			return id, msg.Error
+		}
+
+		if msg.Aux != nil {
+			var aux struct {
+				ID string `json:"ID"`
+			}
+			if err := json.Unmarshal(*msg.Aux, &aux); err == nil && aux.ID != "" {
+				id = aux.ID
+			}
+		}
+		lines := strings.Split(strings.TrimRight(msg.Stream, "\n"), "\n")
+		if msg.Status != "" {
+			lines = append(lines, strings.TrimSpace(msg.ID+" "+msg.Status))
+		}
+		for _, line := range lines {
+			if line = strings.TrimRight(line, " \r"); line != "" && fn != nil {
+				fn(line)
+			}
+		}
+	}
+	return id, nil
+}
+
+// contextFiles lists the files and directories of the build context that
+// are not excluded by its .dockerignore, in lexical order. The Dockerfile and
+// the .dockerignore are always sent, as by the docker CLI.
+func contextFiles(b *config.BuildConfig) ([]string, error) {
+	info, err := os.Stat(b.Context)
+	if err != nil {
+		return nil, fmt.Errorf("error read build context: %s", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("build context %s is not a directory", b.Context)
+	}
+
+	dockerfile := b.Dockerfile
+	if dockerfile == "" {
+		dockerfile = defaultDockerfile
+	}
+	dockerfile = filepath.Clean(dockerfile)
+	if _, err = os.Stat(filepath.Join(b.Context, dockerfile)); err != nil {
+		return nil, fmt.Errorf("error read dockerfile: %s", err)
+	}
+
+	var patterns []string
+	f, err := os.Open(filepath.Join(b.Context, ".dockerignore"))
+	switch {
+	case err == nil:
+		patterns, err = ignorefile.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error read .dockerignore: %s", err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("error read .dockerignore: %s", err)
+	}
+	pm, err := patternmatcher.New(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid .dockerignore: %s", err)
+	}
+
+	var files []string
+	err = filepath.WalkDir(b.Context, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(b.Context, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		if rel != dockerfile && rel != ".dockerignore" {
+			excluded, err := pm.MatchesOrParentMatches(rel)
+			if err != nil {
+				return err
+			}
+			if excluded {
+				// an exclusion (!pattern) may bring back files of the directory
+				if entry.IsDir() && !pm.Exclusions() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error read build context: %s", err)
+	}
+	return files, nil
+}
+
+// archiveContext writes files of the context dir to tw and their names,
+// modes and contents to h, either of them may be nil.
+func archiveContext(dir string, files []string, tw *tar.Writer, h io.Writer) error {
+	for _, rel := range files {
+		path := filepath.Join(dir, rel)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		// files are owned by root in the image, as with the docker CLI
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+
+		var writers []io.Writer
+		if tw != nil {
+			if err = tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			writers = append(writers, tw)
+		}
+		if h != nil {
+			fmt.Fprintf(h, "%s %o %d %s\n", hdr.Name, hdr.Mode, hdr.Size, hdr.Linkname)
+			writers = append(writers, h)
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(io.MultiWriter(writers...), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package dockr_test
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// buildContext writes a build context with a .dockerignore excluding logs
+// and the secrets directory.
+func buildContext(t *testing.T) string {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"Dockerfile":      "FROM scratch\nCOPY app.txt /\n",
+		".dockerignore":   "*.log\nsecrets\n",
+		"app.txt":         "v1",
+		"debug.log":       "noise",
+		"secrets/key.pem": "secret",
+		"src/main.go":     "package main",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuildHash(t *testing.T) {
+	dir := buildContext(t)
+	build := &config.BuildConfig{Context: dir, Args: map[string]string{"VERSION": "1"}}
+
+	hash, err := dockr.BuildHash(build)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rehash := func() string {
+		h, err := dockr.BuildHash(build)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	write("debug.log", "more noise")
+	if rehash() != hash {
+		t.Error("an ignored file changed the hash")
+	}
+
+	write("app.txt", "v2")
+	changed := rehash()
+	if changed == hash {
+		t.Error("a changed file did not change the hash")
+	}
+
+	build.Args["VERSION"] = "2"
+	if rehash() == changed {
+		t.Error("a changed build argument did not change the hash")
+	}
+
+	if _, err = dockr.BuildHash(&config.BuildConfig{Context: dir, Dockerfile: "missing.Dockerfile"}); err == nil {
+		t.Error("expected an error for a missing dockerfile")
+	}
+}
+
+func TestReadBuildOutput(t *testing.T) {
+	stream := strings.Join([]string{
+		`{"stream":"Step 1/2 : FROM alpine\n"}`,
+		`{"status":"Pulling from library/alpine","id":"latest"}`,
+		`{"stream":" ---> a1b2\n"}`,
+		`{"aux":{"ID":"sha256:abc"}}`,
+		`{"stream":"Successfully built abc\n"}`,
+	}, "\n")
+
+	var lines []string
+	id, err := dockr.ReadBuildOutput(strings.NewReader(stream), func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "sha256:abc" {
+		t.Errorf("unexpected image ID %s", id)
+	}
+	if len(lines) != 4 || lines[1] != "latest Pulling from library/alpine" {
+		t.Errorf("unexpected output %q", lines)
+	}
+
+	_, err = dockr.ReadBuildOutput(strings.NewReader(`{"errorDetail":{"message":"failed"},"error":"failed"}`), nil)
+	if err == nil {
+		t.Error("expected the build error")
+	}
+}
+
+func TestBuildImages(t *testing.T) {
+	daemon := newFakeDaemon(t)
+	dir := buildContext(t)
+
+	d, err := dockr.NewDockr(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	load := func() *config.UltimateConfig {
+		conf, err := config.NewContainersConfig(config.ContainerConfig{
+			Name:  "Server_main",
+			Build: &config.BuildConfig{Context: dir, Labels: map[string]string{"team": "core"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conf
+	}
+
+	if err = d.InitContainers(load()); err != nil {
+		t.Fatal(err)
+	}
+	if len(daemon.builds) != 1 {
+		t.Fatalf("expected one build, got %d", len(daemon.builds))
+	}
+	build := daemon.builds[0]
+	if build.tag != "infra/server_main:latest" || build.dockerfile != "Dockerfile" {
+		t.Errorf("unexpected build %+v", build)
+	}
+	if build.labels["team"] != "core" || build.labels[dockr.LabelBuildHash] == "" {
+		t.Errorf("unexpected labels %v", build.labels)
+	}
+	want := []string{".dockerignore", "Dockerfile", "app.txt", "src/", "src/main.go"}
+	if !slices.Equal(build.files, want) {
+		t.Errorf("expected context %v, got %v", want, build.files)
+	}
+
+	if err = d.InitContainers(load()); err != nil {
+		t.Fatal(err)
+	}
+	if len(daemon.builds) != 1 {
+		t.Error("an unchanged context was rebuilt")
+	}
+
+	if err = os.WriteFile(filepath.Join(dir, "app.txt"), []byte("v2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.InitContainers(load()); err != nil {
+		t.Fatal(err)
+	}
+	if len(daemon.builds) != 2 {
+		t.Error("a changed context was not rebuilt")
+	}
+}
@@ -0,0 +1,213 @@
+package dockr
+
+import (
+	"Infra/internal/dockr/config"
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	// bundleVersion is the version of the bundle format.
+	bundleVersion = 1
+
+	bundleManifest = "manifest.json"
+	bundleArchive  = "images.tar"
+)
+
+// BundleManifest describes an image bundle: a tar file holding the manifest
+// followed by the docker save archive of the images.
+type BundleManifest struct {
+	Version int           `json:"version"`
+	Created time.Time     `json:"created"`
+	Images  []BundleImage `json:"images"`
+	Archive string        `json:"archive"`
+	Size    int64         `json:"size"`
+	SHA256  string        `json:"sha256"`
+}
+
+// BundleImage is an image of a bundle and the ID it has to load as.
+type BundleImage struct {
+	Image string `json:"image"`
+	ID    string `json:"id"`
+	Size  int64  `json:"size"`
+}
+
+// SaveBundle writes the images of every container of conf to w as a bundle
+// that LoadBundle loads on hosts without registry access. Missing images are
+// pulled or built first. Like Plan, it does not store credentials: the
+// bundle holds no config, only the registry credentials are needed.
+func (d *Dockr) SaveBundle(conf *config.UltimateConfig, w io.Writer) (*BundleManifest, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("ultimate config is nil")
+	}
+	if err := config.ResolveSecrets(conf, newPendingSecrets(d.store)); err != nil {
+		return nil, fmt.Errorf("error resolve secrets %s", err)
+	}
+	if err := labelBuilds(conf); err != nil {
+		return nil, err
+	}
+
+	var (
+		pulls  []imagePull
+		builds []config.ContainerConfiguration
+		images []string
+	)
+	for _, c := range conf.Containers {
+		if c.GetBuild() != nil {
+			builds = append(builds, c)
+		} else {
+			pulls = append(pulls, imagePull{image: c.GetImage(), policy: config.PullIfNotPresent, auth: c.GetRegistryAuth()})
+		}
+		if !slices.Contains(images, c.GetImage()) {
+			images = append(images, c.GetImage())
+		}
+	}
+	slices.Sort(images)
+
+	if err := d.pullImages(pulls); err != nil {
+		return nil, err
+	}
+	if err := d.buildImages(builds); err != nil {
+		return nil, err
+	}
+
+	manifest := &BundleManifest{Version: bundleVersion, Created: time.Now().UTC(), Archive: bundleArchive}
+	for _, img := range images {
+		inspect, _, err := d.cli.ImageInspectWithRaw(d.ctx, img)
+		if err != nil {
+			return nil, fmt.Errorf("error inspect image: %s", err)
+		}
+		manifest.Images = append(manifest.Images, BundleImage{Image: img, ID: inspect.ID, Size: inspect.Size})
+	}
+
+	// the archive is spooled to learn its checksum before the manifest
+	tmp, err := os.CreateTemp("", "infra-bundle-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("error create bundle spool: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	out, err := d.cli.ImageSave(d.ctx, images)
+	if err != nil {
+		return nil, fmt.Errorf("error save images: %s", err)
+	}
+	h := sha256.New()
+	manifest.Size, err = io.Copy(io.MultiWriter(tmp, h), out)
+	out.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error save images: %s", err)
+	}
+	manifest.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error marshal bundle manifest: %s", err)
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error read bundle spool: %s", err)
+	}
+
+	tw := tar.NewWriter(w)
+	for _, f := range []struct {
+		name string
+		size int64
+		r    io.Reader
+	}{
+		{bundleManifest, int64(len(raw)), bytes.NewReader(raw)},
+		{bundleArchive, manifest.Size, tmp},
+	} {
+		hdr := &tar.Header{Name: f.name, Mode: 0o644, Size: f.size, ModTime: manifest.Created}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return nil, fmt.Errorf("error write bundle: %s", err)
+		}
+		if _, err = io.Copy(tw, f.r); err != nil {
+			return nil, fmt.Errorf("error write bundle: %s", err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return nil, fmt.Errorf("error write bundle: %s", err)
+	}
+
+	d.logger.Infof("bundled %d images (%d bytes, sha256 %s)", len(manifest.Images), manifest.Size, manifest.SHA256)
+	return manifest, nil
+}
+
+// LoadBundle loads a bundle written by SaveBundle. The archive is checked
+// against the size and checksum of the manifest before anything is loaded,
+// and every image has to load with the ID it was saved with.
+func (d *Dockr) LoadBundle(r io.Reader) (*BundleManifest, error) {
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != bundleManifest {
+		return nil, fmt.Errorf("invalid bundle: expected %s first", bundleManifest)
+	}
+	var manifest BundleManifest
+	if err = json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %s", err)
+	}
+	if manifest.Version != bundleVersion {
+		return nil, fmt.Errorf("bundle has version %d, expected %d", manifest.Version, bundleVersion)
+	}
+
+	hdr, err = tr.Next()
+	if err != nil || hdr.Name != manifest.Archive {
+		return nil, fmt.Errorf("invalid bundle: expected %s after the manifest", manifest.Archive)
+	}
+
+	tmp, err := os.CreateTemp("", "infra-bundle-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("error create bundle spool: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), tr)
+	if err != nil {
+		return nil, fmt.Errorf("error read bundle: %s", err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); size != manifest.Size || sum != manifest.SHA256 {
+		return nil, fmt.Errorf("bundle is corrupt: %s has %d bytes with sha256 %s, manifest expects %d bytes with sha256 %s",
+			manifest.Archive, size, sum, manifest.Size, manifest.SHA256)
+	}
+	if _, err = tr.Next(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid bundle: unexpected content after %s", manifest.Archive)
+	}
+
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error read bundle spool: %s", err)
+	}
+	resp, err := d.cli.ImageLoad(d.ctx, tmp, true)
+	if err != nil {
+		return nil, fmt.Errorf("error load images: %s", err)
+	}
+	defer resp.Body.Close()
+	// the load output is a message stream like the build output
+	if _, err = ReadBuildOutput(resp.Body, func(line string) { d.logger.Infof("%s", line) }); err != nil {
+		return nil, fmt.Errorf("error load images: %s", err)
+	}
+
+	for _, img := range manifest.Images {
+		inspect, _, err := d.cli.ImageInspectWithRaw(d.ctx, img.Image)
+		if err != nil {
+			return nil, fmt.Errorf("image %s was not loaded: %s", img.Image, err)
+		}
+		if inspect.ID != img.ID {
+			return nil, fmt.Errorf("image %s loaded as %s, bundle expects %s", img.Image, inspect.ID, img.ID)
+		}
+	}
+
+	d.logger.Infof("loaded %d images from the bundle of %s", len(manifest.Images), manifest.Created.Format(time.RFC3339))
+	return &manifest, nil
+}
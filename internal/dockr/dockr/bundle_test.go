@@ -0,0 +1,101 @@
+package dockr_test
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"Infra/internal/dockr/state"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	daemon := newFakeDaemon(t)
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	stateDir := t.TempDir()
+	t.Setenv(state.EnvStateDir, stateDir)
+
+	d, err := dockr.NewDockr(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	load := func() *config.UltimateConfig {
+		conf, err := config.NewContainersConfig(
+			config.ContainerConfig{Name: "voice", Image: "voice:1.4"},
+			config.ContainerConfig{Name: "proxy", Image: "nginx:1.27"},
+			config.ContainerConfig{Name: "proxy_2", Image: "nginx:1.27"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conf
+	}
+
+	var bundle bytes.Buffer
+	manifest, err := d.SaveBundle(load(), &bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Images) != 2 || manifest.Images[0].Image != "nginx:1.27" || manifest.Images[0].ID == "" {
+		t.Errorf("unexpected manifest images %+v", manifest.Images)
+	}
+	if _, ok := daemon.auths["voice:1.4"]; !ok {
+		t.Error("missing image was not pulled before saving")
+	}
+
+	t.Run("NoCredentialsStored", func(t *testing.T) {
+		conf, err := config.NewContainersConfig(config.PostgresConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = d.SaveBundle(conf, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = os.Stat(filepath.Join(stateDir, "state.json")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("saving a bundle wrote the state file: %v", err)
+		}
+	})
+
+	t.Run("Load", func(t *testing.T) {
+		clear(daemon.images)
+		clear(daemon.auths)
+
+		if _, err := d.LoadBundle(bytes.NewReader(bundle.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := daemon.images["voice:1.4"]; !ok {
+			t.Errorf("images were not loaded: %v", daemon.images)
+		}
+
+		if err := d.SetPullPolicy(config.PullNever); err != nil {
+			t.Fatal(err)
+		}
+		defer d.SetPullPolicy("")
+		if err := d.InitContainers(load()); err != nil {
+			t.Fatal(err)
+		}
+		if len(daemon.auths) != 0 {
+			t.Errorf("images were pulled: %v", daemon.auths)
+		}
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		clear(daemon.images)
+		corrupt := bytes.Replace(bundle.Bytes(), []byte("saved:nginx"), []byte("saved:nginX"), 1)
+
+		_, err := d.LoadBundle(bytes.NewReader(corrupt))
+		if err == nil || !strings.Contains(err.Error(), "corrupt") {
+			t.Errorf("expected a checksum error, got %v", err)
+		}
+		if len(daemon.images) != 0 {
+			t.Error("a corrupt bundle was loaded")
+		}
+	})
+}
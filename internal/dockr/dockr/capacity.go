@@ -0,0 +1,240 @@
+package dockr
+
+import (
+	"Infra/internal/dockr/config"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/go-units"
+)
+
+// Capacity is what the host offers to containers.
+type Capacity struct {
+	NanoCPUs int64
+	Memory   int64
+}
+
+// Demand is the share of the host a container asks for: its CPU limit and
+// its memory reservation, or memory limit when nothing is reserved.
+type Demand struct {
+	Name     string
+	NanoCPUs int64
+	Memory   int64
+	// MemoryLimit is the hard memory limit, it may not exceed the host memory.
+	MemoryLimit int64
+	// LoadLevel of the container, -1 when its resources are set explicitly
+	// and cannot be downgraded.
+	LoadLevel int
+	// Running is set for containers that run already and stay as they are.
+	Running bool
+}
+
+// Admission is the result of checking a deployment against the host.
+type Admission struct {
+	Capacity Capacity
+	Demands  []Demand
+	NanoCPUs int64
+	Memory   int64
+	// Problems lists why the deployment does not fit, empty when it does.
+	Problems []string
+	// Suggestions are load levels for planned containers that make the
+	// deployment fit, nil when it fits or lowering load levels is not enough.
+	Suggestions map[string]int
+}
+
+// Fits reports whether the deployment fits the host.
+func (a *Admission) Fits() bool {
+	return len(a.Problems) == 0
+}
+
+// String is a per container breakdown of the demands against the capacity.
+func (a *Admission) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER\tLEVEL\tCPUS\tMEMORY\tSTATE")
+	for _, d := range a.Demands {
+		level, state := "-", "planned"
+		if d.LoadLevel >= 0 {
+			level = fmt.Sprint(d.LoadLevel)
+		}
+		if d.Running {
+			state = "running"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.Name, level, formatCPUs(d.NanoCPUs), units.BytesSize(float64(d.Memory)), state)
+	}
+	fmt.Fprintf(w, "total\t\t%s\t%s\t\n", formatCPUs(a.NanoCPUs), units.BytesSize(float64(a.Memory)))
+	fmt.Fprintf(w, "host\t\t%s\t%s\t\n", formatCPUs(a.Capacity.NanoCPUs), units.BytesSize(float64(a.Capacity.Memory)))
+	w.Flush()
+	return b.String()
+}
+
+// CapacityError is returned by Apply when a plan does not fit the host.
+type CapacityError struct {
+	Admission *Admission
+}
+
+func (e *CapacityError) Error() string {
+	var b strings.Builder
+	b.WriteString("deployment does not fit the host:\n")
+	for _, p := range e.Admission.Problems {
+		fmt.Fprintf(&b, "  %s\n", p)
+	}
+	b.WriteString(e.Admission.String())
+
+	if s := e.Admission.Suggestions; s != nil {
+		names := make([]string, 0, len(s))
+		for name := range s {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		b.WriteString("it fits with the load levels:")
+		for _, name := range names {
+			fmt.Fprintf(&b, " %s=%d", name, s[name])
+		}
+	} else {
+		b.WriteString("lowering load levels is not enough")
+	}
+	return b.String()
+}
+
+// Admit checks the demands against the host capacity. A container may not
+// ask for more than the host has, and all containers together may not ask
+// for more CPUs or memory than the host has. When the deployment does not
+// fit, the load levels of planned containers are lowered one step at a time,
+// largest memory demand first, to find a deployment that does.
+func Admit(capacity Capacity, demands []Demand) *Admission {
+	a := check(capacity, demands)
+	if a.Fits() {
+		return a
+	}
+
+	lowered := slices.Clone(demands)
+	suggestions := make(map[string]int)
+	for {
+		i := -1
+		for j, d := range lowered {
+			if d.Running || d.LoadLevel <= 0 {
+				continue
+			}
+			if i < 0 || d.Memory > lowered[i].Memory || (d.Memory == lowered[i].Memory && d.NanoCPUs > lowered[i].NanoCPUs) {
+				i = j
+			}
+		}
+		if i < 0 {
+			return a
+		}
+
+		d := levelDemand(lowered[i].Name, lowered[i].LoadLevel-1)
+		lowered[i] = d
+		suggestions[d.Name] = d.LoadLevel
+
+		if check(capacity, lowered).Fits() {
+			a.Suggestions = suggestions
+			return a
+		}
+	}
+}
+
+func check(capacity Capacity, demands []Demand) *Admission {
+	a := &Admission{Capacity: capacity, Demands: demands}
+	for _, d := range demands {
+		a.NanoCPUs += d.NanoCPUs
+		a.Memory += d.Memory
+
+		if d.Running {
+			continue
+		}
+		if capacity.NanoCPUs > 0 && d.NanoCPUs > capacity.NanoCPUs {
+			a.Problems = append(a.Problems, fmt.Sprintf("%s asks for %s CPUs, the host has %s", d.Name, formatCPUs(d.NanoCPUs), formatCPUs(capacity.NanoCPUs)))
+		}
+		if capacity.Memory > 0 && d.MemoryLimit > capacity.Memory {
+			a.Problems = append(a.Problems, fmt.Sprintf("%s is limited to %s of memory, the host has %s", d.Name, units.BytesSize(float64(d.MemoryLimit)), units.BytesSize(float64(capacity.Memory))))
+		}
+	}
+
+	if capacity.NanoCPUs > 0 && a.NanoCPUs > capacity.NanoCPUs {
+		a.Problems = append(a.Problems, fmt.Sprintf("containers ask for %s CPUs, the host has %s", formatCPUs(a.NanoCPUs), formatCPUs(capacity.NanoCPUs)))
+	}
+	if capacity.Memory > 0 && a.Memory > capacity.Memory {
+		a.Problems = append(a.Problems, fmt.Sprintf("containers ask for %s of memory, the host has %s", units.BytesSize(float64(a.Memory)), units.BytesSize(float64(capacity.Memory))))
+	}
+	return a
+}
+
+// ConfigDemand returns the demand of a container config. Containers without
+// explicit resources can be downgraded to a lower load level.
+func ConfigDemand(c *config.ContainerConfig) (Demand, error) {
+	res, err := config.ContainerResources(c)
+	if err != nil {
+		return Demand{}, fmt.Errorf("container %s: %w", c.GetName(), err)
+	}
+
+	d := resourceDemand(c.GetName(), res)
+	d.LoadLevel = -1
+	if c.Resources == nil {
+		d.LoadLevel = c.LoadLevel
+	}
+	return d, nil
+}
+
+func levelDemand(name string, level int) Demand {
+	d := resourceDemand(name, config.LoadLevelResources(level))
+	d.LoadLevel = level
+	return d
+}
+
+func resourceDemand(name string, res container.Resources) Demand {
+	d := Demand{Name: name, NanoCPUs: res.NanoCPUs, Memory: res.MemoryReservation, MemoryLimit: res.Memory, LoadLevel: -1}
+	if d.NanoCPUs == 0 && res.CPUQuota > 0 && res.CPUPeriod > 0 {
+		d.NanoCPUs = res.CPUQuota * 1e9 / res.CPUPeriod
+	}
+	if d.Memory == 0 {
+		d.Memory = res.Memory
+	}
+	return d
+}
+
+// Admit checks a plan against the capacity of the Docker host. The containers
+// Infra runs that the plan keeps count with their current resources.
+func (d *Dockr) Admit(plan *Plan) (*Admission, error) {
+	info, err := d.cli.Info(d.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error read host info: %s", err)
+	}
+	return d.admit(plan, info)
+}
+
+func (d *Dockr) admit(plan *Plan, info system.Info) (*Admission, error) {
+	capacity := Capacity{NanoCPUs: int64(info.NCPU) * 1e9, Memory: info.MemTotal}
+
+	demands := make([]Demand, 0, len(plan.Unchanged)+len(plan.Changes))
+	for _, name := range plan.Unchanged {
+		inspect, err := d.cli.ContainerInspect(d.ctx, plan.running[name].ID)
+		if err != nil {
+			return nil, fmt.Errorf("error inspect container %s: %s", name, err)
+		}
+		demand := resourceDemand(name, inspect.HostConfig.Resources)
+		demand.Running = true
+		demands = append(demands, demand)
+	}
+	for _, c := range plan.Changes {
+		if c.Action == ActionRemove {
+			continue
+		}
+		demand, err := ConfigDemand(c.Config.GetFull())
+		if err != nil {
+			return nil, err
+		}
+		demands = append(demands, demand)
+	}
+	return Admit(capacity, demands), nil
+}
+
+// formatCPUs formats nano CPUs as a number of CPUs, "1.5".
+func formatCPUs(nano int64) string {
+	return fmt.Sprintf("%g", float64(nano)/1e9)
+}
@@ -0,0 +1,75 @@
+package dockr_test
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAdmit(t *testing.T) {
+
+	const gib = 1 << 30
+
+	demand := func(c config.ContainerConfig) dockr.Demand {
+		d, err := dockr.ConfigDemand(&c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	t.Run("Fits", func(t *testing.T) {
+		a := dockr.Admit(dockr.Capacity{NanoCPUs: 4e9, Memory: 8 * gib}, []dockr.Demand{
+			demand(config.ContainerConfig{Name: "api", LoadLevel: 2}),
+			demand(config.ContainerConfig{Name: "db", LoadLevel: 1}),
+		})
+		if !a.Fits() {
+			t.Fatalf("expected the deployment to fit: %v", a.Problems)
+		}
+		if a.NanoCPUs != 3e9 || a.Memory != 3*gib {
+			t.Errorf("unexpected totals %d CPUs, %d memory", a.NanoCPUs, a.Memory)
+		}
+	})
+
+	t.Run("Downgrade", func(t *testing.T) {
+		a := dockr.Admit(dockr.Capacity{NanoCPUs: 2e9, Memory: 4 * gib}, []dockr.Demand{
+			{Name: "db", NanoCPUs: 1e9, Memory: 1 * gib, LoadLevel: -1, Running: true},
+			demand(config.ContainerConfig{Name: "api", LoadLevel: 2}),
+			demand(config.ContainerConfig{Name: "worker", LoadLevel: 0}),
+		})
+		if a.Fits() {
+			t.Fatal("expected the deployment not to fit")
+		}
+		if len(a.Suggestions) != 1 || a.Suggestions["api"] != 0 {
+			t.Errorf("unexpected suggestions %v", a.Suggestions)
+		}
+
+		err := error(&dockr.CapacityError{Admission: a})
+		var capErr *dockr.CapacityError
+		if !errors.As(err, &capErr) {
+			t.Fatal("expected a capacity error")
+		}
+		for _, want := range []string{"api", "worker", "running", "api=0"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected %q in\n%s", want, err)
+			}
+		}
+	})
+
+	t.Run("Explicit", func(t *testing.T) {
+		a := dockr.Admit(dockr.Capacity{NanoCPUs: 1e9, Memory: 2 * gib}, []dockr.Demand{
+			demand(config.ContainerConfig{Name: "api", Resources: &config.ResourceConfig{CPUs: "2", Memory: "1g"}}),
+		})
+		if a.Fits() {
+			t.Fatal("expected the deployment not to fit")
+		}
+		if a.Suggestions != nil {
+			t.Errorf("explicit resources cannot be downgraded, got %v", a.Suggestions)
+		}
+		if !strings.Contains(a.Problems[0], "api asks for 2 CPUs") {
+			t.Errorf("unexpected problems %v", a.Problems)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package dockr
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ExecOptions configure a command run by Exec. The command reads Stdin when
+// it is set; with Tty its output is written to Stdout only.
+type ExecOptions struct {
+	Stdin      io.Reader
+	Stdout     io.Writer
+	Stderr     io.Writer
+	Tty        bool
+	User       string
+	WorkingDir string
+	Env        []string
+	// Size is the initial height and width of the terminal of a Tty command,
+	// zero leaves the default.
+	Size [2]uint
+}
+
+// SetProject makes d manage the containers of project only: they are
+// labelled with it when they are created, and containers of other projects
+// are neither listed, replaced nor removed. Without a project every container
+// Infra runs is listed, but only the containers without a project are
+// deployed and removed.
+func (d *Dockr) SetProject(project string) {
+	d.project = project
+}
+
+// Down stops and removes the containers of the project and returns their
+// names. Containers that fail to stop are removed by force.
+func (d *Dockr) Down() ([]string, error) {
+	running, err := d.Running()
+	if err != nil {
+		return nil, err
+	}
+
+	// containers are listed newest first, dependents stop before the
+	// containers they depend on
+	removed := make([]string, 0, len(running))
+	for _, r := range running {
+		if r.Project != d.project {
+			continue
+		}
+		if err = d.cli.ContainerStop(d.ctx, r.ID, container.StopOptions{}); err != nil {
+			d.logger.Warnf("error stop container %s: %v", r.Name, err)
+		}
+		if err = d.remove(r.ID); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %s", r.Name, err)
+		}
+		d.logger.Infof("remove %s", r.Name)
+		removed = append(removed, r.Name)
+	}
+	return removed, nil
+}
+
+// Restart restarts the named containers of the deployment, every container
+// when no name is given.
+func (d *Dockr) Restart(names ...string) error {
+	targets, err := d.lookup(names...)
+	if err != nil {
+		return err
+	}
+	for _, r := range targets {
+		if err = d.cli.ContainerRestart(d.ctx, r.ID, container.StopOptions{}); err != nil {
+			return fmt.Errorf("failed to restart %s: %s", r.Name, err)
+		}
+		d.logger.Infof("restart %s", r.Name)
+	}
+	return nil
+}
+
+// Logs writes the logs of a container of the deployment to stdout and
+// stderr. With opts.Follow it returns when the container stops or the
+// context of d is done.
+func (d *Dockr) Logs(name string, opts container.LogsOptions, stdout, stderr io.Writer) error {
+	targets, err := d.lookup(name)
+	if err != nil {
+		return err
+	}
+	inspect, err := d.cli.ContainerInspect(d.ctx, targets[0].ID)
+	if err != nil {
+		return fmt.Errorf("error inspect container: %s", err)
+	}
+
+	opts.ShowStdout, opts.ShowStderr = true, true
+	out, err := d.cli.ContainerLogs(d.ctx, targets[0].ID, opts)
+	if err != nil {
+		return fmt.Errorf("error read logs: %s", err)
+	}
+	defer out.Close()
+
+	// the output of a container with a terminal is not multiplexed
+	if inspect.Config != nil && inspect.Config.Tty {
+		_, err = io.Copy(stdout, out)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, out)
+	}
+	if err != nil && d.ctx.Err() == nil {
+		return fmt.Errorf("error read logs: %s", err)
+	}
+	return nil
+}
+
+// Exec runs cmd in a running container of the deployment and returns the
+// exit code of the command.
+func (d *Dockr) Exec(name string, cmd []string, opts ExecOptions) (int, error) {
+	targets, err := d.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	if targets[0].State != "running" {
+		return 0, fmt.Errorf("container %s is not running", name)
+	}
+
+	exec, err := d.cli.ContainerExecCreate(d.ctx, targets[0].ID, container.ExecOptions{
+		Cmd:          cmd,
+		Tty:          opts.Tty,
+		AttachStdin:  opts.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		User:         opts.User,
+		WorkingDir:   opts.WorkingDir,
+		Env:          opts.Env,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error create exec: %s", err)
+	}
+	resp, err := d.cli.ContainerExecAttach(d.ctx, exec.ID, container.ExecAttachOptions{Tty: opts.Tty})
+	if err != nil {
+		return 0, fmt.Errorf("error attach exec: %s", err)
+	}
+	defer resp.Close()
+
+	if opts.Tty && opts.Size != [2]uint{} {
+		err = d.cli.ContainerExecResize(d.ctx, exec.ID, container.ResizeOptions{Height: opts.Size[0], Width: opts.Size[1]})
+		if err != nil {
+			d.logger.Warnf("error resize exec terminal: %v", err)
+		}
+	}
+
+	if opts.Stdin != nil {
+		go func() {
+			io.Copy(resp.Conn, opts.Stdin)
+			resp.CloseWrite()
+		}()
+	}
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	if opts.Tty {
+		_, err = io.Copy(stdout, resp.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, resp.Reader)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error read exec output: %s", err)
+	}
+
+	inspect, err := d.cli.ContainerExecInspect(d.ctx, exec.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error inspect exec: %s", err)
+	}
+	return inspect.ExitCode, nil
+}
+
+// lookup returns the containers of the deployment with the given names, in
+// order, or every container when no name is given.
+func (d *Dockr) lookup(names ...string) ([]Running, error) {
+	running, err := d.Running()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return running, nil
+	}
+
+	found := make([]Running, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(running, func(r Running) bool { return r.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("container %s is not part of the deployment", name)
+		}
+		found = append(found, running[i])
+	}
+	return found, nil
+}
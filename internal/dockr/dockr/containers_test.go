@@ -0,0 +1,87 @@
+package dockr_test
+
+import (
+	"Infra/internal/dockr/dockr"
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestDown(t *testing.T) {
+	daemon := newFakeDaemon(t)
+	daemon.managed = []fakeContainer{
+		{name: "web", image: "nginx:1.27", project: "shop"},
+		{name: "db", image: "postgres:16", project: "shop"},
+		{name: "blog", image: "ghost:5", project: "blog"},
+	}
+
+	doc, err := dockr.NewDockr(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doc.Close()
+
+	running, err := doc.Running()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(running) != 3 {
+		t.Fatalf("expected every project without a project set, got %v", running)
+	}
+
+	doc.SetProject("shop")
+	removed, err := doc.Down()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(removed, []string{"web", "db"}) {
+		t.Errorf("unexpected removed containers %v", removed)
+	}
+	if want := []string{"web/stop", "web/remove", "db/stop", "db/remove"}; !slices.Equal(daemon.actions, want) {
+		t.Errorf("expected actions %v, got %v", want, daemon.actions)
+	}
+	if len(daemon.managed) != 1 || daemon.managed[0].name != "blog" {
+		t.Errorf("other project touched: %v", daemon.managed)
+	}
+
+	t.Run("NoProject", func(t *testing.T) {
+		daemon.managed = append(daemon.managed, fakeContainer{name: "legacy", image: "legacy:1"})
+		doc.SetProject("")
+
+		removed, err := doc.Down()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(removed, []string{"legacy"}) {
+			t.Errorf("expected the containers without a project only, removed %v", removed)
+		}
+		if len(daemon.managed) != 1 || daemon.managed[0].name != "blog" {
+			t.Errorf("other project touched: %v", daemon.managed)
+		}
+	})
+}
+
+func TestRestart(t *testing.T) {
+	daemon := newFakeDaemon(t)
+	daemon.managed = []fakeContainer{
+		{name: "web", image: "nginx:1.27"},
+		{name: "db", image: "postgres:16"},
+	}
+
+	doc, err := dockr.NewDockr(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doc.Close()
+
+	if err = doc.Restart("db"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(daemon.actions, []string{"db/restart"}) {
+		t.Errorf("unexpected actions %v", daemon.actions)
+	}
+
+	if err = doc.Restart("nope"); err == nil {
+		t.Errorf("expected error restarting a container that is not deployed")
+	}
+}
@@ -3,14 +3,13 @@ package dockr
 import (
 	"Infra/internal/dockr/config"
 	entity "Infra/internal/dockr/container"
+	"Infra/internal/dockr/state"
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"log"
-	"os"
+	"time"
 
-	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
 	"go.uber.org/zap"
 )
@@ -20,7 +19,14 @@ type Dockr struct {
 	ctx        context.Context
 	config     *config.UltimateConfig
 	containers *entity.UltimateContainer
+	store      *state.Store
 	logger     *zap.SugaredLogger
+
+	pullConcurrency int
+	pullPolicy      string
+	pullProgress    func(PullEvent)
+	lock            *config.Lock
+	project         string
 }
 
 func NewDockr(ctx context.Context, logger *zap.SugaredLogger) (*Dockr,error) {
@@ -38,6 +44,11 @@ func NewDockr(ctx context.Context, logger *zap.SugaredLogger) (*Dockr,error) {
 		return nil, fmt.Errorf("erro ping Docker API client: %s", err) 
 	}
 	
+	store, err := state.OpenDefault()
+	if err != nil {
+		return nil, fmt.Errorf("error open state store: %s", err)
+	}
+	
 	log.Printf("\nAPI client initialized with version: %s\nOS version: %s", ping.APIVersion, ping.OSType)
 	
 	return &Dockr{
@@ -45,6 +56,7 @@ func NewDockr(ctx context.Context, logger *zap.SugaredLogger) (*Dockr,error) {
 		ctx: ctx,
 		config: &config.UltimateConfig{},
 		containers: &entity.UltimateContainer{},
+		store: store,
 		logger: logger,
 	}, nil
 }
@@ -54,30 +66,47 @@ func (d *Dockr) InitContainers(configs *config.UltimateConfig) error {
 		return errors.New("ultimate config id nil")
 	}
 	
+	err := config.ResolveSecrets(configs, d.store)
+	if err != nil {
+		return fmt.Errorf("error resolve secrets %s", err)
+	}
+
+	if err = d.pin(configs); err != nil {
+		return err
+	}
+	if err = labelBuilds(configs); err != nil {
+		return err
+	}
+	if err = configs.ExpandReplicas(); err != nil {
+		return err
+	}
+	
 	ultiContainers, err := entity.NewUltimateContainer(configs)
 	if err != nil {
 		return fmt.Errorf("error create ultimate containers %s", err)
 	}
 	
-	var failedImages []string
+	pulls := make([]imagePull, 0, len(ultiContainers.Containers))
+	builds := make([]config.ContainerConfiguration, 0)
 	for _, v := range ultiContainers.Containers {
-    out, err := d.cli.ImagePull(d.ctx, v.GetContainerConfig().GetImage(), image.PullOptions{})
-    if err != nil {
-        failedImages = append(failedImages, v.GetContainerConfig().GetImage())
-        d.logger.Errorf("error pulling image %s: %v", v.GetContainerConfig().GetImage(), err)
-        continue
-    }
-    io.Copy(os.Stdout, out)
-    out.Close()
+		if c := v.GetContainerConfig(); c.GetBuild() != nil {
+			builds = append(builds, c)
+		} else {
+			pulls = append(pulls, d.imagePullOf(c))
+		}
 	}
-	if len(failedImages) > 0 {
-    return fmt.Errorf("failed to pull images: %v", failedImages)
+	if err = d.pullImages(pulls); err != nil {
+		return err
 	}
-	
-	for k, v := range ultiContainers.Containers {
-		d.logger.Infof("image %s successfully pulled for %s ", v.GetContainerConfig().GetImage(), k)
-	} 
-	return nil
+	return d.buildImages(builds)
+}
+
+// Watch deploys the config files at paths with the overlays of profile (see
+// config.LoadFiles) and keeps the deployment in sync with the files until the
+// context of d is done. Edits that do not load or validate are logged and
+// leave the deployment untouched.
+func (d *Dockr) Watch(paths []string, profile string, interval time.Duration) error {
+	return config.NewFilesWatcher(paths, profile, interval).Watch(d.ctx, d.Sync)
 }
 
 // Close closes the docker client session
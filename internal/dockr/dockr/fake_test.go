@@ -0,0 +1,291 @@
+package dockr_test
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/registry"
+)
+
+// fakeDaemon is a Docker API that accepts every image pull and records the
+// X-Registry-Auth header it was sent with. Its registries serve the digests
+// of repositories, the digest of a repository that changed is not served
+// anymore. Pulled, built and loaded images are present with their labels,
+// every reference is an image of its own. Containers run the listed images,
+// the managed containers are the ones Infra runs. Container stops, restarts
+// and removals are recorded as actions ("<name>/<action>"). Messages sent to
+// events are streamed to the event subscribers.
+type fakeDaemon struct {
+	mu         sync.Mutex
+	auths      map[string]registry.AuthConfig
+	digests    map[string]string
+	images     map[string]map[string]string
+	builds     []fakeBuild
+	containers []string
+	removed    []string
+	managed    []fakeContainer
+	actions    []string
+	events     chan events.Message
+}
+
+// fakeImageID returns the ID of an image reference of a fakeDaemon.
+func fakeImageID(ref string) string {
+	sum := sha256.Sum256([]byte(ref))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// fakeBuild is an image build received by a fakeDaemon.
+type fakeBuild struct {
+	tag, dockerfile string
+	files           []string
+	labels          map[string]string
+}
+
+// fakeContainer is a running container of Infra on a fakeDaemon, its ID is
+// its name.
+type fakeContainer struct {
+	name, image, project string
+	health               string
+}
+
+func newFakeDaemon(t *testing.T) *fakeDaemon {
+	daemon := &fakeDaemon{
+		auths:   make(map[string]registry.AuthConfig),
+		digests: make(map[string]string),
+		images:  make(map[string]map[string]string),
+		events:  make(chan events.Message),
+	}
+	srv := httptest.NewServer(daemon)
+	t.Cleanup(srv.Close)
+
+	t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(srv.URL, "http://"))
+	t.Setenv("DOCKER_TLS_VERIFY", "")
+	t.Setenv("INFRA_STATE_DIR", t.TempDir())
+	return daemon
+}
+
+func (f *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/_ping"):
+		w.Header().Set("API-Version", "1.45")
+		w.WriteHeader(http.StatusOK)
+	case strings.Contains(r.URL.Path, "/distribution/"):
+		_, ref, _ := strings.Cut(strings.TrimSuffix(r.URL.Path, "/json"), "/distribution/")
+		repo, digest, pinned := strings.Cut(ref, "@")
+		if i := strings.LastIndex(repo, ":"); !pinned && i > strings.LastIndex(repo, "/") {
+			repo = repo[:i]
+		}
+
+		f.mu.Lock()
+		current, ok := f.digests[repo]
+		f.mu.Unlock()
+		if !ok || (pinned && digest != current) {
+			http.Error(w, `{"message":"manifest unknown"}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"Descriptor":{"mediaType":"application/vnd.oci.image.index.v1+json","digest":%q,"size":1024},"Platforms":[]}`, current)
+	case strings.HasSuffix(r.URL.Path, "/images/create"):
+		img := r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+
+		var auth registry.AuthConfig
+		if header := r.Header.Get(registry.AuthHeader); header != "" {
+			raw, err := base64.URLEncoding.DecodeString(header)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err = json.Unmarshal(raw, &auth); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		f.mu.Lock()
+		f.auths[img] = auth
+		f.images[img] = nil
+		f.mu.Unlock()
+
+		fmt.Fprintln(w, `{"status":"Digest: sha256:abc"}`)
+	case strings.HasSuffix(r.URL.Path, "/build"):
+		build := fakeBuild{tag: r.URL.Query().Get("t"), dockerfile: r.URL.Query().Get("dockerfile")}
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("labels")), &build.labels); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tr := tar.NewReader(r.Body)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			build.files = append(build.files, hdr.Name)
+		}
+
+		f.mu.Lock()
+		f.builds = append(f.builds, build)
+		f.images[build.tag] = build.labels
+		f.mu.Unlock()
+
+		fmt.Fprintln(w, `{"stream":"Step 1/1 : FROM scratch\n"}`)
+		fmt.Fprintln(w, `{"aux":{"ID":"sha256:built"}}`)
+	case strings.HasSuffix(r.URL.Path, "/images/get"):
+		// the archive of the fake is the list of the saved images
+		fmt.Fprintf(w, "saved:%s", strings.Join(r.URL.Query()["names"], ","))
+	case strings.HasSuffix(r.URL.Path, "/images/load"):
+		raw, _ := io.ReadAll(r.Body)
+		names, ok := strings.CutPrefix(string(raw), "saved:")
+		if !ok {
+			http.Error(w, `{"message":"invalid archive"}`, http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		for _, img := range strings.Split(names, ",") {
+			f.images[img] = nil
+			fmt.Fprintf(w, "{\"stream\":\"Loaded image: %s\\n\"}\n", img)
+		}
+		f.mu.Unlock()
+	case strings.HasSuffix(r.URL.Path, "/images/json"):
+		f.mu.Lock()
+		list := make([]map[string]any, 0)
+		for ref, labels := range f.images {
+			if _, ok := labels["infra.build-hash"]; ok {
+				list = append(list, map[string]any{"Id": fakeImageID(ref), "RepoTags": []string{ref}, "Labels": labels})
+			}
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(list)
+	case strings.HasSuffix(r.URL.Path, "/containers/json"):
+		var args map[string]map[string]bool
+		json.Unmarshal([]byte(r.URL.Query().Get("filters")), &args)
+		list := make([]map[string]any, 0)
+		if !args["label"]["infra.managed=true"] {
+			for i, ref := range f.containers {
+				list = append(list, map[string]any{"Id": fmt.Sprint(i), "Image": ref, "ImageID": fakeImageID(ref)})
+			}
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+
+		f.mu.Lock()
+	managed:
+		for _, c := range f.managed {
+			labels := map[string]string{"infra.managed": "true", "infra.name": c.name}
+			if c.project != "" {
+				labels["infra.project"] = c.project
+			}
+			for filter := range args["label"] {
+				key, value, _ := strings.Cut(filter, "=")
+				if labels[key] != value {
+					continue managed
+				}
+			}
+			list = append(list, map[string]any{
+				"Id": c.name, "Names": []string{"/" + c.name}, "Image": c.image,
+				"Labels": labels, "State": "running", "Status": "Up 1 minute",
+			})
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/containers/") && strings.HasSuffix(r.URL.Path, "/json"):
+		_, id, _ := strings.Cut(strings.TrimSuffix(r.URL.Path, "/json"), "/containers/")
+		f.mu.Lock()
+		i := slices.IndexFunc(f.managed, func(c fakeContainer) bool { return c.name == id })
+		var c fakeContainer
+		if i >= 0 {
+			c = f.managed[i]
+		}
+		f.mu.Unlock()
+		if i < 0 {
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+			return
+		}
+		st := map[string]any{"Status": "running", "Running": true, "StartedAt": "2026-01-02T15:04:05.000000000Z"}
+		if c.health != "" {
+			st["Health"] = map[string]any{"Status": c.health}
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"Id": c.name, "Name": "/" + c.name, "Image": fakeImageID(c.image), "RestartCount": 1, "State": st,
+			"NetworkSettings": map[string]any{
+				"Ports":    map[string]any{"80/tcp": []map[string]string{{"HostIp": "0.0.0.0", "HostPort": "8080"}}},
+				"Networks": map[string]any{"bridge": map[string]any{}},
+			},
+		})
+	case strings.HasSuffix(r.URL.Path, "/events"):
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		enc := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case msg := <-f.events:
+				enc.Encode(msg)
+				w.(http.Flusher).Flush()
+			}
+		}
+	case r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/containers/"):
+		_, action, _ := strings.Cut(r.URL.Path, "/containers/")
+		f.mu.Lock()
+		f.actions = append(f.actions, action)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && strings.Contains(r.URL.Path, "/containers/"):
+		_, id, _ := strings.Cut(r.URL.Path, "/containers/")
+		f.mu.Lock()
+		f.actions = append(f.actions, id+"/remove")
+		f.managed = slices.DeleteFunc(f.managed, func(c fakeContainer) bool { return c.name == id })
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && strings.Contains(r.URL.Path, "/images/"):
+		_, img, _ := strings.Cut(r.URL.Path, "/images/")
+		f.mu.Lock()
+		delete(f.images, img)
+		f.removed = append(f.removed, img)
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode([]map[string]string{{"Untagged": img}})
+	case strings.Contains(r.URL.Path, "/images/") && strings.HasSuffix(r.URL.Path, "/json"):
+		_, img, _ := strings.Cut(strings.TrimSuffix(r.URL.Path, "/json"), "/images/")
+		f.mu.Lock()
+		for ref := range f.images {
+			if fakeImageID(ref) == img {
+				img = ref
+			}
+		}
+		labels, ok := f.images[img]
+		repo, _, _ := strings.Cut(img, ":")
+		digest, pulled := f.digests[repo]
+		f.mu.Unlock()
+		if !ok {
+			http.Error(w, `{"message":"No such image"}`, http.StatusNotFound)
+			return
+		}
+		repoDigests := make([]string, 0)
+		if pulled {
+			repoDigests = append(repoDigests, repo+"@"+digest)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"Id":          fakeImageID(img),
+			"RepoTags":    []string{img},
+			"RepoDigests": repoDigests,
+			"Size":        1024,
+			"Config":      map[string]any{"Labels": labels},
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,78 @@
+package dockr
+
+import (
+	"Infra/internal/dockr/config"
+	entity "Infra/internal/dockr/container"
+	"fmt"
+	"slices"
+)
+
+// ActionNone is the action of a container Inspect reports as in sync with
+// the config.
+const ActionNone Action = "unchanged"
+
+// ContainerInspect is the documented JSON and YAML form of a container: its
+// spec in the config, the change deploying the config makes to it and the
+// deployed container, nil when it is not deployed. Containers the config no
+// longer has only carry their name, service and image. Fields are only ever
+// added to it.
+type ContainerInspect struct {
+	entity.Spec `yaml:",inline"`
+	Action      Action   `json:"action" yaml:"action"`
+	Deployed    *Running `json:"deployed" yaml:"deployed"`
+}
+
+// Inspect describes the named containers of conf and of the deployment, all
+// of them in name order when no name is given. The specs are built from conf
+// as loaded, so secrets stay references; plan is a plan of conf.
+func Inspect(conf *config.UltimateConfig, plan *Plan, names ...string) ([]ContainerInspect, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("ultimate config is nil")
+	}
+	conf = conf.Clone()
+	if err := conf.ExpandReplicas(); err != nil {
+		return nil, err
+	}
+
+	actions := make(map[string]Action, len(plan.Changes))
+	for _, c := range plan.Changes {
+		actions[c.Name] = c.Action
+	}
+	all := conf.Names()
+	for name := range plan.running {
+		if _, ok := conf.Containers[name]; !ok {
+			all = append(all, name)
+		}
+	}
+	slices.Sort(all)
+
+	if len(names) == 0 {
+		names = all
+	}
+	res := make([]ContainerInspect, 0, len(names))
+	for _, name := range names {
+		if !slices.Contains(all, name) {
+			return nil, fmt.Errorf("container %s is neither part of the config nor deployed", name)
+		}
+
+		item := ContainerInspect{Action: ActionNone}
+		if action, ok := actions[name]; ok {
+			item.Action = action
+		}
+		if r, ok := plan.running[name]; ok {
+			item.Deployed = &r
+		}
+
+		if c, ok := conf.Containers[name]; ok {
+			cont, err := entity.NewContainer(c)
+			if err != nil {
+				return nil, fmt.Errorf("container %s: %s", name, err)
+			}
+			item.Spec = entity.NewSpec(cont)
+		} else {
+			item.Spec = entity.Spec{Name: name, Service: item.Deployed.Service, Image: item.Deployed.Image}
+		}
+		res = append(res, item)
+	}
+	return res, nil
+}
@@ -0,0 +1,122 @@
+package dockr_test
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+
+	load := func() *config.UltimateConfig {
+		conf, err := config.NewContainersConfig(
+			config.ContainerConfig{Name: "api", Image: "api:2", Replicas: 2, EnvVars: map[string]string{"TOKEN": "${secret:env:API_TOKEN}"}},
+			config.ContainerConfig{Name: "db", Image: "postgres:16"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conf
+	}
+
+	planned := load()
+	if err := planned.ExpandReplicas(); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := dockr.ConfigHash(planned.Containers["db"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := []dockr.Running{
+		{Name: "api", ID: "1", Image: "api:1", Hash: "outdated", State: "running"},
+		{Name: "db", ID: "2", Image: "postgres:16", Hash: hash, State: "running"},
+		{Name: "old", ID: "3", Image: "old:1", Service: "old", State: "exited"},
+	}
+	plan, err := dockr.Diff(planned, running)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Summary", func(t *testing.T) {
+		summary := plan.Summary(nil)
+		if !summary.Fits || !slices.Equal(summary.Unchanged, []string{"db"}) {
+			t.Errorf("unexpected summary %+v", summary)
+		}
+		want := []dockr.PlanChange{
+			{Action: dockr.ActionRemove, Name: "old", ID: "3", Image: "old:1"},
+			{Action: dockr.ActionUpdate, Name: "api", ID: "1", Image: "api:2"},
+			{Action: dockr.ActionCreate, Name: "api_2", Image: "api:2"},
+		}
+		if len(summary.Changes) != len(want) {
+			t.Fatalf("unexpected changes %+v", summary.Changes)
+		}
+		for i, c := range summary.Changes {
+			c.Hash = ""
+			if c != want[i] {
+				t.Errorf("change %d: got %+v, want %+v", i, c, want[i])
+			}
+		}
+	})
+
+	t.Run("All", func(t *testing.T) {
+		conf := load()
+		containers, err := dockr.Inspect(conf, plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(conf.Names(), []string{"api", "db"}) {
+			t.Errorf("inspect expanded the replicas of the config: %v", conf.Names())
+		}
+
+		var names []string
+		for _, c := range containers {
+			names = append(names, c.Name+":"+string(c.Action))
+		}
+		if !slices.Equal(names, []string{"api:update", "api_2:create", "db:unchanged", "old:remove"}) {
+			t.Errorf("unexpected containers %v", names)
+		}
+
+		api, old := containers[0], containers[3]
+		if api.Deployed == nil || api.Deployed.Image != "api:1" || api.Image != "api:2" {
+			t.Errorf("unexpected api %+v", api)
+		}
+		if !slices.Contains(api.Env, "TOKEN=${secret:env:API_TOKEN}") {
+			t.Errorf("secret not kept as reference: %v", api.Env)
+		}
+		if containers[1].Deployed != nil {
+			t.Error("api_2 is not deployed")
+		}
+		if old.Service != "old" || old.Image != "old:1" {
+			t.Errorf("unexpected old %+v", old)
+		}
+
+		raw, err := json.Marshal(api)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]any
+		if err = json.Unmarshal(raw, &fields); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range []string{"name", "image", "env", "resources", "action", "deployed"} {
+			if _, ok := fields[field]; !ok {
+				t.Errorf("field %s missing in %s", field, raw)
+			}
+		}
+	})
+
+	t.Run("Names", func(t *testing.T) {
+		containers, err := dockr.Inspect(load(), plan, "db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(containers) != 1 || containers[0].Name != "db" || containers[0].Action != dockr.ActionNone {
+			t.Errorf("unexpected containers %+v", containers)
+		}
+		if _, err = dockr.Inspect(load(), plan, "unknown"); err == nil {
+			t.Error("expected error for unknown container")
+		}
+	})
+}
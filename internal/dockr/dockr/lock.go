@@ -0,0 +1,119 @@
+package dockr
+
+import (
+	"Infra/internal/dockr/config"
+	"fmt"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/client"
+)
+
+// Lock resolves the image of every container of conf to the digest its
+// registry serves for it, without pulling. Images already pinned by digest
+// in the config are locked as they are, built images are not locked. Like
+// Plan, it does not store credentials.
+func (d *Dockr) Lock(conf *config.UltimateConfig) (*config.Lock, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("ultimate config is nil")
+	}
+	if err := config.ResolveSecrets(conf, newPendingSecrets(d.store)); err != nil {
+		return nil, fmt.Errorf("error resolve secrets %s", err)
+	}
+
+	auths := make(map[string]*config.RegistryAuthConfig)
+	for _, v := range conf.Containers {
+		if v.GetBuild() != nil {
+			continue
+		}
+		if auth, ok := auths[v.GetImage()]; !ok || auth == nil {
+			auths[v.GetImage()] = v.GetRegistryAuth()
+		}
+	}
+
+	lock := &config.Lock{Images: make(map[string]string, len(auths))}
+	for img, auth := range auths {
+		named, err := reference.ParseNormalizedNamed(img)
+		if err != nil {
+			return nil, fmt.Errorf("error parse image reference %s: %s", img, err)
+		}
+		if _, ok := named.(reference.Canonical); ok {
+			lock.Images[img] = img
+			continue
+		}
+
+		encoded, err := d.registryAuth(img, auth)
+		if err != nil {
+			return nil, err
+		}
+		inspect, err := d.cli.DistributionInspect(d.ctx, img, encoded)
+		if err != nil {
+			return nil, fmt.Errorf("error resolve digest of %s: %s", img, err)
+		}
+		pinned, err := reference.WithDigest(reference.TrimNamed(named), inspect.Descriptor.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("error pin %s: %s", img, err)
+		}
+		lock.Images[img] = reference.FamiliarString(pinned)
+		d.logger.Infof("locked %s to %s", img, inspect.Descriptor.Digest)
+	}
+	return lock, nil
+}
+
+// SetLock makes Plan and InitContainers deploy strictly by digest: every
+// image is replaced with its digest reference from lock, and a config with
+// images that are not locked fails. A nil lock deploys the images as
+// configured.
+func (d *Dockr) SetLock(lock *config.Lock) {
+	d.lock = lock
+}
+
+// pin applies the lock to conf and checks that every locked image not on
+// the host is still served by its registry with the locked digest, so a
+// deployment does not fail halfway through pulling.
+func (d *Dockr) pin(conf *config.UltimateConfig) error {
+	if d.lock == nil {
+		return nil
+	}
+	if err := d.lock.Pin(conf); err != nil {
+		return err
+	}
+
+	checked := make(map[string]bool)
+	for _, v := range conf.Containers {
+		img := v.GetImage()
+		if v.GetBuild() != nil || checked[img] {
+			continue
+		}
+		checked[img] = true
+
+		_, _, err := d.cli.ImageInspectWithRaw(d.ctx, img)
+		if err == nil {
+			// images are addressed by content, a present image matches
+			continue
+		}
+		if !client.IsErrNotFound(err) {
+			return fmt.Errorf("error inspect image: %s", err)
+		}
+
+		named, err := reference.ParseNormalizedNamed(img)
+		if err != nil {
+			return fmt.Errorf("error parse image reference %s: %s", img, err)
+		}
+		canonical, ok := named.(reference.Canonical)
+		if !ok {
+			return fmt.Errorf("locked image %s has no digest, relock the config", img)
+		}
+		encoded, err := d.registryAuth(img, v.GetRegistryAuth())
+		if err != nil {
+			return err
+		}
+		inspect, err := d.cli.DistributionInspect(d.ctx, img, encoded)
+		if err != nil {
+			return fmt.Errorf("locked image %s is no longer served by its registry: %s", img, err)
+		}
+		if inspect.Descriptor.Digest != canonical.Digest() {
+			return fmt.Errorf("registry content of %s no longer matches the lock, got %s", img, inspect.Descriptor.Digest)
+		}
+	}
+	return nil
+}
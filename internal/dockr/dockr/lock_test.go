@@ -0,0 +1,79 @@
+package dockr_test
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	daemon := newFakeDaemon(t)
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	digest := "sha256:" + strings.Repeat("a", 64)
+	pinned := "redis@sha256:" + strings.Repeat("b", 64)
+	daemon.digests["ghcr.io/acme/api"] = digest
+
+	d, err := dockr.NewDockr(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	load := func() *config.UltimateConfig {
+		conf, err := config.NewContainersConfig(
+			config.ContainerConfig{Name: "api", Image: "ghcr.io/acme/api:1"},
+			config.ContainerConfig{Name: "cache", Image: pinned},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conf
+	}
+
+	lock, err := d.Lock(load())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lock.Images["ghcr.io/acme/api:1"]; got != "ghcr.io/acme/api@"+digest {
+		t.Errorf("unexpected locked image %s", got)
+	}
+	if got := lock.Images[pinned]; got != pinned {
+		t.Errorf("pinned image was relocked to %s", got)
+	}
+
+	t.Run("Locked", func(t *testing.T) {
+		daemon.digests["redis"] = "sha256:" + strings.Repeat("b", 64)
+		d.SetLock(lock)
+		defer d.SetLock(nil)
+
+		if err := d.InitContainers(load()); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := daemon.auths["ghcr.io/acme/api:"+digest]; !ok {
+			t.Errorf("image was not pulled by digest, pulled %v", daemon.auths)
+		}
+	})
+
+	t.Run("Moved", func(t *testing.T) {
+		daemon.digests["ghcr.io/acme/api"] = "sha256:" + strings.Repeat("c", 64)
+		d.SetLock(lock)
+		defer d.SetLock(nil)
+
+		err := d.InitContainers(load())
+		if err == nil || !strings.Contains(err.Error(), "no longer served") {
+			t.Errorf("expected the lock to be violated, got %v", err)
+		}
+	})
+
+	t.Run("NotLocked", func(t *testing.T) {
+		d.SetLock(&config.Lock{Images: map[string]string{}})
+		defer d.SetLock(nil)
+
+		if err := d.InitContainers(load()); err == nil {
+			t.Error("expected an error for images that are not locked")
+		}
+	})
+}
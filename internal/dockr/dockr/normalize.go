@@ -0,0 +1,158 @@
+package dockr
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/go-units"
+)
+
+// minMemory is the lowest memory limit the daemon accepts.
+const minMemory = 6 * 1024 * 1024
+
+// Features are the resource controls the Docker daemon supports.
+type Features struct {
+	CgroupVersion  string
+	NCPU           int
+	MemoryLimit    bool
+	SwapLimit      bool
+	KernelMemory   bool
+	CPUCfsPeriod   bool
+	CPUCfsQuota    bool
+	CPUShares      bool
+	CPUSet         bool
+	PidsLimit      bool
+	OomKillDisable bool
+}
+
+// FeaturesOf reads the supported resource controls from the daemon info.
+func FeaturesOf(info system.Info) Features {
+	return Features{
+		CgroupVersion:  info.CgroupVersion,
+		NCPU:           info.NCPU,
+		MemoryLimit:    info.MemoryLimit,
+		SwapLimit:      info.SwapLimit,
+		KernelMemory:   info.KernelMemory,
+		CPUCfsPeriod:   info.CPUCfsPeriod,
+		CPUCfsQuota:    info.CPUCfsQuota,
+		CPUShares:      info.CPUShares,
+		CPUSet:         info.CPUSet,
+		PidsLimit:      info.PidsLimit,
+		OomKillDisable: info.OomKillDisable,
+	}
+}
+
+func (f Features) cgroupV2() bool {
+	return f.CgroupVersion == "2"
+}
+
+// NormalizeResources makes res acceptable to a daemon with the features f.
+// Settings the host does not support are dropped or translated and reported
+// as warnings; combinations the daemon would reject are errors.
+func NormalizeResources(res *container.Resources, f Features) ([]string, error) {
+	var warnings []string
+	warnf := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	if res.KernelMemory != 0 || res.KernelMemoryTCP != 0 {
+		if f.cgroupV2() || !f.KernelMemory {
+			warnf("kernel memory limits are not supported by the host, dropped")
+			res.KernelMemory, res.KernelMemoryTCP = 0, 0
+		}
+	}
+	if res.CPURealtimePeriod != 0 || res.CPURealtimeRuntime != 0 {
+		if f.cgroupV2() {
+			warnf("real-time CPU scheduling needs cgroup v1, dropped")
+			res.CPURealtimePeriod, res.CPURealtimeRuntime = 0, 0
+		} else if res.CPURealtimeRuntime > res.CPURealtimePeriod {
+			return warnings, fmt.Errorf("real-time CPU runtime %d exceeds the period %d", res.CPURealtimeRuntime, res.CPURealtimePeriod)
+		}
+	}
+	if res.MemorySwappiness != nil && f.cgroupV2() {
+		warnf("memory swappiness is not supported on cgroup v2, dropped")
+		res.MemorySwappiness = nil
+	}
+
+	// false is the default, only disabling the OOM killer needs support
+	if res.OomKillDisable != nil && !*res.OomKillDisable {
+		res.OomKillDisable = nil
+	}
+	if res.OomKillDisable != nil && (f.cgroupV2() || !f.OomKillDisable) {
+		warnf("disabling the OOM killer is not supported by the host, dropped")
+		res.OomKillDisable = nil
+	}
+
+	if !f.MemoryLimit && (res.Memory != 0 || res.MemoryReservation != 0 || res.MemorySwap != 0) {
+		warnf("memory limits are not supported by the host, dropped")
+		res.Memory, res.MemoryReservation, res.MemorySwap = 0, 0, 0
+	}
+	if !f.SwapLimit && res.MemorySwap != 0 {
+		warnf("swap limits are not supported by the host, dropped")
+		res.MemorySwap = 0
+	}
+
+	if res.NanoCPUs > 0 && (res.CPUPeriod != 0 || res.CPUQuota != 0) {
+		warnf("CPU limit set as both CPUs and CFS quota, keeping %s CPUs", formatCPUs(res.NanoCPUs))
+		res.CPUPeriod, res.CPUQuota = 0, 0
+	}
+	if (!f.CPUCfsPeriod || !f.CPUCfsQuota) && (res.NanoCPUs != 0 || res.CPUPeriod != 0 || res.CPUQuota != 0) {
+		warnf("CPU limits are not supported by the host, dropped")
+		res.NanoCPUs, res.CPUPeriod, res.CPUQuota = 0, 0, 0
+	}
+	if !f.CPUShares && res.CPUShares != 0 {
+		warnf("CPU shares are not supported by the host, dropped")
+		res.CPUShares = 0
+	}
+	if !f.CPUSet && (res.CpusetCpus != "" || res.CpusetMems != "") {
+		warnf("cpusets are not supported by the host, dropped")
+		res.CpusetCpus, res.CpusetMems = "", ""
+	}
+
+	if res.PidsLimit != nil {
+		switch {
+		case !f.PidsLimit:
+			warnf("PIDs limits are not supported by the host, dropped")
+			res.PidsLimit = nil
+		case *res.PidsLimit <= 0:
+			// 0 and -1 both mean unlimited, older daemons only read -1 that way
+			unlimited := int64(-1)
+			res.PidsLimit = &unlimited
+		}
+	}
+
+	return warnings, validateResources(res, f)
+}
+
+// validateResources checks the combinations the daemon rejects on create.
+func validateResources(res *container.Resources, f Features) error {
+	if res.Memory > 0 && res.Memory < minMemory {
+		return fmt.Errorf("memory limit %s is below the minimum of %s", units.BytesSize(float64(res.Memory)), units.BytesSize(minMemory))
+	}
+	if res.Memory > 0 && res.MemoryReservation > res.Memory {
+		return fmt.Errorf("memory reservation %s exceeds the memory limit %s", units.BytesSize(float64(res.MemoryReservation)), units.BytesSize(float64(res.Memory)))
+	}
+	if res.MemorySwap > 0 {
+		if res.Memory == 0 {
+			return fmt.Errorf("a swap limit needs a memory limit")
+		}
+		if res.MemorySwap < res.Memory {
+			return fmt.Errorf("memory plus swap limit %s is lower than the memory limit %s", units.BytesSize(float64(res.MemorySwap)), units.BytesSize(float64(res.Memory)))
+		}
+	}
+
+	if f.NCPU > 0 && res.NanoCPUs > int64(f.NCPU)*1e9 {
+		return fmt.Errorf("CPU limit %s exceeds the %d CPUs of the host", formatCPUs(res.NanoCPUs), f.NCPU)
+	}
+	if res.CPUQuota > 0 && res.CPUQuota < 1000 {
+		return fmt.Errorf("CPU quota %d is below the minimum of 1000", res.CPUQuota)
+	}
+	if res.CPUPeriod != 0 && (res.CPUPeriod < 1000 || res.CPUPeriod > 1000000) {
+		return fmt.Errorf("CPU period %d must be between 1000 and 1000000", res.CPUPeriod)
+	}
+	if res.BlkioWeight != 0 && (res.BlkioWeight < 10 || res.BlkioWeight > 1000) {
+		return fmt.Errorf("block IO weight %d must be between 10 and 1000", res.BlkioWeight)
+	}
+	return nil
+}
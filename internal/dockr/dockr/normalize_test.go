@@ -0,0 +1,91 @@
+package dockr_test
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestNormalizeResources(t *testing.T) {
+
+	cgroupV2 := dockr.Features{
+		CgroupVersion: "2", NCPU: 4,
+		MemoryLimit: true, SwapLimit: true,
+		CPUCfsPeriod: true, CPUCfsQuota: true, CPUShares: true, CPUSet: true,
+		PidsLimit: true,
+	}
+
+	t.Run("Presets", func(t *testing.T) {
+		for level := 0; level <= 2; level++ {
+			res := config.LoadLevelResources(level)
+			warnings, err := dockr.NormalizeResources(&res, cgroupV2)
+			if err != nil {
+				t.Errorf("level %d: %s", level, err)
+			}
+			if len(warnings) != 0 {
+				t.Errorf("level %d: unexpected warnings %v", level, warnings)
+			}
+		}
+	})
+
+	t.Run("Strip", func(t *testing.T) {
+		disable, pids := true, int64(0)
+		res := container.Resources{
+			Memory:             1 << 30,
+			NanoCPUs:           1e9,
+			CPUPeriod:          100000,
+			CPUQuota:           100000,
+			KernelMemory:       1 << 29,
+			CPURealtimePeriod:  100000,
+			CPURealtimeRuntime: 50000,
+			OomKillDisable:     &disable,
+			PidsLimit:          &pids,
+		}
+		warnings, err := dockr.NormalizeResources(&res, cgroupV2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(warnings) != 4 {
+			t.Errorf("expected 4 warnings, got %v", warnings)
+		}
+		if res.KernelMemory != 0 || res.CPURealtimePeriod != 0 || res.CPURealtimeRuntime != 0 || res.OomKillDisable != nil {
+			t.Errorf("unsupported settings kept: %+v", res)
+		}
+		if res.NanoCPUs != 1e9 || res.CPUPeriod != 0 || res.CPUQuota != 0 {
+			t.Errorf("expected the CPU limit as nano CPUs only, got %+v", res)
+		}
+		if res.PidsLimit == nil || *res.PidsLimit != -1 {
+			t.Errorf("expected an unlimited PIDs limit of -1, got %v", res.PidsLimit)
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		res := config.LoadLevelResources(1)
+		warnings, err := dockr.NormalizeResources(&res, dockr.Features{CgroupVersion: "1", NCPU: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Memory != 0 || res.MemorySwap != 0 || res.NanoCPUs != 0 || res.CPUShares != 0 {
+			t.Errorf("unsupported limits kept: %+v", res)
+		}
+		if len(warnings) != 3 {
+			t.Errorf("expected 3 warnings, got %v", warnings)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, res := range map[string]container.Resources{
+			"swap below memory":   {Memory: 1 << 30, MemorySwap: 1 << 29},
+			"swap without memory": {MemorySwap: 1 << 30},
+			"reservation":         {Memory: 1 << 29, MemoryReservation: 1 << 30},
+			"tiny memory":         {Memory: 1 << 20},
+			"too many cpus":       {NanoCPUs: 8e9},
+		} {
+			if _, err := dockr.NormalizeResources(&res, cgroupV2); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,255 @@
+package dockr
+
+import (
+	"Infra/internal/dockr/config"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Labels Infra puts on the containers it runs. The config hash is compared
+// with the desired config to find the containers that changed, the project
+// is only set when Infra runs for a project (see SetProject).
+const (
+	LabelManaged    = "infra.managed"
+	LabelName       = "infra.name"
+	LabelService    = "infra.service"
+	LabelConfigHash = "infra.config-hash"
+	LabelProject    = "infra.project"
+)
+
+// Action is what applying a Change does to a container.
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionRemove Action = "remove"
+)
+
+// Running is a container of the current deployment. State is the state of
+// the container (e.g. "running", "exited"), Status its description by the
+// daemon (e.g. "Up 5 minutes"). Its JSON and YAML form is documented, fields
+// are only ever added to it.
+type Running struct {
+	Name    string `json:"name" yaml:"name"`
+	ID      string `json:"id" yaml:"id"`
+	Image   string `json:"image" yaml:"image"`
+	Hash    string `json:"config_hash" yaml:"config_hash"`
+	Service string `json:"service,omitempty" yaml:"service,omitempty"`
+	Project string `json:"project,omitempty" yaml:"project,omitempty"`
+	State   string `json:"state" yaml:"state"`
+	Status  string `json:"status" yaml:"status"`
+}
+
+// Change is a container to create, replace or remove.
+type Change struct {
+	Action Action
+	Name   string
+	// ID of the running container, empty for ActionCreate.
+	ID string
+	// Config is the desired config, nil for ActionRemove.
+	Config config.ContainerConfiguration
+	// Hash is the config hash of Config.
+	Hash string
+}
+
+// Plan is the difference between a config and the running deployment.
+// Removals come first, then creations and updates in dependency order.
+type Plan struct {
+	Changes   []Change
+	Unchanged []string
+
+	config  *config.UltimateConfig
+	hashes  map[string]string
+	running map[string]Running
+	// secrets are the credentials generated for the plan, stored by Apply.
+	secrets map[string]map[string]string
+}
+
+// Empty reports whether the deployment already matches the config.
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// String lists the changes, one per line: + create, ~ update, - remove.
+func (p *Plan) String() string {
+	if p.Empty() {
+		return "no changes"
+	}
+
+	var b strings.Builder
+	for _, c := range p.Changes {
+		switch c.Action {
+		case ActionCreate:
+			b.WriteString("+ ")
+		case ActionUpdate:
+			b.WriteString("~ ")
+		case ActionRemove:
+			b.WriteString("- ")
+		}
+		fmt.Fprintf(&b, "%s (%s)\n", c.Name, c.Action)
+	}
+	fmt.Fprintf(&b, "%d unchanged", len(p.Unchanged))
+	return b.String()
+}
+
+// PlanSummary is the documented JSON and YAML form of a Plan and its
+// admission. Fields are only ever added to it.
+type PlanSummary struct {
+	Changes   []PlanChange `json:"changes" yaml:"changes"`
+	Unchanged []string     `json:"unchanged" yaml:"unchanged"`
+	// Fits reports whether the deployment fits the host, Problems why not.
+	Fits     bool     `json:"fits" yaml:"fits"`
+	Problems []string `json:"problems,omitempty" yaml:"problems,omitempty"`
+}
+
+// PlanChange is a Change of a PlanSummary. Image is the desired image, the
+// running image for ActionRemove.
+type PlanChange struct {
+	Action Action `json:"action" yaml:"action"`
+	Name   string `json:"name" yaml:"name"`
+	ID     string `json:"id,omitempty" yaml:"id,omitempty"`
+	Image  string `json:"image" yaml:"image"`
+	Hash   string `json:"config_hash,omitempty" yaml:"config_hash,omitempty"`
+}
+
+// Summary returns the PlanSummary of the plan checked against the host in
+// admission, a nil admission fits.
+func (p *Plan) Summary(admission *Admission) PlanSummary {
+	summary := PlanSummary{
+		Changes:   make([]PlanChange, 0, len(p.Changes)),
+		Unchanged: slices.Clone(p.Unchanged),
+		Fits:      admission == nil || admission.Fits(),
+	}
+	if summary.Unchanged == nil {
+		summary.Unchanged = []string{}
+	}
+	if admission != nil {
+		summary.Problems = admission.Problems
+	}
+
+	for _, c := range p.Changes {
+		change := PlanChange{Action: c.Action, Name: c.Name, ID: c.ID, Hash: c.Hash}
+		if c.Config != nil {
+			change.Image = c.Config.GetImage()
+		} else {
+			change.Image = p.running[c.Name].Image
+		}
+		summary.Changes = append(summary.Changes, change)
+	}
+	return summary
+}
+
+// ConfigHash returns the hash of a container config that is stored in the
+// infra.config-hash label. The file the config was loaded from is not part of
+// it, moving a container between files does not replace it. Neither are the
+// registry credentials, rotating them does not replace the container.
+func ConfigHash(c config.ContainerConfiguration) (string, error) {
+	full := *c.GetFull()
+	full.Source = ""
+	full.RegistryAuth = nil
+
+	raw, err := json.Marshal(full)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash config of %s: %w", c.GetName(), err)
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Diff computes the plan that turns the running containers into the desired
+// config. It fails when a container depends on a container that is not part
+// of the config or dependencies form a cycle.
+func Diff(desired *config.UltimateConfig, running []Running) (*Plan, error) {
+	order, err := dependencyOrder(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]Running, len(running))
+	for _, r := range running {
+		current[r.Name] = r
+	}
+
+	plan := &Plan{config: desired, hashes: make(map[string]string, len(order)), running: current}
+
+	removed := make([]string, 0)
+	for name := range current {
+		if _, ok := desired.Containers[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	slices.Sort(removed)
+	for _, name := range removed {
+		plan.Changes = append(plan.Changes, Change{Action: ActionRemove, Name: name, ID: current[name].ID})
+	}
+
+	for _, name := range order {
+		c := desired.Containers[name]
+		hash, err := ConfigHash(c)
+		if err != nil {
+			return nil, err
+		}
+		plan.hashes[name] = hash
+
+		r, ok := current[name]
+		switch {
+		case !ok:
+			plan.Changes = append(plan.Changes, Change{Action: ActionCreate, Name: name, Config: c, Hash: hash})
+		case r.Hash != hash:
+			plan.Changes = append(plan.Changes, Change{Action: ActionUpdate, Name: name, ID: r.ID, Config: c, Hash: hash})
+		default:
+			plan.Unchanged = append(plan.Unchanged, name)
+		}
+	}
+	return plan, nil
+}
+
+// dependencyOrder sorts the container names so every container comes after
+// the containers it depends on, otherwise by name.
+func dependencyOrder(conf *config.UltimateConfig) ([]string, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+
+	order := make([]string, 0, len(conf.Containers))
+	marks := make(map[string]int, len(conf.Containers))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch marks[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		}
+		marks[name] = visiting
+
+		deps := slices.Clone(conf.Containers[name].GetFull().DependsOn)
+		slices.Sort(deps)
+		for _, dep := range deps {
+			if _, ok := conf.Containers[dep]; !ok {
+				return fmt.Errorf("container %s depends on unknown container %s", name, dep)
+			}
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+
+		marks[name] = done
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range conf.Names() {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,278 @@
+package dockr_test
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"Infra/internal/dockr/state"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+
+	conf, err := config.NewContainersConfig(
+		config.ContainerConfig{Name: "api", Image: "api:1", DependsOn: []string{"db", "cache"}},
+		config.ContainerConfig{Name: "cache", Image: "redis:7"},
+		config.ContainerConfig{Name: "db", Image: "postgres:16"},
+		config.ContainerConfig{Name: "web", Image: "nginx:alpine", DependsOn: []string{"api"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := func(name string) string {
+		h, err := dockr.ConfigHash(conf.Containers[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		plan, err := dockr.Diff(conf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, c := range plan.Changes {
+			if c.Action != dockr.ActionCreate {
+				t.Errorf("unexpected action %s for %s", c.Action, c.Name)
+			}
+			names = append(names, c.Name)
+		}
+		if !slices.Equal(names, []string{"cache", "db", "api", "web"}) {
+			t.Errorf("containers not in dependency order: %v", names)
+		}
+	})
+
+	t.Run("Changes", func(t *testing.T) {
+		running := []dockr.Running{
+			{Name: "api", ID: "1", Hash: "outdated"},
+			{Name: "cache", ID: "2", Hash: hash("cache")},
+			{Name: "db", ID: "3", Hash: hash("db")},
+			{Name: "old", ID: "4", Hash: "x"},
+		}
+
+		plan, err := dockr.Diff(conf, running)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []dockr.Change{
+			{Action: dockr.ActionRemove, Name: "old", ID: "4"},
+			{Action: dockr.ActionUpdate, Name: "api", ID: "1"},
+			{Action: dockr.ActionCreate, Name: "web"},
+		}
+		if len(plan.Changes) != len(want) {
+			t.Fatalf("unexpected plan:\n%s", plan)
+		}
+		for i, c := range plan.Changes {
+			if c.Action != want[i].Action || c.Name != want[i].Name || c.ID != want[i].ID {
+				t.Errorf("change %d: got %s %s (%s), want %s %s (%s)", i, c.Action, c.Name, c.ID, want[i].Action, want[i].Name, want[i].ID)
+			}
+		}
+		if !slices.Equal(plan.Unchanged, []string{"cache", "db"}) {
+			t.Errorf("unexpected unchanged containers %v", plan.Unchanged)
+		}
+	})
+
+	t.Run("UpToDate", func(t *testing.T) {
+		running := make([]dockr.Running, 0)
+		for _, name := range conf.Names() {
+			running = append(running, dockr.Running{Name: name, Hash: hash(name)})
+		}
+
+		plan, err := dockr.Diff(conf, running)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !plan.Empty() {
+			t.Errorf("expected empty plan, got:\n%s", plan)
+		}
+	})
+
+	t.Run("HashIgnoresSource", func(t *testing.T) {
+		c := *conf.Containers["db"].GetFull()
+		c.Source = "other.yaml"
+		h, err := dockr.ConfigHash(&c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != hash("db") {
+			t.Error("hash depends on the source file")
+		}
+	})
+
+	t.Run("InvalidDependencies", func(t *testing.T) {
+		unknown, err := config.NewContainersConfig(
+			config.ContainerConfig{Name: "api", Image: "api:1", DependsOn: []string{"db"}},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = dockr.Diff(unknown, nil); err == nil {
+			t.Error("expected error for unknown dependency")
+		}
+
+		cycle, err := config.NewContainersConfig(
+			config.ContainerConfig{Name: "a", Image: "a", DependsOn: []string{"b"}},
+			config.ContainerConfig{Name: "b", Image: "b", DependsOn: []string{"a"}},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = dockr.Diff(cycle, nil); err == nil {
+			t.Error("expected error for dependency cycle")
+		}
+	})
+}
+
+func TestPlanReadOnly(t *testing.T) {
+	newFakeDaemon(t)
+	dir := t.TempDir()
+	t.Setenv(state.EnvStateDir, dir)
+	path := filepath.Join(dir, "state.json")
+
+	doc, err := dockr.NewDockr(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doc.Close()
+
+	password := func(t *testing.T) string {
+		t.Helper()
+		conf, err := config.NewContainersConfig(config.PostgresConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := doc.Plan(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plan.Changes) != 1 {
+			t.Fatalf("unexpected plan:\n%s", plan)
+		}
+		return plan.Changes[0].Config.GetFull().EnvVars["POSTGRES_PASSWORD"]
+	}
+
+	t.Run("Generated", func(t *testing.T) {
+		if len(password(t)) != 32 {
+			t.Error("credential was not generated for the plan")
+		}
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("plan wrote the state file: %v", err)
+		}
+	})
+
+	t.Run("Stored", func(t *testing.T) {
+		store, err := state.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = store.SetSecret("DB", "POSTGRES_PASSWORD", "stored"); err != nil {
+			t.Fatal(err)
+		}
+		before, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// reopen, the store of doc does not see the write
+		doc, err = dockr.NewDockr(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer doc.Close()
+		if got := password(t); got != "stored" {
+			t.Errorf("plan did not use the stored credential, got %q", got)
+		}
+		after, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(before, after) {
+			t.Errorf("plan changed the state file:\n%s", after)
+		}
+	})
+
+	t.Run("ConfigUnchanged", func(t *testing.T) {
+		conf, err := config.NewContainersConfig(
+			config.PostgresConfig,
+			config.ContainerConfig{Name: "worker", Image: "busybox:1.36", Replicas: 2},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = doc.Plan(conf); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(conf.Names(), []string{"DB", "worker"}) {
+			t.Errorf("plan expanded the replicas of the config: %v", conf.Names())
+		}
+		if env := conf.Containers["DB"].GetFull().EnvVars; env["POSTGRES_PASSWORD"] != "" {
+			t.Errorf("plan resolved the secrets of the config: %v", env)
+		}
+	})
+}
+
+func TestPlanProjects(t *testing.T) {
+	daemon := newFakeDaemon(t)
+	t.Setenv(state.EnvStateDir, t.TempDir())
+	daemon.managed = []fakeContainer{
+		// deployed before projects were set
+		{name: "web", image: "nginx:1.26"},
+		{name: "old", image: "old:1"},
+		{name: "blog", image: "ghost:5", project: "blog"},
+	}
+
+	doc, err := dockr.NewDockr(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doc.Close()
+
+	plan := func(t *testing.T, project string) []string {
+		t.Helper()
+		conf, err := config.NewContainersConfig(
+			config.ContainerConfig{Name: "web", Image: "nginx:1.27"},
+			config.ContainerConfig{Name: "db", Image: "postgres:16"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.SetProject(project)
+		defer doc.SetProject("")
+
+		p, err := doc.Plan(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var changes []string
+		for _, c := range p.Changes {
+			changes = append(changes, string(c.Action)+" "+c.Name)
+		}
+		return changes
+	}
+
+	t.Run("Adopt", func(t *testing.T) {
+		// the unlabelled web is replaced instead of duplicated, old is not
+		// part of the config and left alone like the other project
+		want := []string{"create db", "update web"}
+		if got := plan(t, "shop"); !slices.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("NoProject", func(t *testing.T) {
+		want := []string{"remove old", "create db", "update web"}
+		if got := plan(t, ""); !slices.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+}
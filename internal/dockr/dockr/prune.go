@@ -0,0 +1,197 @@
+package dockr
+
+import (
+	"Infra/internal/dockr/config"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+)
+
+// DefaultPruneKeep is the number of latest revisions whose images are kept
+// for rollbacks.
+const DefaultPruneKeep = 3
+
+// PruneOptions select the images PruneImages keeps.
+type PruneOptions struct {
+	// Keep is the number of latest revisions whose images are kept, 0 keeps
+	// the images of the current config only.
+	Keep int
+	// Lock protects the images pinned in a lockfile, may be nil.
+	Lock *config.Lock
+	// DryRun reports the images without removing them.
+	DryRun bool
+}
+
+// PruneImage is an image reference removed by PruneImages. Reclaimed is set
+// when the removal frees the image, not only one of its tags.
+type PruneImage struct {
+	Image     string
+	ID        string
+	Size      int64
+	Reclaimed bool
+}
+
+// PruneReport lists the images PruneImages removed, or would remove in a
+// dry run.
+type PruneReport struct {
+	Images    []PruneImage
+	Reclaimed int64
+	DryRun    bool
+}
+
+// String renders the report as a table.
+func (r *PruneReport) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tID\tSIZE\tRECLAIMED")
+	for _, img := range r.Images {
+		reclaimed := "untag"
+		if img.Reclaimed {
+			reclaimed = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", img.Image, shortID(img.ID), units.HumanSize(float64(img.Size)), reclaimed)
+	}
+	w.Flush()
+
+	verb := "reclaimed"
+	if r.DryRun {
+		verb = "would reclaim"
+	}
+	fmt.Fprintf(&b, "%d images, %s %s\n", len(r.Images), verb, units.HumanSize(float64(r.Reclaimed)))
+	return b.String()
+}
+
+// PruneImages removes the images Infra deployed or built that are no longer
+// needed. Images of the recorded revisions and built images are candidates;
+// the images of conf, of the latest opts.Keep revisions, pinned in opts.Lock
+// or used by any container are kept. An image that cannot be removed is
+// logged and skipped.
+func (d *Dockr) PruneImages(conf *config.UltimateConfig, opts PruneOptions) (*PruneReport, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("ultimate config is nil")
+	}
+
+	keep := make(map[string]bool)
+	for _, c := range conf.Containers {
+		keep[c.GetImage()] = true
+	}
+	if opts.Lock != nil {
+		for img, pinned := range opts.Lock.Images {
+			keep[img], keep[pinned] = true, true
+		}
+	}
+
+	var candidates []string
+	revisions := d.store.Revisions()
+	for i, rev := range revisions {
+		recent := i >= len(revisions)-opts.Keep
+		for _, c := range rev.Containers {
+			if recent {
+				keep[c.Image] = true
+			}
+			candidates = append(candidates, c.Image)
+		}
+	}
+
+	built, err := d.cli.ImageList(d.ctx, image.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelBuildHash)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error list images: %s", err)
+	}
+	for _, img := range built {
+		if len(img.RepoTags) == 0 {
+			// a rebuild leaves the previous image without a tag
+			candidates = append(candidates, img.ID)
+		}
+		candidates = append(candidates, img.RepoTags...)
+	}
+
+	// images are kept by ID, an old tag of a kept image only frees its name
+	keepIDs := make(map[string]bool)
+	for ref := range keep {
+		if inspect, _, err := d.cli.ImageInspectWithRaw(d.ctx, ref); err == nil {
+			keepIDs[inspect.ID] = true
+		}
+	}
+	containers, err := d.cli.ContainerList(d.ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("error list containers: %s", err)
+	}
+	for _, c := range containers {
+		keepIDs[c.ImageID] = true
+	}
+
+	slices.Sort(candidates)
+	candidates = slices.Compact(candidates)
+
+	report := &PruneReport{DryRun: opts.DryRun}
+	removing := make(map[string][]string)
+	tags := make(map[string][]string)
+	for _, ref := range candidates {
+		if keep[ref] {
+			continue
+		}
+		inspect, _, err := d.cli.ImageInspectWithRaw(d.ctx, ref)
+		if client.IsErrNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error inspect image: %s", err)
+		}
+		if keepIDs[inspect.ID] {
+			continue
+		}
+
+		report.Images = append(report.Images, PruneImage{Image: ref, ID: inspect.ID, Size: inspect.Size})
+		removing[inspect.ID] = append(removing[inspect.ID], ref)
+		tags[inspect.ID] = inspect.RepoTags
+	}
+
+	// an image is freed when every tag of it goes
+	for i, img := range report.Images {
+		freed := true
+		for _, tag := range tags[img.ID] {
+			freed = freed && slices.Contains(removing[img.ID], tag)
+		}
+		if freed && removing[img.ID][0] == img.Image {
+			report.Images[i].Reclaimed = true
+		}
+	}
+
+	if !opts.DryRun {
+		removed := report.Images[:0]
+		for _, img := range report.Images {
+			if _, err := d.cli.ImageRemove(d.ctx, img.Image, image.RemoveOptions{PruneChildren: true}); err != nil {
+				d.logger.Warnf("error remove image %s: %v", img.Image, err)
+				continue
+			}
+			removed = append(removed, img)
+		}
+		report.Images = removed
+	}
+
+	for _, img := range report.Images {
+		if img.Reclaimed {
+			report.Reclaimed += img.Size
+		}
+	}
+	return report, nil
+}
+
+// shortID returns the first 12 hex digits of an image ID.
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
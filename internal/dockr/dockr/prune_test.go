@@ -0,0 +1,85 @@
+package dockr_test
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/dockr"
+	"Infra/internal/dockr/state"
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestPruneImages(t *testing.T) {
+	daemon := newFakeDaemon(t)
+
+	store, err := state.Open(state.DefaultPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, images := range [][]string{
+		{"app:1", "cache:7"},
+		{"app:2", "cache:7"},
+		{"app:3", "worker:1"},
+		{"app:4", "worker:1"},
+		{"app:5", "worker:1"},
+	} {
+		if _, err = store.AddRevision(map[string]state.RevisionContainer{
+			"app":    {Image: images[0]},
+			"helper": {Image: images[1]},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		for _, img := range images {
+			daemon.images[img] = nil
+		}
+	}
+	daemon.images["infra/api:old"] = map[string]string{dockr.LabelBuildHash: "old"}
+	// a container outside of Infra still runs app:2
+	daemon.containers = []string{"app:2"}
+
+	d, err := dockr.NewDockr(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	conf, err := config.NewContainersConfig(
+		config.ContainerConfig{Name: "app", Image: "app:5"},
+		config.ContainerConfig{Name: "helper", Image: "worker:1"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := dockr.PruneOptions{
+		Keep:   2,
+		Lock:   &config.Lock{Images: map[string]string{"cache:7": "cache@sha256:0123"}},
+		DryRun: true,
+	}
+
+	report, err := d.PruneImages(conf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var images []string
+	for _, img := range report.Images {
+		images = append(images, img.Image)
+	}
+	want := []string{"app:1", "app:3", "infra/api:old"}
+	if !slices.Equal(images, want) {
+		t.Errorf("expected to prune %v, got %v", want, images)
+	}
+	if report.Reclaimed != 3*1024 {
+		t.Errorf("unexpected reclaimed size %d", report.Reclaimed)
+	}
+	if len(daemon.removed) != 0 {
+		t.Errorf("a dry run removed %v", daemon.removed)
+	}
+
+	opts.DryRun = false
+	if _, err = d.PruneImages(conf, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(daemon.removed, want) {
+		t.Errorf("expected %v to be removed, got %v", want, daemon.removed)
+	}
+}
@@ -0,0 +1,261 @@
+package dockr
+
+import (
+	"Infra/internal/dockr/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/go-units"
+)
+
+// DefaultPullConcurrency is the number of images pulled at the same time.
+const DefaultPullConcurrency = 3
+
+// PullEvent is a progress update of an image pull. Layer events carry the
+// layer ID, image events (resolving, digest, status) have none. The last
+// event of a pull has Done set, and Err when the pull failed.
+type PullEvent struct {
+	Image   string
+	Layer   string
+	Status  string
+	Current int64
+	Total   int64
+	Done    bool
+	Err     error
+}
+
+// PullSummary describes a finished pull.
+type PullSummary struct {
+	Image    string
+	Digest   string
+	Layers   int
+	Bytes    int64
+	Duration time.Duration
+}
+
+// imagePull is an image to make present on the host, its pull policy and
+// the registry credentials of its container.
+type imagePull struct {
+	image  string
+	policy string
+	auth   *config.RegistryAuthConfig
+}
+
+func (d *Dockr) imagePullOf(c config.ContainerConfiguration) imagePull {
+	return imagePull{
+		image:  c.GetImage(),
+		policy: config.PullPolicyOf(c.GetFull(), d.pullPolicy),
+		auth:   c.GetRegistryAuth(),
+	}
+}
+
+// SetPullPolicy sets the pull policy of the containers without one of their
+// own, see config.PullPolicyOf. An empty policy restores the default.
+func (d *Dockr) SetPullPolicy(policy string) error {
+	if policy == "" {
+		d.pullPolicy = ""
+		return nil
+	}
+	policy, err := config.ParsePullPolicy(policy)
+	if err != nil {
+		return err
+	}
+	d.pullPolicy = policy
+	return nil
+}
+
+// SetPullConcurrency sets how many images are pulled at the same time, n < 1
+// restores DefaultPullConcurrency.
+func (d *Dockr) SetPullConcurrency(n int) {
+	d.pullConcurrency = n
+}
+
+// OnPullProgress sets fn to receive the progress of image pulls. Events of
+// concurrent pulls are delivered one at a time.
+func (d *Dockr) OnPullProgress(fn func(PullEvent)) {
+	d.pullProgress = fn
+}
+
+// pullImages makes every distinct image present following its pull policy,
+// pulling up to the pull concurrency at the same time, and fails listing the
+// images that could not be pulled. An image wanted with different policies
+// follows the one that pulls most: always, then if-not-present. An image
+// is pulled with the first registry_auth set by a container running it, see
+// registryAuth.
+func (d *Dockr) pullImages(pulls []imagePull) error {
+	policies := make(map[string]string, len(pulls))
+	auths := make(map[string]*config.RegistryAuthConfig)
+	for _, p := range pulls {
+		if current, ok := policies[p.image]; !ok || pullRank(p.policy) < pullRank(current) {
+			policies[p.image] = p.policy
+		}
+		if _, ok := auths[p.image]; !ok && p.auth != nil {
+			auths[p.image] = p.auth
+		}
+	}
+	images := make([]string, 0, len(policies))
+	for img := range policies {
+		images = append(images, img)
+	}
+	slices.Sort(images)
+
+	limit := d.pullConcurrency
+	if limit < 1 {
+		limit = DefaultPullConcurrency
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+		sem    = make(chan struct{}, limit)
+	)
+	emit := func(e PullEvent) {
+		if d.pullProgress == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		d.pullProgress(e)
+	}
+
+	for _, img := range images {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			pull, err := d.needsPull(img, policies[img])
+			if err == nil && !pull {
+				d.logger.Infof("using image %s present on the host (pull policy %s)", img, policies[img])
+				return
+			}
+
+			var summary PullSummary
+			if err == nil {
+				summary, err = d.pullImage(img, auths[img], emit)
+				emit(PullEvent{Image: img, Done: true, Err: err})
+			}
+			if err != nil {
+				d.logger.Errorf("error pulling image %s: %v", img, err)
+				mu.Lock()
+				failed = append(failed, img)
+				mu.Unlock()
+				return
+			}
+			d.logger.Infof("pulled %s (%s, %d layers, %s in %s)", img, summary.Digest, summary.Layers,
+				units.HumanSize(float64(summary.Bytes)), summary.Duration.Round(time.Millisecond))
+		}()
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		slices.Sort(failed)
+		return fmt.Errorf("failed to pull images: %v", failed)
+	}
+	return nil
+}
+
+// needsPull reports whether img has to be pulled under policy.
+func (d *Dockr) needsPull(img, policy string) (bool, error) {
+	if policy == config.PullAlways {
+		return true, nil
+	}
+
+	_, _, err := d.cli.ImageInspectWithRaw(d.ctx, img)
+	switch {
+	case err == nil:
+		return false, nil
+	case !client.IsErrNotFound(err):
+		return false, fmt.Errorf("error inspect image: %s", err)
+	case policy == config.PullNever:
+		return false, fmt.Errorf("image is not present and the pull policy is never")
+	}
+	return true, nil
+}
+
+func pullRank(policy string) int {
+	switch policy {
+	case config.PullAlways:
+		return 0
+	case config.PullIfNotPresent:
+		return 1
+	}
+	return 2
+}
+
+func (d *Dockr) pullImage(img string, auth *config.RegistryAuthConfig, emit func(PullEvent)) (PullSummary, error) {
+	start := time.Now()
+	encoded, err := d.registryAuth(img, auth)
+	if err != nil {
+		return PullSummary{}, err
+	}
+	out, err := d.cli.ImagePull(d.ctx, img, image.PullOptions{RegistryAuth: encoded})
+	if err != nil {
+		return PullSummary{}, err
+	}
+	defer out.Close()
+
+	summary, err := ReadPullProgress(img, out, emit)
+	summary.Duration = time.Since(start)
+	return summary, err
+}
+
+// ReadPullProgress decodes the JSON message stream of an image pull into
+// events for fn and summarises it. Errors reported in the stream are
+// returned.
+func ReadPullProgress(img string, r io.Reader, fn func(PullEvent)) (PullSummary, error) {
+	summary := PullSummary{Image: img}
+	layers := make(map[string]int64)
+
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return summary, fmt.Errorf("error read pull progress: %s", err)
+		}
+		if msg.Error != nil {
+			return summary, msg.Error
+		}
+
+		e := PullEvent{Image: img, Status: msg.Status}
+		// "latest: Pulling from library/nginx" carries the tag, not a layer
+		if msg.ID != "" && !strings.HasPrefix(msg.Status, "Pulling from") {
+			e.Layer = msg.ID
+			if _, ok := layers[msg.ID]; !ok {
+				layers[msg.ID] = 0
+			}
+		}
+		if msg.Progress != nil {
+			e.Current, e.Total = msg.Progress.Current, msg.Progress.Total
+			if msg.Status == "Downloading" && e.Layer != "" {
+				layers[e.Layer] = max(layers[e.Layer], e.Total)
+			}
+		}
+		if digest, ok := strings.CutPrefix(msg.Status, "Digest: "); ok {
+			summary.Digest = digest
+		}
+		if fn != nil {
+			fn(e)
+		}
+	}
+
+	summary.Layers = len(layers)
+	for _, size := range layers {
+		summary.Bytes += size
+	}
+	return summary, nil
+}
@@ -0,0 +1,54 @@
+package dockr_test
+
+import (
+	"Infra/internal/dockr/dockr"
+	"strings"
+	"testing"
+)
+
+func TestReadPullProgress(t *testing.T) {
+
+	t.Run("Layers", func(t *testing.T) {
+		stream := strings.Join([]string{
+			`{"status":"Pulling from library/nginx","id":"latest"}`,
+			`{"status":"Pulling fs layer","progressDetail":{},"id":"a1"}`,
+			`{"status":"Already exists","progressDetail":{},"id":"b2"}`,
+			`{"status":"Downloading","progressDetail":{"current":512,"total":2048},"progress":"[=>  ]","id":"a1"}`,
+			`{"status":"Downloading","progressDetail":{"current":2048,"total":2048},"progress":"[====]","id":"a1"}`,
+			`{"status":"Pull complete","progressDetail":{},"id":"a1"}`,
+			`{"status":"Digest: sha256:abc"}`,
+			`{"status":"Status: Downloaded newer image for nginx:latest"}`,
+		}, "\n")
+
+		var events []dockr.PullEvent
+		summary, err := dockr.ReadPullProgress("nginx:latest", strings.NewReader(stream), func(e dockr.PullEvent) {
+			events = append(events, e)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(events) != 8 {
+			t.Fatalf("expected 8 events, got %d", len(events))
+		}
+		if events[0].Layer != "" {
+			t.Errorf("the tag is not a layer: %+v", events[0])
+		}
+		if e := events[3]; e.Layer != "a1" || e.Current != 512 || e.Total != 2048 {
+			t.Errorf("unexpected progress event %+v", e)
+		}
+		if summary.Digest != "sha256:abc" || summary.Layers != 2 || summary.Bytes != 2048 {
+			t.Errorf("unexpected summary %+v", summary)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		stream := `{"status":"Pulling from library/nginx","id":"latest"}
+{"errorDetail":{"message":"manifest unknown"},"error":"manifest unknown"}`
+
+		_, err := dockr.ReadPullProgress("nginx:nope", strings.NewReader(stream), nil)
+		if err == nil || !strings.Contains(err.Error(), "manifest unknown") {
+			t.Errorf("expected the stream error, got %v", err)
+		}
+	})
+}
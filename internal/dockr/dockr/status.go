@@ -0,0 +1,232 @@
+package dockr
+
+import (
+	entity "Infra/internal/dockr/container"
+	"Infra/internal/dockr/state"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// statusSettle is how long WatchStatus waits for further events before it
+// lists the containers again, so a deployment touching many containers is
+// shown once rather than once per event.
+const statusSettle = 200 * time.Millisecond
+
+// ContainerState is the live state of a deployed container: its Running entry
+// with the details of the daemon and the revision of the state store that
+// deployed it. Its JSON and YAML form is documented, fields are only ever
+// added to it.
+type ContainerState struct {
+	Running `yaml:",inline"`
+	// ContainerStatus is State as the status of a container entity.
+	ContainerStatus entity.ContainerStatus `json:"container_status" yaml:"container_status"`
+	// Digest is the registry digest of the image, empty for local images.
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+	// Health is "starting", "healthy" or "unhealthy", empty without a health
+	// check.
+	Health string `json:"health,omitempty" yaml:"health,omitempty"`
+	// StartedAt is nil when the container is not running.
+	StartedAt    *time.Time `json:"started_at,omitempty" yaml:"started_at,omitempty"`
+	RestartCount int        `json:"restart_count" yaml:"restart_count"`
+	// Ports are the published ports, e.g. "0.0.0.0:8080->80/tcp".
+	Ports    []string `json:"ports,omitempty" yaml:"ports,omitempty"`
+	Networks []string `json:"networks,omitempty" yaml:"networks,omitempty"`
+	// Revision is the applied revision that deployed the container with its
+	// current config, 0 when the state store does not know it.
+	Revision int `json:"revision,omitempty" yaml:"revision,omitempty"`
+}
+
+// Uptime returns how long the container has been running, 0 when it is not.
+func (s ContainerState) Uptime() time.Duration {
+	if s.StartedAt == nil {
+		return 0
+	}
+	return time.Since(*s.StartedAt).Round(time.Second)
+}
+
+// Status lists the containers of the current deployment like Running, in
+// name order, with their state in the daemon and the state store.
+func (d *Dockr) Status() ([]ContainerState, error) {
+	running, err := d.Running()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(running, func(a, b Running) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	revisions := d.store.Revisions()
+	digests := make(map[string]string)
+	res := make([]ContainerState, 0, len(running))
+	for _, r := range running {
+		inspect, err := d.cli.ContainerInspect(d.ctx, r.ID)
+		if client.IsErrNotFound(err) {
+			// removed since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error inspect container %s: %s", r.Name, err)
+		}
+
+		s := ContainerState{
+			Running:         r,
+			ContainerStatus: containerStatus(inspect.State),
+			RestartCount:    inspect.RestartCount,
+			Revision:        deployedRevision(revisions, r),
+		}
+		if inspect.State != nil {
+			if inspect.State.Health != nil {
+				s.Health = inspect.State.Health.Status
+			}
+			if started, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt); err == nil && inspect.State.Running {
+				s.StartedAt = &started
+			}
+		}
+		if inspect.NetworkSettings != nil {
+			s.Ports = publishedPorts(inspect.NetworkSettings)
+			for name := range inspect.NetworkSettings.Networks {
+				s.Networks = append(s.Networks, name)
+			}
+			slices.Sort(s.Networks)
+		}
+
+		digest, ok := digests[inspect.Image]
+		if !ok {
+			digest, err = d.imageDigest(r.Image, inspect.Image)
+			if err != nil {
+				return nil, err
+			}
+			digests[inspect.Image] = digest
+		}
+		s.Digest = digest
+
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// WatchStatus passes the Status of the deployment to show, and does so again
+// every time the daemon reports an event of its containers, until the context
+// of d is done.
+func (d *Dockr) WatchStatus(show func([]ContainerState)) error {
+	args := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("label", LabelManaged+"=true"),
+	)
+	if d.project != "" {
+		args.Add("label", LabelProject+"="+d.project)
+	}
+	// subscribe before listing, so no event between the two is missed
+	messages, errs := d.cli.Events(d.ctx, events.ListOptions{Filters: args})
+
+	var settle <-chan time.Time
+	for {
+		if settle == nil {
+			states, err := d.Status()
+			if err != nil {
+				return err
+			}
+			show(states)
+		}
+
+		select {
+		case <-d.ctx.Done():
+			return nil
+		case err := <-errs:
+			if d.ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("error watch events: %s", err)
+		case msg := <-messages:
+			d.logger.Debugf("container %s: %s", msg.Actor.Attributes["name"], msg.Action)
+			if settle == nil {
+				settle = time.After(statusSettle)
+			}
+		case <-settle:
+			settle = nil
+		}
+	}
+}
+
+// imageDigest returns the registry digest of image, the image ID a container
+// runs, for the reference the container was created with.
+func (d *Dockr) imageDigest(ref, image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		// containers created from an image ID
+		return "", nil
+	}
+	if canonical, ok := named.(reference.Canonical); ok {
+		return canonical.Digest().String(), nil
+	}
+
+	inspect, _, err := d.cli.ImageInspectWithRaw(d.ctx, image)
+	if client.IsErrNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error inspect image %s: %s", ref, err)
+	}
+	for _, repoDigest := range inspect.RepoDigests {
+		pinned, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+		if canonical, ok := pinned.(reference.Canonical); ok && pinned.Name() == named.Name() {
+			return canonical.Digest().String(), nil
+		}
+	}
+	return "", nil
+}
+
+// containerStatus maps the state of a Docker container to the status of a
+// container entity. Containers that exited with an error, were killed for
+// lack of memory or are dead have failed.
+func containerStatus(s *types.ContainerState) entity.ContainerStatus {
+	switch {
+	case s == nil:
+		return entity.ContainerStatusFailed()
+	case s.Running:
+		return entity.ContainerStatusRunning()
+	case s.Status == "created":
+		return entity.ContainerStatusCreated()
+	case s.Dead || s.OOMKilled || s.ExitCode != 0:
+		return entity.ContainerStatusFailed()
+	default:
+		return entity.ContainerStatusStopped()
+	}
+}
+
+// publishedPorts returns the published ports of a container, sorted.
+func publishedPorts(settings *types.NetworkSettings) []string {
+	var ports []string
+	for port, bindings := range settings.Ports {
+		for _, b := range bindings {
+			ports = append(ports, fmt.Sprintf("%s:%s->%s", b.HostIP, b.HostPort, port))
+		}
+	}
+	slices.Sort(ports)
+	return ports
+}
+
+// deployedRevision returns the first revision of the latest unbroken run of
+// revisions that ran the container with the config hash it has.
+func deployedRevision(revisions []state.Revision, r Running) int {
+	number := 0
+	for i := len(revisions) - 1; i >= 0; i-- {
+		c, ok := revisions[i].Containers[r.Name]
+		if !ok || c.Hash != r.Hash {
+			break
+		}
+		number = revisions[i].Number
+	}
+	return number
+}
@@ -0,0 +1,87 @@
+package dockr_test
+
+import (
+	entity "Infra/internal/dockr/container"
+	"Infra/internal/dockr/dockr"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestStatus(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	daemon := newFakeDaemon(t)
+	daemon.digests["nginx"] = digest
+	daemon.images["nginx:1.27"] = nil
+	daemon.managed = []fakeContainer{
+		{name: "web", image: "nginx:1.27", health: "healthy"},
+		{name: "db", image: "postgres:16"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	doc, err := dockr.NewDockr(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doc.Close()
+
+	t.Run("List", func(t *testing.T) {
+		states, err := doc.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(states) != 2 || states[0].Name != "db" || states[1].Name != "web" {
+			t.Fatalf("unexpected states %+v", states)
+		}
+
+		db, web := states[0], states[1]
+		if web.ContainerStatus != entity.ContainerStatusRunning() || web.Health != "healthy" || web.Digest != digest {
+			t.Errorf("unexpected web %+v", web)
+		}
+		if db.Health != "" || db.Digest != "" {
+			t.Errorf("unexpected db %+v", db)
+		}
+		if web.RestartCount != 1 || web.StartedAt == nil || web.Uptime() <= 0 {
+			t.Errorf("unexpected uptime of web %+v", web)
+		}
+		if !slices.Equal(web.Ports, []string{"0.0.0.0:8080->80/tcp"}) || !slices.Equal(web.Networks, []string{"bridge"}) {
+			t.Errorf("unexpected ports %v / networks %v", web.Ports, web.Networks)
+		}
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		shown := make(chan []dockr.ContainerState)
+		done := make(chan error)
+		go func() {
+			done <- doc.WatchStatus(func(states []dockr.ContainerState) { shown <- states })
+		}()
+
+		if states := <-shown; len(states) != 2 {
+			t.Fatalf("unexpected initial states %+v", states)
+		}
+
+		daemon.mu.Lock()
+		daemon.managed = daemon.managed[:1]
+		daemon.mu.Unlock()
+		daemon.events <- events.Message{Type: events.ContainerEventType, Action: events.ActionDestroy}
+
+		select {
+		case states := <-shown:
+			if len(states) != 1 || states[0].Name != "web" {
+				t.Errorf("unexpected states after the event %+v", states)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no refresh after the event")
+		}
+
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error when the context is done: %v", err)
+		}
+	})
+}
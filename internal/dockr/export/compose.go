@@ -0,0 +1,231 @@
+package export
+
+import (
+	"Infra/internal/dockr/config"
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+	Networks map[string]struct{}       `yaml:"networks,omitempty"`
+	Volumes  map[string]struct{}       `yaml:"volumes,omitempty"`
+}
+
+type composeService struct {
+	Image       string                   `yaml:"image"`
+	Build       *config.BuildConfig      `yaml:"build,omitempty"`
+	PullPolicy  string                   `yaml:"pull_policy,omitempty"`
+	Hostname    string                   `yaml:"hostname,omitempty"`
+	WorkingDir  string                   `yaml:"working_dir,omitempty"`
+	Command     []string                 `yaml:"command,omitempty"`
+	Environment map[string]string        `yaml:"environment,omitempty"`
+	Ports       []string                 `yaml:"ports,omitempty"`
+	Volumes     []string                 `yaml:"volumes,omitempty"`
+	NetworkMode string                   `yaml:"network_mode,omitempty"`
+	Networks    []string                 `yaml:"networks,omitempty"`
+	Restart     string                   `yaml:"restart,omitempty"`
+	HealthCheck *composeHealth           `yaml:"healthcheck,omitempty"`
+	DependsOn   []string                 `yaml:"depends_on,omitempty"`
+	CPUSet      string                   `yaml:"cpuset,omitempty"`
+	ShmSize     string                   `yaml:"shm_size,omitempty"`
+	Ulimits     map[string]config.Ulimit `yaml:"ulimits,omitempty"`
+	Deploy      composeDeploy            `yaml:"deploy"`
+
+	Entrypoint      []string              `yaml:"entrypoint,omitempty"`
+	User            string                `yaml:"user,omitempty"`
+	Labels          map[string]string     `yaml:"labels,omitempty"`
+	StopSignal      string                `yaml:"stop_signal,omitempty"`
+	StopGracePeriod string                `yaml:"stop_grace_period,omitempty"`
+	Tty             bool                  `yaml:"tty,omitempty"`
+	CapAdd          []string              `yaml:"cap_add,omitempty"`
+	CapDrop         []string              `yaml:"cap_drop,omitempty"`
+	Privileged      bool                  `yaml:"privileged,omitempty"`
+	ReadOnly        bool                  `yaml:"read_only,omitempty"`
+	SecurityOpt     []string              `yaml:"security_opt,omitempty"`
+	Sysctls         map[string]string     `yaml:"sysctls,omitempty"`
+	Devices         []string              `yaml:"devices,omitempty"`
+	DNS             []string              `yaml:"dns,omitempty"`
+	DNSSearch       []string              `yaml:"dns_search,omitempty"`
+	ExtraHosts      []string              `yaml:"extra_hosts,omitempty"`
+	Init            *bool                 `yaml:"init,omitempty"`
+	Logging         *config.LoggingConfig `yaml:"logging,omitempty"`
+}
+
+type composeHealth struct {
+	Test        []string `yaml:"test"`
+	Interval    string   `yaml:"interval,omitempty"`
+	Timeout     string   `yaml:"timeout,omitempty"`
+	Retries     int      `yaml:"retries,omitempty"`
+	StartPeriod string   `yaml:"start_period,omitempty"`
+}
+
+type composeDeploy struct {
+	Replicas  int `yaml:"replicas,omitempty"`
+	Resources struct {
+		Limits       composeResources `yaml:"limits"`
+		Reservations composeResources `yaml:"reservations"`
+	} `yaml:"resources"`
+}
+
+type composeResources struct {
+	CPUs   string `yaml:"cpus,omitempty"`
+	Memory string `yaml:"memory,omitempty"`
+	Pids   int64  `yaml:"pids,omitempty"`
+}
+
+// Compose generates a docker-compose file. Credentials are interpolated from
+// the environment of the compose invocation (${DB_POSTGRES_PASSWORD:?...}).
+func Compose(ulti *config.UltimateConfig) ([]byte, error) {
+	conf, err := containers(ulti)
+	if err != nil {
+		return nil, err
+	}
+
+	file := composeFile{
+		Services: make(map[string]composeService, len(conf)),
+		Networks: make(map[string]struct{}),
+		Volumes:  make(map[string]struct{}),
+	}
+
+	for _, c := range conf {
+		name := c.GetName()
+		svc := composeService{
+			Image:       c.Image,
+			Build:       c.Build,
+			Hostname:    c.Hostname,
+			WorkingDir:  c.WorkingDir,
+			Command:     c.Cmd,
+			Environment: make(map[string]string, len(c.EnvVars)),
+			Ports:       c.Ports,
+			DependsOn:   c.DependsOn,
+			Restart:     c.RestartPolicy,
+
+			Entrypoint:      c.Entrypoint,
+			User:            c.User,
+			Labels:          c.Labels,
+			StopSignal:      c.StopSignal,
+			StopGracePeriod: c.StopTimeout,
+			Tty:             c.Tty,
+			CapAdd:          c.CapAdd,
+			CapDrop:         c.CapDrop,
+			Privileged:      c.Privileged,
+			ReadOnly:        c.ReadOnly,
+			SecurityOpt:     c.SecurityOpt,
+			Sysctls:         c.Sysctls,
+			Devices:         c.Devices,
+			DNS:             c.DNS,
+			DNSSearch:       c.DNSSearch,
+			ExtraHosts:      c.ExtraHosts,
+			Init:            c.Init,
+			Logging:         c.Logging,
+		}
+
+		for k, v := range c.EnvVars {
+			svc.Environment[k] = config.ReplaceSecretRefs(v, func(ref config.SecretRef) string {
+				return composeVar(envName(ref.Container, ref.Key))
+			})
+		}
+		for _, key := range credentials(c) {
+			if svc.Environment[key] == "" {
+				svc.Environment[key] = composeVar(envName(name, key))
+			}
+		}
+
+		for _, v := range c.Volumes {
+			vol, err := parseVolume(v)
+			if err != nil {
+				return nil, fmt.Errorf("container %s: %w", name, err)
+			}
+			if vol.named {
+				file.Volumes[vol.source] = struct{}{}
+			}
+			svc.Volumes = append(svc.Volumes, v)
+		}
+
+		// a user defined network replaces the network mode, as in docker run
+		if c.NetworkID != "" {
+			svc.Networks = []string{c.NetworkID}
+			file.Networks[c.NetworkID] = struct{}{}
+		} else {
+			svc.NetworkMode = c.NetworkMode
+		}
+
+		if len(c.HealthCheck.Test) > 0 {
+			svc.HealthCheck = &composeHealth{
+				Test:        c.HealthCheck.Test,
+				Interval:    c.HealthCheck.Interval,
+				Timeout:     c.HealthCheck.Timeout,
+				Retries:     c.HealthCheck.Retries,
+				StartPeriod: c.HealthCheck.StartPeriod,
+			}
+		}
+
+		res, err := config.ContainerResources(c)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %w", name, err)
+		}
+		svc.Deploy.Replicas = c.Replicas
+		svc.Deploy.Resources.Limits = composeResources{
+			CPUs:   formatCPUs(res.NanoCPUs),
+			Memory: formatMemory(res.Memory),
+		}
+		if res.PidsLimit != nil && *res.PidsLimit > 0 {
+			svc.Deploy.Resources.Limits.Pids = *res.PidsLimit
+		}
+		svc.CPUSet = res.CpusetCpus
+		if c.Resources != nil {
+			svc.ShmSize = c.Resources.ShmSize
+			svc.Ulimits = c.Resources.Ulimits
+		}
+		svc.Deploy.Resources.Reservations = composeResources{
+			Memory: formatMemory(res.MemoryReservation),
+		}
+
+		// compose names if-not-present "missing"
+		svc.PullPolicy = c.PullPolicy
+		if svc.PullPolicy == config.PullIfNotPresent {
+			svc.PullPolicy = "missing"
+		}
+
+		file.Services[name] = svc
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err = enc.Encode(file); err != nil {
+		return nil, err
+	}
+	if err = enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func composeVar(name string) string {
+	return fmt.Sprintf("${%s:?%s is not set}", name, name)
+}
+
+// formatCPUs formats nano CPUs as a decimal number of CPUs, "0.5".
+func formatCPUs(nano int64) string {
+	if nano == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%g", float64(nano)/1e9)
+}
+
+// formatMemory formats bytes with the largest exact binary unit, "512M".
+func formatMemory(bytes int64) string {
+	switch {
+	case bytes == 0:
+		return ""
+	case bytes%(1<<30) == 0:
+		return fmt.Sprintf("%dG", bytes>>30)
+	case bytes%(1<<20) == 0:
+		return fmt.Sprintf("%dM", bytes>>20)
+	}
+	return fmt.Sprintf("%d", bytes)
+}
@@ -0,0 +1,133 @@
+package export
+
+import (
+	"Infra/internal/dockr/config"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// containers returns the container configs of ulti sorted by name, so the
+// generated artifacts are stable.
+func containers(ulti *config.UltimateConfig) ([]*config.ContainerConfig, error) {
+	if ulti == nil || ulti.Containers == nil {
+		return nil, fmt.Errorf("ultimate config is nil")
+	}
+
+	res := make([]*config.ContainerConfig, 0, len(ulti.Containers))
+	for _, name := range ulti.Names() {
+		res = append(res, ulti.Containers[name].GetFull())
+	}
+	return res, nil
+}
+
+// credentials returns the env vars generated at deploy time for c. Their values
+// are not part of the config, generators leave them to the target platform.
+func credentials(c *config.ContainerConfig) []string {
+	if !c.IsDefault {
+		return nil
+	}
+	res := slices.Clone(c.Credentials)
+	slices.Sort(res)
+	return res
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// hasSecretRef reports whether value references a secret of another container.
+func hasSecretRef(value string) bool {
+	found := false
+	config.ReplaceSecretRefs(value, func(config.SecretRef) string {
+		found = true
+		return ""
+	})
+	return found
+}
+
+// envName returns the variable holding a credential of a container, e.g.
+// DB_POSTGRES_PASSWORD.
+func envName(container, key string) string {
+	return strings.ToUpper(sanitize(container, '_')) + "_" + key
+}
+
+// kubeName lowercases name and replaces anything not allowed in a DNS label.
+func kubeName(name string) string {
+	return strings.Trim(strings.ToLower(sanitize(name, '-')), "-")
+}
+
+func sanitize(name string, sep rune) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return sep
+	}, name)
+}
+
+type port struct {
+	published string
+	target    string
+	protocol  string
+}
+
+// parsePort parses the "[ip:]published:target[/protocol]" ports of
+// ContainerConfig, the host ip is not part of the artifacts.
+func parsePort(p string) (port, error) {
+	mappings, err := nat.ParsePortSpec(p)
+	if err != nil {
+		return port{}, fmt.Errorf("invalid port %q: %w", p, err)
+	}
+	if len(mappings) != 1 || mappings[0].Binding.HostPort == "" {
+		return port{}, fmt.Errorf("invalid port %q, expected a single published port", p)
+	}
+	m := mappings[0]
+	return port{published: m.Binding.HostPort, target: m.Port.Port(), protocol: m.Port.Proto()}, nil
+}
+
+type volume struct {
+	source   string
+	target   string
+	readOnly bool
+	named    bool
+}
+
+// parseVolume parses "source:target[:ro]", sources without a slash are named
+// volumes.
+func parseVolume(v string) (volume, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) < 2 {
+		return volume{}, fmt.Errorf("invalid volume %q", v)
+	}
+	return volume{
+		source:   parts[0],
+		target:   parts[1],
+		readOnly: len(parts) > 2 && slices.Contains(strings.Split(parts[2], ","), "ro"),
+		named:    !strings.Contains(parts[0], "/"),
+	}, nil
+}
+
+// healthCommand returns the command of a docker health check test and
+// whether it runs through a shell.
+func healthCommand(test []string) ([]string, bool) {
+	if len(test) == 0 {
+		return nil, false
+	}
+	switch test[0] {
+	case "CMD":
+		return test[1:], false
+	case "CMD-SHELL":
+		return []string{strings.Join(test[1:], " ")}, true
+	case "NONE":
+		return nil, false
+	}
+	return test, false
+}
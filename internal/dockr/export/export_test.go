@@ -0,0 +1,84 @@
+package export_test
+
+import (
+	"Infra/internal/dockr/config"
+	"Infra/internal/dockr/export"
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from golden file, run go test -update\ngot:\n%s", name, got)
+	}
+}
+
+func TestExport(t *testing.T) {
+
+	ulti, err := config.LoadContainersConfig("testdata/stack.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Compose", func(t *testing.T) {
+		out, err := export.Compose(ulti)
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden(t, "compose.yml", out)
+	})
+
+	t.Run("Kubernetes", func(t *testing.T) {
+		out, err := export.Kubernetes(ulti)
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden(t, "kubernetes.yaml", out)
+	})
+
+	t.Run("Systemd", func(t *testing.T) {
+		units, err := export.Systemd(ulti)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(units) != 6 {
+			t.Fatalf("expected 6 units, got %d", len(units))
+		}
+		for name, unit := range units {
+			golden(t, name, unit)
+		}
+	})
+	t.Run("KubernetesServiceNames", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "stack.yaml")
+		conf := "- name: \"db\"\n  preset: \"postgres\"\n  hostname: \"shared\"\n" +
+			"- name: \"api\"\n  preset: \"kong\"\n  hostname: \"shared\"\n"
+		if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ulti, err := config.LoadContainersConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := export.Kubernetes(ulti); err == nil {
+			t.Error("expected an error for two services named shared")
+		}
+	})
+}
@@ -0,0 +1,442 @@
+package export
+
+import (
+	"Infra/internal/dockr/config"
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"gopkg.in/yaml.v3"
+)
+
+// placeholder is written into generated Secrets, the values have to be set
+// before the manifests are applied.
+const placeholder = "change-me"
+
+// defaultClaimSize is requested by the claims generated for volumes.
+const defaultClaimSize = "1Gi"
+
+type kubeMeta struct {
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+type kubeObject struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   kubeMeta          `yaml:"metadata"`
+	Type       string            `yaml:"type,omitempty"`
+	Data       map[string]string `yaml:"data,omitempty"`
+	StringData map[string]string `yaml:"stringData,omitempty"`
+	Spec       any               `yaml:"spec,omitempty"`
+}
+
+type kubeDeploymentSpec struct {
+	Replicas int `yaml:"replicas"`
+	Selector struct {
+		MatchLabels map[string]string `yaml:"matchLabels"`
+	} `yaml:"selector"`
+	Template struct {
+		Metadata kubeMeta    `yaml:"metadata"`
+		Spec     kubePodSpec `yaml:"spec"`
+	} `yaml:"template"`
+}
+
+type kubePodSpec struct {
+	Hostname      string          `yaml:"hostname,omitempty"`
+	RestartPolicy string          `yaml:"restartPolicy,omitempty"`
+	Containers    []kubeContainer `yaml:"containers"`
+	Volumes       []kubeVolume    `yaml:"volumes,omitempty"`
+}
+
+type kubeContainer struct {
+	Name           string        `yaml:"name"`
+	Image          string        `yaml:"image"`
+	Command        []string      `yaml:"command,omitempty"`
+	Args           []string      `yaml:"args,omitempty"`
+	WorkingDir     string        `yaml:"workingDir,omitempty"`
+	Ports          []kubePort    `yaml:"ports,omitempty"`
+	EnvFrom        []kubeEnvFrom `yaml:"envFrom,omitempty"`
+	Env            []kubeEnv     `yaml:"env,omitempty"`
+	Resources      kubeResources `yaml:"resources"`
+	VolumeMounts   []kubeMount   `yaml:"volumeMounts,omitempty"`
+	LivenessProbe  *kubeProbe    `yaml:"livenessProbe,omitempty"`
+	ReadinessProbe *kubeProbe    `yaml:"readinessProbe,omitempty"`
+}
+
+type kubePort struct {
+	Name          string `yaml:"name,omitempty"`
+	ContainerPort int    `yaml:"containerPort"`
+	Protocol      string `yaml:"protocol"`
+}
+
+type kubeEnvFrom struct {
+	ConfigMapRef struct {
+		Name string `yaml:"name"`
+	} `yaml:"configMapRef"`
+}
+
+type kubeEnv struct {
+	Name      string         `yaml:"name"`
+	Value     string         `yaml:"value,omitempty"`
+	ValueFrom *kubeEnvSource `yaml:"valueFrom,omitempty"`
+}
+
+type kubeEnvSource struct {
+	SecretKeyRef kubeKeyRef `yaml:"secretKeyRef"`
+}
+
+type kubeKeyRef struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+type kubeResources struct {
+	Limits   map[string]string `yaml:"limits,omitempty"`
+	Requests map[string]string `yaml:"requests,omitempty"`
+}
+
+type kubeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+	ReadOnly  bool   `yaml:"readOnly,omitempty"`
+}
+
+type kubeVolume struct {
+	Name                  string `yaml:"name"`
+	PersistentVolumeClaim *struct {
+		ClaimName string `yaml:"claimName"`
+	} `yaml:"persistentVolumeClaim,omitempty"`
+	HostPath *struct {
+		Path string `yaml:"path"`
+	} `yaml:"hostPath,omitempty"`
+}
+
+type kubeProbe struct {
+	Exec struct {
+		Command []string `yaml:"command"`
+	} `yaml:"exec"`
+	InitialDelaySeconds int `yaml:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int `yaml:"periodSeconds,omitempty"`
+	TimeoutSeconds      int `yaml:"timeoutSeconds,omitempty"`
+	FailureThreshold    int `yaml:"failureThreshold,omitempty"`
+}
+
+type kubeServiceSpec struct {
+	Selector map[string]string `yaml:"selector"`
+	Ports    []kubeServicePort `yaml:"ports"`
+}
+
+type kubeServicePort struct {
+	Name       string `yaml:"name"`
+	Port       int    `yaml:"port"`
+	TargetPort int    `yaml:"targetPort"`
+	Protocol   string `yaml:"protocol"`
+}
+
+type kubeClaimSpec struct {
+	AccessModes []string `yaml:"accessModes"`
+	Resources   struct {
+		Requests map[string]string `yaml:"requests"`
+	} `yaml:"resources"`
+}
+
+// Kubernetes generates a multi document manifest with a ConfigMap, Secret,
+// PersistentVolumeClaims, Deployment and Service per container. Probes come
+// from the health check, resources from the load level. Secrets hold
+// placeholders for the generated credentials. The Deployment runs the
+// replicas of the container, its entrypoint is the command of the pod.
+//
+// Services are named after the hostname of the container, the name the other
+// containers reach it by, or after the container without one. Named volumes
+// become claims; host binds stay hostPath volumes of the node the pod runs
+// on, which is logged as they rarely hold the files there.
+func Kubernetes(ulti *config.UltimateConfig) ([]byte, error) {
+	conf, err := containers(ulti)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []kubeObject
+	services := make(map[string]string)
+	for _, c := range conf {
+		obj, err := kubeContainerObjects(c)
+		if err != nil {
+			return nil, fmt.Errorf("container %s: %w", c.GetName(), err)
+		}
+		for _, o := range obj {
+			if o.Kind != "Service" {
+				continue
+			}
+			if other, ok := services[o.Metadata.Name]; ok {
+				return nil, fmt.Errorf("containers %s and %s both need the service %s", other, c.GetName(), o.Metadata.Name)
+			}
+			services[o.Metadata.Name] = c.GetName()
+		}
+		objects = append(objects, obj...)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, obj := range objects {
+		if err = enc.Encode(obj); err != nil {
+			return nil, err
+		}
+	}
+	if err = enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func kubeContainerObjects(c *config.ContainerConfig) ([]kubeObject, error) {
+	name := kubeName(c.GetName())
+	labels := map[string]string{
+		"app.kubernetes.io/name":       name,
+		"app.kubernetes.io/managed-by": "infra",
+	}
+	selector := map[string]string{"app.kubernetes.io/name": name}
+	meta := func(suffix string) kubeMeta {
+		return kubeMeta{Name: name + suffix, Labels: labels}
+	}
+
+	var objects []kubeObject
+
+	res, err := config.ContainerResources(c)
+	if err != nil {
+		return nil, err
+	}
+
+	cont := kubeContainer{
+		Name:       name,
+		Image:      c.Image,
+		Command:    c.Entrypoint,
+		Args:       c.Cmd,
+		WorkingDir: c.WorkingDir,
+		Resources:  kubeResourcesOf(res),
+	}
+
+	// env: plain values go to a ConfigMap, credentials and references to
+	// other containers' credentials are read from Secrets
+	plain := make(map[string]string)
+	for _, k := range sortedKeys(c.EnvVars) {
+		v := c.EnvVars[k]
+		if !hasSecretRef(v) {
+			plain[k] = v
+			continue
+		}
+		cont.Env = append(cont.Env, kubeSecretEnv(k, v)...)
+	}
+	if len(plain) > 0 {
+		objects = append(objects, kubeObject{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+			Metadata:   meta("-env"),
+			Data:       plain,
+		})
+		var from kubeEnvFrom
+		from.ConfigMapRef.Name = name + "-env"
+		cont.EnvFrom = append(cont.EnvFrom, from)
+	}
+
+	if creds := credentials(c); len(creds) > 0 {
+		data := make(map[string]string, len(creds))
+		for _, key := range creds {
+			data[key] = placeholder
+			cont.Env = append(cont.Env, secretKeyEnv(key, name+"-credentials", key))
+		}
+		objects = append(objects, kubeObject{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Metadata:   meta("-credentials"),
+			Type:       "Opaque",
+			StringData: data,
+		})
+	}
+
+	var volumes []kubeVolume
+	for i, v := range c.Volumes {
+		vol, err := parseVolume(v)
+		if err != nil {
+			return nil, err
+		}
+
+		mount := fmt.Sprintf("data-%d", i)
+		kv := kubeVolume{Name: mount}
+		if vol.named {
+			claim := kubeName(vol.source)
+			var spec kubeClaimSpec
+			spec.AccessModes = []string{"ReadWriteOnce"}
+			spec.Resources.Requests = map[string]string{"storage": defaultClaimSize}
+			objects = append(objects, kubeObject{
+				APIVersion: "v1",
+				Kind:       "PersistentVolumeClaim",
+				Metadata:   kubeMeta{Name: claim, Labels: labels},
+				Spec:       spec,
+			})
+			kv.PersistentVolumeClaim = &struct {
+				ClaimName string `yaml:"claimName"`
+			}{ClaimName: claim}
+		} else {
+			log.Printf("container %s: host bind %s is exported as a hostPath volume, the path has to exist on the node\n", c.GetName(), vol.source)
+			kv.HostPath = &struct {
+				Path string `yaml:"path"`
+			}{Path: vol.source}
+		}
+		volumes = append(volumes, kv)
+		cont.VolumeMounts = append(cont.VolumeMounts, kubeMount{Name: mount, MountPath: vol.target, ReadOnly: vol.readOnly})
+	}
+
+	var svcPorts []kubeServicePort
+	for _, p := range c.Ports {
+		parsed, err := parsePort(p)
+		if err != nil {
+			return nil, err
+		}
+		published, err := strconv.Atoi(parsed.published)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+		target, err := strconv.Atoi(parsed.target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+
+		protocol := strings.ToUpper(parsed.protocol)
+		portName := fmt.Sprintf("%s-%d", strings.ToLower(protocol), target)
+		cont.Ports = append(cont.Ports, kubePort{Name: portName, ContainerPort: target, Protocol: protocol})
+		svcPorts = append(svcPorts, kubeServicePort{Name: portName, Port: published, TargetPort: target, Protocol: protocol})
+	}
+
+	if probe := kubeProbeOf(c.HealthCheck); probe != nil {
+		readiness := *probe
+		cont.LivenessProbe, cont.ReadinessProbe = probe, &readiness
+	}
+
+	var deploy kubeDeploymentSpec
+	deploy.Replicas = max(c.Replicas, 1)
+	deploy.Selector.MatchLabels = selector
+	deploy.Template.Metadata = kubeMeta{Name: name, Labels: labels}
+	deploy.Template.Spec = kubePodSpec{
+		Hostname:   c.Hostname,
+		Containers: []kubeContainer{cont},
+		Volumes:    volumes,
+	}
+	objects = append(objects, kubeObject{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata:   meta(""),
+		Spec:       deploy,
+	})
+
+	if len(svcPorts) > 0 {
+		service := name
+		if c.Hostname != "" {
+			service = kubeName(c.Hostname)
+		}
+		objects = append(objects, kubeObject{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Metadata:   kubeMeta{Name: service, Labels: labels},
+			Spec:       kubeServiceSpec{Selector: selector, Ports: svcPorts},
+		})
+	}
+	return objects, nil
+}
+
+// kubeSecretEnv maps an env var referencing credentials of other containers.
+// A value that is a single reference reads the secret key directly, otherwise
+// each referenced key gets a helper variable expanded with $(VAR).
+func kubeSecretEnv(key, value string) []kubeEnv {
+	var (
+		refs []config.SecretRef
+		env  []kubeEnv
+	)
+	expanded := config.ReplaceSecretRefs(value, func(ref config.SecretRef) string {
+		refs = append(refs, ref)
+		return "$(" + envName(ref.Container, ref.Key) + ")"
+	})
+
+	if len(refs) == 1 && expanded == "$("+envName(refs[0].Container, refs[0].Key)+")" {
+		return []kubeEnv{secretKeyEnv(key, kubeName(refs[0].Container)+"-credentials", refs[0].Key)}
+	}
+
+	for _, ref := range refs {
+		env = append(env, secretKeyEnv(envName(ref.Container, ref.Key), kubeName(ref.Container)+"-credentials", ref.Key))
+	}
+	return append(env, kubeEnv{Name: key, Value: expanded})
+}
+
+func secretKeyEnv(name, secret, key string) kubeEnv {
+	return kubeEnv{
+		Name:      name,
+		ValueFrom: &kubeEnvSource{SecretKeyRef: kubeKeyRef{Name: secret, Key: key}},
+	}
+}
+
+// kubeResourcesOf maps container resources onto limits and requests. CPU
+// requests come from the CPU shares (1024 shares = 1 CPU), as the kubelet does
+// the reverse mapping.
+func kubeResourcesOf(res container.Resources) kubeResources {
+	out := kubeResources{
+		Limits:   make(map[string]string),
+		Requests: make(map[string]string),
+	}
+
+	if res.NanoCPUs > 0 {
+		out.Limits["cpu"] = fmt.Sprintf("%dm", res.NanoCPUs/1e6)
+	}
+	if res.Memory > 0 {
+		out.Limits["memory"] = kubeQuantity(res.Memory)
+	}
+	if res.CPUShares > 0 {
+		out.Requests["cpu"] = fmt.Sprintf("%dm", res.CPUShares*1000/1024)
+	}
+	if res.MemoryReservation > 0 {
+		out.Requests["memory"] = kubeQuantity(res.MemoryReservation)
+	}
+	return out
+}
+
+func kubeQuantity(bytes int64) string {
+	switch {
+	case bytes%(1<<30) == 0:
+		return fmt.Sprintf("%dGi", bytes>>30)
+	case bytes%(1<<20) == 0:
+		return fmt.Sprintf("%dMi", bytes>>20)
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+func kubeProbeOf(hc config.HealthCheckConfig) *kubeProbe {
+	cmd, shell := healthCommand(hc.Test)
+	if len(cmd) == 0 {
+		return nil
+	}
+
+	probe := &kubeProbe{
+		InitialDelaySeconds: seconds(hc.StartPeriod),
+		PeriodSeconds:       seconds(hc.Interval),
+		TimeoutSeconds:      seconds(hc.Timeout),
+		FailureThreshold:    hc.Retries,
+	}
+	if shell {
+		probe.Exec.Command = []string{"/bin/sh", "-c", cmd[0]}
+	} else {
+		probe.Exec.Command = cmd
+	}
+	return probe
+}
+
+func seconds(d string) int {
+	parsed, err := time.ParseDuration(d)
+	if err != nil {
+		return 0
+	}
+	return int(parsed.Seconds())
+}
@@ -0,0 +1,318 @@
+package export
+
+import (
+	"Infra/internal/dockr/config"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// podman is the binary the generated units run.
+const podman = "/usr/bin/podman"
+
+// UnitName returns the systemd unit of a container, infra-<name>.service.
+func UnitName(container string) string {
+	return "infra-" + kubeName(container) + ".service"
+}
+
+// Systemd generates a Podman unit file per container, keyed by unit name, in
+// the style of `podman generate systemd --new`. Credentials and references to
+// credentials are read from /etc/infra/<name>.env. A container with replicas
+// gets a unit per replica, named like the containers Infra runs.
+func Systemd(ulti *config.UltimateConfig) (map[string][]byte, error) {
+	conf, err := containers(ulti)
+	if err != nil {
+		return nil, err
+	}
+
+	units := make(map[string][]byte, len(conf))
+	for _, c := range conf {
+		for i := 1; i <= max(c.Replicas, 1); i++ {
+			replica := *c
+			replica.Name = config.ReplicaName(c.GetName(), i)
+			replica.Replicas = 0
+			unit, err := systemdUnit(&replica)
+			if err != nil {
+				return nil, fmt.Errorf("container %s: %w", replica.Name, err)
+			}
+			units[UnitName(replica.Name)] = unit
+		}
+	}
+	return units, nil
+}
+
+func systemdUnit(c *config.ContainerConfig) ([]byte, error) {
+	name := c.GetName()
+
+	after := []string{"network-online.target"}
+	var requires []string
+	for _, dep := range c.DependsOn {
+		after = append(after, UnitName(dep))
+		requires = append(requires, UnitName(dep))
+	}
+
+	args := []string{
+		podman, "run",
+		"--cidfile=%t/%n.ctr-id",
+		"--cgroups=no-conmon",
+		"--rm",
+		"--sdnotify=conmon",
+		"--replace",
+		"-d",
+		"--name", name,
+	}
+	if c.Hostname != "" {
+		args = append(args, "--hostname", c.Hostname)
+	}
+	if c.WorkingDir != "" {
+		args = append(args, "--workdir", c.WorkingDir)
+	}
+	if c.NetworkID != "" {
+		args = append(args, "--network", c.NetworkID)
+	} else if c.NetworkMode != "" {
+		args = append(args, "--network", c.NetworkMode)
+	}
+	for _, p := range c.Ports {
+		args = append(args, "--publish", p)
+	}
+	for _, v := range c.Volumes {
+		args = append(args, "--volume", v)
+	}
+	if len(c.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", healthJSON(c.Entrypoint))
+	}
+	if c.User != "" {
+		args = append(args, "--user", c.User)
+	}
+	for _, k := range sortedKeys(c.Labels) {
+		args = append(args, "--label", k+"="+c.Labels[k])
+	}
+	if c.StopSignal != "" {
+		args = append(args, "--stop-signal", c.StopSignal)
+	}
+	if timeout := c.GetStopTimeout(); timeout != nil {
+		args = append(args, "--stop-timeout", fmt.Sprintf("%d", *timeout))
+	}
+	if c.Tty {
+		args = append(args, "--tty")
+	}
+	for _, capability := range c.CapAdd {
+		args = append(args, "--cap-add", capability)
+	}
+	for _, capability := range c.CapDrop {
+		args = append(args, "--cap-drop", capability)
+	}
+	if c.Privileged {
+		args = append(args, "--privileged")
+	}
+	if c.ReadOnly {
+		args = append(args, "--read-only")
+	}
+	for _, opt := range c.SecurityOpt {
+		args = append(args, "--security-opt", opt)
+	}
+	for _, k := range sortedKeys(c.Sysctls) {
+		args = append(args, "--sysctl", k+"="+c.Sysctls[k])
+	}
+	for _, d := range c.Devices {
+		args = append(args, "--device", d)
+	}
+	for _, server := range c.DNS {
+		args = append(args, "--dns", server)
+	}
+	for _, domain := range c.DNSSearch {
+		args = append(args, "--dns-search", domain)
+	}
+	for _, h := range c.GetExtraHosts() {
+		args = append(args, "--add-host", h)
+	}
+	if c.Init != nil && *c.Init {
+		args = append(args, "--init")
+	}
+	if c.Logging != nil {
+		if c.Logging.Driver != "" {
+			args = append(args, "--log-driver", c.Logging.Driver)
+		}
+		for _, k := range sortedKeys(c.Logging.Options) {
+			args = append(args, "--log-opt", k+"="+c.Logging.Options[k])
+		}
+	}
+
+	// secrets are passed by name, podman takes the value from the unit
+	// environment loaded from the env file
+	secret := false
+	for _, k := range sortedKeys(c.EnvVars) {
+		if hasSecretRef(c.EnvVars[k]) {
+			args, secret = append(args, "--env", k), true
+			continue
+		}
+		args = append(args, "--env", k+"="+c.EnvVars[k])
+	}
+	for _, k := range credentials(c) {
+		if _, ok := c.EnvVars[k]; !ok {
+			args, secret = append(args, "--env", k), true
+		}
+	}
+
+	res, err := config.ContainerResources(c)
+	if err != nil {
+		return nil, err
+	}
+	if res.NanoCPUs > 0 {
+		args = append(args, "--cpus", formatCPUs(res.NanoCPUs))
+	}
+	if res.CpusetCpus != "" {
+		args = append(args, "--cpuset-cpus", res.CpusetCpus)
+	}
+	if res.Memory > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%d", res.Memory))
+	}
+	if res.MemoryReservation > 0 {
+		args = append(args, "--memory-reservation", fmt.Sprintf("%d", res.MemoryReservation))
+	}
+	if res.PidsLimit != nil && *res.PidsLimit != 0 {
+		args = append(args, "--pids-limit", fmt.Sprintf("%d", *res.PidsLimit))
+	}
+	for _, u := range res.Ulimits {
+		args = append(args, "--ulimit", fmt.Sprintf("%s=%d:%d", u.Name, u.Soft, u.Hard))
+	}
+	if shm, err := c.Resources.ShmBytes(); err == nil && shm > 0 {
+		args = append(args, "--shm-size", fmt.Sprintf("%d", shm))
+	}
+
+	if cmd, shell := healthCommand(c.HealthCheck.Test); len(cmd) > 0 {
+		if shell {
+			args = append(args, "--health-cmd", cmd[0])
+		} else {
+			args = append(args, "--health-cmd", healthJSON(cmd))
+		}
+		if c.HealthCheck.Interval != "" {
+			args = append(args, "--health-interval", c.HealthCheck.Interval)
+		}
+		if c.HealthCheck.Timeout != "" {
+			args = append(args, "--health-timeout", c.HealthCheck.Timeout)
+		}
+		if c.HealthCheck.Retries > 0 {
+			args = append(args, "--health-retries", fmt.Sprintf("%d", c.HealthCheck.Retries))
+		}
+		if c.HealthCheck.StartPeriod != "" {
+			args = append(args, "--health-start-period", c.HealthCheck.StartPeriod)
+		}
+	}
+
+	image := len(args)
+	args = append(args, c.Image)
+	args = append(args, c.Cmd...)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s generated by infra\n\n", UnitName(name))
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=Infra container %s\n", name)
+	b.WriteString("Wants=network-online.target\n")
+	fmt.Fprintf(&b, "After=%s\n", strings.Join(after, " "))
+	if len(requires) > 0 {
+		fmt.Fprintf(&b, "Requires=%s\n", strings.Join(requires, " "))
+	}
+
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Environment=PODMAN_SYSTEMD_UNIT=%n\n")
+	if secret {
+		fmt.Fprintf(&b, "EnvironmentFile=/etc/infra/%s.env\n", kubeName(name))
+	}
+	fmt.Fprintf(&b, "Restart=%s\n", systemdRestart(c.RestartPolicy))
+	b.WriteString("TimeoutStopSec=70\n")
+	if c.Build != nil {
+		build := systemdBuild(c)
+		fmt.Fprintf(&b, "ExecStartPre=%s\n", systemdCommand(build, len(build)-1))
+	}
+	b.WriteString("ExecStartPre=/bin/rm -f %t/%n.ctr-id\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", systemdCommand(args, image))
+	fmt.Fprintf(&b, "ExecStop=%s stop --ignore --cidfile=%%t/%%n.ctr-id\n", podman)
+	fmt.Fprintf(&b, "ExecStopPost=%s rm -f --ignore --cidfile=%%t/%%n.ctr-id\n", podman)
+	b.WriteString("Type=notify\n")
+	b.WriteString("NotifyAccess=all\n")
+
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=default.target\n")
+	return []byte(b.String()), nil
+}
+
+// systemdBuild returns the podman build command of a container with a build
+// section, the context is the last argument.
+func systemdBuild(c *config.ContainerConfig) []string {
+	dockerfile := c.Build.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	args := []string{podman, "build", "--tag", c.Image, "--file", filepath.Join(c.Build.Context, dockerfile)}
+	for _, k := range slices.Sorted(maps.Keys(c.Build.Args)) {
+		args = append(args, "--build-arg", k+"="+c.Build.Args[k])
+	}
+	if c.Build.Target != "" {
+		args = append(args, "--target", c.Build.Target)
+	}
+	for _, k := range slices.Sorted(maps.Keys(c.Build.Labels)) {
+		args = append(args, "--label", k+"="+c.Build.Labels[k])
+	}
+	for _, img := range c.Build.CacheFrom {
+		args = append(args, "--cache-from", img)
+	}
+	return append(args, c.Build.Context)
+}
+
+func systemdRestart(policy string) string {
+	switch policy {
+	case "no":
+		return "no"
+	case "on-failure":
+		return "on-failure"
+	}
+	return "always"
+}
+
+// systemdCommand joins args into an Exec line, one flag per continued line and
+// the image with its command on the last one. Arguments are quoted when needed
+// and $ is escaped so systemd does not expand it; the %t / %n specifiers of the
+// fixed podman flags are kept.
+func systemdCommand(args []string, image int) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = systemdQuote(a)
+	}
+
+	var b strings.Builder
+	b.WriteString(quoted[0])
+	for i := 1; i < len(quoted); i++ {
+		if i <= image && (i == image || strings.HasPrefix(quoted[i], "-")) {
+			b.WriteString(" \\\n\t")
+		} else {
+			b.WriteString(" ")
+		}
+		b.WriteString(quoted[i])
+	}
+	return b.String()
+}
+
+func systemdQuote(arg string) string {
+	if !strings.Contains(arg, "%t/%n") {
+		arg = strings.ReplaceAll(arg, "%", "%%")
+	}
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	return `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+}
+
+// healthJSON encodes an exec health check the way podman expects it,
+// ["CMD", "arg"].
+func healthJSON(cmd []string) string {
+	parts := make([]string, len(cmd))
+	for i, c := range cmd {
+		parts[i] = fmt.Sprintf("%q", c)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
@@ -0,0 +1,176 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// EnvStateDir overrides the directory where Infra keeps its state.
+	EnvStateDir = "INFRA_STATE_DIR"
+
+	defaultFile = "state.json"
+
+	// maxRevisions is the number of applied revisions kept in the state file.
+	maxRevisions = 50
+)
+
+// Store is a file backed store for everything Infra has to remember between
+// deployments (generated credentials, applied revisions).
+type Store struct {
+	path string
+	data stateFile
+
+	mu *sync.RWMutex
+}
+
+type stateFile struct {
+	Secrets   map[string]map[string]string `json:"secrets"`
+	Revisions []Revision                   `json:"revisions,omitempty"`
+}
+
+// Revision is a deployment applied by Infra: the image and config hash of
+// every container it ran.
+type Revision struct {
+	Number     int                          `json:"number"`
+	Time       time.Time                    `json:"time"`
+	Containers map[string]RevisionContainer `json:"containers"`
+}
+
+// RevisionContainer is a container of a Revision.
+type RevisionContainer struct {
+	Image string `json:"image"`
+	Hash  string `json:"hash"`
+}
+
+// DefaultPath returns the state file location: INFRA_STATE_DIR when it is
+// set, otherwise the infra directory of the per-user state directory
+// ($XDG_STATE_HOME, ~/.local/state by default), so the generated credentials
+// do not depend on the directory Infra runs from.
+func DefaultPath() string {
+	if dir := os.Getenv(EnvStateDir); dir != "" {
+		return filepath.Join(dir, defaultFile)
+	}
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return defaultFile
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "infra", defaultFile)
+}
+
+// OpenDefault opens the state file at DefaultPath.
+func OpenDefault() (*Store, error) {
+	return Open(DefaultPath())
+}
+
+// Open loads the state file at path. A missing file results in an empty store,
+// the file is created on the first write.
+func Open(path string) (*Store, error) {
+	if path == "" {
+		return nil, fmt.Errorf("state file path is empty")
+	}
+
+	s := &Store{
+		path: path,
+		data: stateFile{Secrets: make(map[string]map[string]string)},
+		mu:   &sync.RWMutex{},
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err = json.Unmarshal(raw, &s.data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal state file: %w", err)
+	}
+	if s.data.Secrets == nil {
+		s.data.Secrets = make(map[string]map[string]string)
+	}
+	return s, nil
+}
+
+// Path returns the location of the state file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// GetSecret returns the stored secret key of the given container.
+func (s *Store) GetSecret(service, key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.data.Secrets[service][key]
+	return v, ok
+}
+
+// SetSecret stores the secret and persists the state file.
+func (s *Store) SetSecret(service, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Secrets[service] == nil {
+		s.data.Secrets[service] = make(map[string]string)
+	}
+	s.data.Secrets[service][key] = value
+	return s.save()
+}
+
+// AddRevision records an applied deployment and persists the state file. Only
+// the latest revisions are kept.
+func (s *Store) AddRevision(containers map[string]RevisionContainer) (Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rev := Revision{Number: 1, Time: time.Now().UTC(), Containers: containers}
+	if n := len(s.data.Revisions); n > 0 {
+		rev.Number = s.data.Revisions[n-1].Number + 1
+	}
+
+	s.data.Revisions = append(s.data.Revisions, rev)
+	if n := len(s.data.Revisions); n > maxRevisions {
+		s.data.Revisions = s.data.Revisions[n-maxRevisions:]
+	}
+	return rev, s.save()
+}
+
+// Revisions returns the recorded revisions, oldest first.
+func (s *Store) Revisions() []Revision {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.data.Revisions)
+}
+
+// save writes the state atomically. The file holds credentials, so it is only
+// readable by the owner.
+func (s *Store) save() error {
+	raw, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
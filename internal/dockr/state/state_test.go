@@ -0,0 +1,54 @@
+package state_test
+
+import (
+	"Infra/internal/dockr/state"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenDefault(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(state.EnvStateDir, "")
+	t.Setenv("XDG_STATE_HOME", home)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if path := state.DefaultPath(); path != filepath.Join(home, "infra", "state.json") {
+		t.Fatalf("state file not in the user state dir: %s", path)
+	}
+
+	store, err := state.OpenDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.SetSecret("DB", "POSTGRES_PASSWORD", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// other working directories use the same state
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if store, err = state.OpenDefault(); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := store.GetSecret("DB", "POSTGRES_PASSWORD"); !ok || v != "secret" {
+		t.Errorf("secrets depend on the working directory, got %q", v)
+	}
+
+	t.Run("StateDir", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv(state.EnvStateDir, dir)
+		if path := state.DefaultPath(); path != filepath.Join(dir, "state.json") {
+			t.Errorf("%s not used: %s", state.EnvStateDir, path)
+		}
+	})
+}